@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+)
+
+var addLocationsToWaysCmd = &cobra.Command{
+	Use:   "add-locations-to-ways [pbf file|-]",
+	Short: "Copy a pbf file adding node locations to ways (LocationsOnWays).",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAddLocationsToWays,
+}
+
+func init() {
+	addPBFWriterFlags(addLocationsToWaysCmd)
+	addCacheFlags(addLocationsToWaysCmd)
+	addLocationsToWaysCmd.Flags().Bool("keep_untagged_nodes", false, "Keep untagged nodes which are not relation members.")
+}
+
+func runAddLocationsToWays(cmd *cobra.Command, args []string) error {
+	if viper.GetString("output") == "" {
+		return errors.New("missing --output")
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	if err := c.Provide(
+		func() bool { return viper.GetBool("keep_untagged_nodes") },
+		dig.Name("keepUntaggedNodes"),
+	); err != nil {
+		return err
+	}
+	if err := c.Provide(osm.NewPBFLocationsOnWaysWriter); err != nil {
+		return err
+	}
+	return c.Invoke(func(writer osm.PBFDataParser) error {
+		return writer.Run()
+	})
+}
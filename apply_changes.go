@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+)
+
+var applyChangesCmd = &cobra.Command{
+	Use:   "apply-changes [osc file]",
+	Short: "Apply an osmChange file to the cache of geojson --updatable_cache, write the changed features as GeoJSON.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApplyChanges,
+}
+
+func init() {
+	applyChangesCmd.Flags().StringP("output", "o", "", "Output file (default stdout).")
+	applyChangesCmd.Flags().String("level_db_path", "/tmp/osmparser", "LevelDB cache directory.")
+	addGeoJSONFlags(applyChangesCmd)
+}
+
+func runApplyChanges(cmd *cobra.Command, args []string) error {
+	out, closeOutput, err := createOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	c := dig.New()
+	outputElementChan := make(chan element.Element)
+	for _, err := range []error{
+		c.Provide(func() string { return args[0] }, dig.Name("changeFile")),
+		c.Provide(func() string { return viper.GetString("level_db_path") }, dig.Name("levelDBPath")),
+		c.Provide(
+			func() chan element.Element { return outputElementChan },
+			dig.Name("outputElementChan"),
+		),
+		c.Provide(osm.NewChangeApplier),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Invoke(func(applier *osm.ChangeApplier) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- writeFeatureCollection(out, outputElementChan)
+		}()
+		if err := applier.Run(); err != nil {
+			<-done
+			return err
+		}
+		return <-done
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var catCmd = &cobra.Command{
+	Use:   "cat [input file|-]",
+	Short: "Convert between pbf and OSM XML, the output format follows its file name.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCat,
+}
+
+func init() {
+	addPBFWriterFlags(catCmd)
+}
+
+func runCat(cmd *cobra.Command, args []string) error {
+	if viper.GetString("output") == "" {
+		return errors.New("missing --output")
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	if err := c.Provide(osm.NewCatWriter); err != nil {
+		return err
+	}
+	return c.Invoke(func(writer osm.PBFDataParser) error {
+		return writer.Run()
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"os"
+)
+
+// openSource returns the input of a command, "-" reads stdin.
+// Call close once done.
+func openSource(arg string) (source osm.Source, close func(), err error) {
+	if arg != "-" {
+		return osm.FileSource(arg), func() {}, nil
+	}
+	spooled, err := osm.NewSpooledSource(os.Stdin, "", "stdin")
+	if err != nil {
+		return nil, nil, err
+	}
+	return spooled, func() { spooled.Close() }, nil
+}
+
+// openSources is openSource for several inputs read as one dataset.
+func openSources(args []string) (source osm.Source, close func(), err error) {
+	if len(args) == 1 {
+		return openSource(args[0])
+	}
+	sources := make([]osm.Source, 0, len(args))
+	closers := make([]func(), 0, len(args))
+	close = func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	for _, arg := range args {
+		s, c, err := openSource(arg)
+		if err != nil {
+			close()
+			return nil, nil, err
+		}
+		sources = append(sources, s)
+		closers = append(closers, c)
+	}
+	return osm.NewMultiSource(sources...), close, nil
+}
+
+// addCacheFlags adds the flags of commands using the leveldb cache.
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().String("level_db_path", "/tmp/osmparser", "LevelDB cache directory.")
+	cmd.Flags().Int("batch_size", 5000, "LevelDB write batch size.")
+}
+
+// addPBFWriterFlags adds the flags of commands writing a pbf file.
+func addPBFWriterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "", "Output pbf file.")
+	cmd.Flags().String("compression", "zlib", "Blob compression: none, zlib, lzma, lz4 or zstd.")
+	cmd.Flags().Int("block_size", pbf.DefaultBlockSize, "Max elements per pbf block.")
+}
+
+// newContainer provides the params shared by the parser passes.
+func newContainer(source osm.Source) (*dig.Container, error) {
+	return newContainerWithCache(source, viper.GetString("level_db_path"))
+}
+
+// newContainerWithCache is newContainer with another cache directory.
+func newContainerWithCache(source osm.Source, levelDBPath string) (*dig.Container, error) {
+	c := dig.New()
+	providers := []struct {
+		constructor interface{}
+		name        string
+	}{
+		{func() string { return source.Name() }, "pbfFile"},
+		{func() osm.Source { return source }, "source"},
+		{func() *bitmask.PBFMasks { return bitmask.NewPBFMasks() }, "pbfMasks"},
+		{func() string { return levelDBPath }, "levelDBPath"},
+		{func() int { return viper.GetInt("batch_size") }, "batchSize"},
+		{func() string { return viper.GetString("output") }, "outputFile"},
+		{func() string { return viper.GetString("compression") }, "compression"},
+		{func() int { return viper.GetInt("block_size") }, "blockSize"},
+	}
+	for _, p := range providers {
+		if err := c.Provide(p.constructor, dig.Name(p.name)); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// addBoundaryFlags adds the flags of commands clipping to a boundary.
+func addBoundaryFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64("boundary_relation", 0, "Keep only features inside the area of this relation of the input, ex an admin boundary.")
+}
+
+// provideIndexers provides the index passes of PBFParser like passes,
+// clipped to --boundary_relation if set.
+func provideIndexers(c *dig.Container) error {
+	var indexer interface{} = osm.NewPBFIndexer
+	if relationID := viper.GetInt64("boundary_relation"); relationID != 0 {
+		indexer = osm.NewBoundaryIndexer
+		if err := c.Provide(func() int64 { return relationID }, dig.Name("boundaryRelation")); err != nil {
+			return err
+		}
+	}
+	if err := c.Provide(indexer, dig.Name("pbfIndexer")); err != nil {
+		return err
+	}
+	return c.Provide(osm.NewPBFRelationMemberIndexer, dig.Name("pbfRelationMemberIndexer"))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [old file] [new file]",
+	Short: "Write the features changed between two snapshots as GeoJSON, and optionally an osmChange file.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runDiff,
+}
+
+func init() {
+	diffCmd.Flags().StringP("output", "o", "", "Output file (default stdout).")
+	diffCmd.Flags().String("osc", "", "Also write the changed elements as osmChange, gzipped if named .osc.gz.")
+	addCacheFlags(diffCmd)
+	addGeoJSONFlags(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	oldSource, closeOld, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeOld()
+	newSource, closeNew, err := openSource(args[1])
+	if err != nil {
+		return err
+	}
+	defer closeNew()
+
+	out, closeOutput, err := createOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	c := dig.New()
+	outputElementChan := make(chan element.Element)
+	providers := []struct {
+		constructor interface{}
+		name        string
+	}{
+		{func() osm.Source { return oldSource }, "oldSource"},
+		{func() osm.Source { return newSource }, "newSource"},
+		{func() string { return viper.GetString("level_db_path") }, "levelDBPath"},
+		{func() int { return viper.GetInt("batch_size") }, "batchSize"},
+		{func() chan element.Element { return outputElementChan }, "outputElementChan"},
+		{func() string { return viper.GetString("osc") }, "outputChangeFile"},
+	}
+	for _, p := range providers {
+		if err := c.Provide(p.constructor, dig.Name(p.name)); err != nil {
+			return err
+		}
+	}
+	if err := c.Provide(osm.NewPBFDiff); err != nil {
+		return err
+	}
+
+	return c.Invoke(func(diff *osm.PBFDiff) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- writeFeatureCollection(out, outputElementChan)
+		}()
+		if err := diff.Run(); err != nil {
+			<-done
+			return err
+		}
+		return <-done
+	})
+}
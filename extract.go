@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract [input file|-]...",
+	Short: "Write the elements the parser keeps, with their dependencies, as pbf or OSM XML.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runExtract,
+}
+
+func init() {
+	addPBFWriterFlags(extractCmd)
+	addCacheFlags(extractCmd)
+	addBoundaryFlags(extractCmd)
+}
+
+func runExtract(cmd *cobra.Command, args []string) error {
+	if viper.GetString("output") == "" {
+		return errors.New("missing --output")
+	}
+	source, closeSource, err := openSources(args)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	if err := provideIndexers(c); err != nil {
+		return err
+	}
+	if err := c.Provide(osm.NewPBFExtractWriter); err != nil {
+		return err
+	}
+	return c.Invoke(func(writer osm.PBFDataParser) error {
+		return writer.Run()
+	})
+}
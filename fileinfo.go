@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var fileinfoCmd = &cobra.Command{
+	Use:   "fileinfo [pbf file]",
+	Short: "Show pbf file header, optionally scan its content.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFileInfo,
+}
+
+func init() {
+	fileinfoCmd.Flags().BoolP("extended", "e", false, "Scan all blobs for counts, id ranges and sort order.")
+}
+
+func runFileInfo(cmd *cobra.Command, args []string) error {
+	pbfFile := args[0]
+	header, err := osm.ReadPBFHeader(pbfFile)
+	if err != nil {
+		return err
+	}
+	printHeader(os.Stdout, header)
+
+	if !viper.GetBool("extended") {
+		return nil
+	}
+	scanner := osm.NewPBFFileInfo(osm.DefaultPBFParserParams{PBFFile: pbfFile})
+	if err := scanner.Run(); err != nil {
+		return err
+	}
+	printFileInfo(os.Stdout, scanner.Info)
+	return nil
+}
+
+func printHeader(w io.Writer, h *pbf.Header) {
+	fmt.Fprintln(w, "Header:")
+	if h.BBox != nil {
+		fmt.Fprintf(w, "  Bounding box: %v\n", *h.BBox)
+	}
+	fmt.Fprintf(w, "  Required features: %s\n", strings.Join(h.RequiredFeatures, " "))
+	fmt.Fprintf(w, "  Optional features: %s\n", strings.Join(h.OptionalFeatures, " "))
+	fmt.Fprintf(w, "  Writing program: %s\n", h.WritingProgram)
+	if h.Source != "" {
+		fmt.Fprintf(w, "  Source: %s\n", h.Source)
+	}
+	if !h.ReplicationTimestamp.IsZero() {
+		fmt.Fprintf(w, "  Replication timestamp: %s\n", h.ReplicationTimestamp.Format(time.RFC3339))
+	}
+	if h.ReplicationSequenceNumber != 0 {
+		fmt.Fprintf(w, "  Replication sequence number: %d\n", h.ReplicationSequenceNumber)
+	}
+	if h.ReplicationBaseURL != "" {
+		fmt.Fprintf(w, "  Replication base URL: %s\n", h.ReplicationBaseURL)
+	}
+}
+
+func printFileInfo(w io.Writer, info osm.FileInfo) {
+	fmt.Fprintln(w, "Data:")
+	fmt.Fprintf(w, "  Nodes: %d (ids %d - %d)\n", info.Nodes, info.NodeIDs.Min, info.NodeIDs.Max)
+	fmt.Fprintf(w, "  Ways: %d (ids %d - %d)\n", info.Ways, info.WayIDs.Min, info.WayIDs.Max)
+	fmt.Fprintf(w, "  Relations: %d (ids %d - %d)\n", info.Relations, info.RelationIDs.Min, info.RelationIDs.Max)
+	fmt.Fprintf(w, "  Sorted (%s): %v\n", pbf.FeatureSortTypeThenID, info.Sorted)
+}
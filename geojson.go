@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/paulmach/go.geojson"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+var geojsonCmd = &cobra.Command{
+	Use:   "geojson [pbf file|-]...",
+	Short: "Convert pbf files, read as one dataset, to a GeoJSON FeatureCollection, \"-\" reads stdin.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runGeoJSON,
+}
+
+func init() {
+	geojsonCmd.Flags().StringP("output", "o", "", "Output file (default stdout).")
+	geojsonCmd.Flags().Bool("updatable_cache", false, "Keep every element in the cache, for apply-changes.")
+	geojsonCmd.Flags().String("renumber", "", "Renumber ids from 1 before parsing, writing the id mapping csv to this file.")
+	addCacheFlags(geojsonCmd)
+	addBoundaryFlags(geojsonCmd)
+	addGeoJSONFlags(geojsonCmd)
+}
+
+func runGeoJSON(cmd *cobra.Command, args []string) error {
+	source, closeSource, err := openSources(args)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	if mappingFile := viper.GetString("renumber"); mappingFile != "" {
+		renumbered, removeRenumbered, err := renumberSource(source, mappingFile)
+		if err != nil {
+			return err
+		}
+		defer removeRenumbered()
+		source = renumbered
+	}
+
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	for _, err := range []error{
+		provideIndexers(c),
+		c.Provide(
+			func() bool { return viper.GetBool("updatable_cache") },
+			dig.Name("updatableCache"),
+		),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return writeGeoJSON(c)
+}
+
+// writeGeoJSON runs a PBFParser with the indexers of c, writing its
+// features to --output.
+func writeGeoJSON(c *dig.Container) error {
+	return writeElements(c, writeFeatureCollection)
+}
+
+// writeElements runs a PBFParser with the indexers of c, write writes
+// its elements to --output.
+func writeElements(c *dig.Container, write func(w io.Writer, emts <-chan element.Element) error) error {
+	out, closeOutput, err := createOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	outputElementChan := make(chan element.Element)
+	for _, err := range []error{
+		c.Provide(
+			func() chan element.Element { return outputElementChan },
+			dig.Name("outputElementChan"),
+		),
+		c.Provide(osm.NewPBFParser),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Invoke(func(parser osm.PBFDataParser) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- write(out, outputElementChan)
+		}()
+		if err := parser.Run(); err != nil {
+			return err
+		}
+		return <-done
+	})
+}
+
+// createOutput returns the --output file, or stdout.
+// Call close once done.
+func createOutput() (w io.Writer, close func(), err error) {
+	output := viper.GetString("output")
+	if output == "" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// addGeoJSONFlags adds the flags of commands writing GeoJSON.
+func addGeoJSONFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("rfc7946", false, "Strict RFC 7946 output: ring winding, rounded coordinates, antimeridian splits, no degenerate geometries.")
+	cmd.Flags().Int("precision", 7, "Coordinate decimals with --rfc7946, -1 keeps them all.")
+	cmd.Flags().Bool("bbox", false, "Add a bbox to features, with --rfc7946.")
+	cmd.Flags().Bool("validate", false, "Check features for OGC validity errors, logging invalid ones.")
+	cmd.Flags().Bool("repair", false, "Repair invalid features, logging those left invalid.")
+	cmd.Flags().String("rejects", "", "Append invalid features to this file, one per line with the reason, instead of the output.")
+	cmd.Flags().String("label_points", "", "Add the centroid and label point of ways and relations: properties (centroid_lon, centroid_lat, label_lon, label_lat) or geometry (centroid and label_point Point properties).")
+	cmd.Flags().Bool("measures", false, "Add geodesic length_m of lines, area_m2 and perimeter_m of polygons, and a bbox to features.")
+	addSimplifyFlags(cmd)
+	addSchemaFlags(cmd)
+	addCheck(cmd, func() error {
+		_, err := newLabelPoints()
+		return err
+	})
+}
+
+// addCheck makes cmd check its options before the parse, not after.
+func addCheck(cmd *cobra.Command, check func() error) {
+	previous := cmd.PreRunE
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := check(); err != nil {
+			return err
+		}
+		if previous != nil {
+			return previous(cmd, args)
+		}
+		return nil
+	}
+}
+
+// addSimplifyFlags adds the flags of newSimplifier.
+func addSimplifyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("simplify", "", "Simplify features: dp (Douglas-Peucker) or vw (Visvalingam).")
+	cmd.Flags().String("tolerance", "10m", "Simplification tolerance, meters (10m) or degrees (0.0001deg).")
+	cmd.Flags().StringSlice("tolerance_class", nil, "Tolerance of features tagged so, ex natural=coastline:50m or building:1m, repeatable, first match wins.")
+	addCheck(cmd, func() error {
+		_, err := newSimplifier()
+		return err
+	})
+}
+
+// addSchemaFlags adds the flags of newSchema.
+func addSchemaFlags(cmd *cobra.Command) {
+	cmd.Flags().String("properties", element.FlatLayout, "Property layout: flat (tags next to osmid and osmType), nested (tags in a tags object) or prefixed (tags next to @id, @type and other @ properties).")
+	cmd.Flags().String("id_format", element.SlashID, "Feature ids: slash (node/1), short (n1) or numeric (osm2pgsql style, negative for relations).")
+	cmd.Flags().Bool("typed_values", false, "Write numeric tag values as numbers.")
+	addCheck(cmd, func() error {
+		_, err := newSchema()
+		return err
+	})
+}
+
+// newSchema returns the --properties, --id_format and --typed_values
+// layout, nil for the flat one the converters write.
+func newSchema() (*element.Schema, error) {
+	s := &element.Schema{
+		Layout:      viper.GetString("properties"),
+		IDFormat:    viper.GetString("id_format"),
+		TypedValues: viper.GetBool("typed_values"),
+	}
+	switch s.Layout {
+	case element.FlatLayout, element.NestedLayout, element.PrefixedLayout:
+	default:
+		return nil, fmt.Errorf("invalid --properties %q, want flat, nested or prefixed", s.Layout)
+	}
+	switch s.IDFormat {
+	case element.SlashID, element.ShortID, element.NumericID:
+	default:
+		return nil, fmt.Errorf("invalid --id_format %q, want slash, short or numeric", s.IDFormat)
+	}
+	if *s == (element.Schema{Layout: element.FlatLayout, IDFormat: element.SlashID}) {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// newSimplifier returns the --simplify step, nil without it.
+func newSimplifier() (*element.Simplifier, error) {
+	algorithm := viper.GetString("simplify")
+	switch algorithm {
+	case "":
+		return nil, nil
+	case element.DouglasPeucker, element.Visvalingam:
+	default:
+		return nil, fmt.Errorf("invalid --simplify %q, want dp or vw", algorithm)
+	}
+	tolerance, err := element.ParseTolerance(viper.GetString("tolerance"))
+	if err != nil {
+		return nil, err
+	}
+	s := &element.Simplifier{Algorithm: algorithm, Tolerance: tolerance}
+	for _, class := range viper.GetStringSlice("tolerance_class") {
+		c, err := element.ParseSimplifyClass(class)
+		if err != nil {
+			return nil, err
+		}
+		s.Classes = append(s.Classes, c)
+	}
+	return s, nil
+}
+
+// writeFeatureCollection streams elements as one FeatureCollection.
+// It drains emts even after a write error.
+func writeFeatureCollection(w io.Writer, emts <-chan element.Element) error {
+	var strict *element.RFC7946
+	if viper.GetBool("rfc7946") {
+		strict = &element.RFC7946{Precision: viper.GetInt("precision"), BBox: viper.GetBool("bbox")}
+	}
+	simplifier, err := newSimplifier()
+	var labels *labelPoints
+	if err == nil {
+		labels, err = newLabelPoints()
+	}
+	var schema *element.Schema
+	if err == nil {
+		schema, err = newSchema()
+	}
+	var checks *featureChecks
+	closeChecks := func() {}
+	if err == nil {
+		checks, closeChecks, err = newFeatureChecks()
+	}
+	if checks != nil {
+		checks.schema = schema
+	}
+	if labels != nil {
+		labels.strict = strict
+	}
+	if err != nil {
+		for range emts {
+		}
+		return err
+	}
+	defer closeChecks()
+	bw := bufio.NewWriter(w)
+	write := func(b []byte) {
+		if err == nil {
+			_, err = bw.Write(b)
+		}
+	}
+	write([]byte(`{"type":"FeatureCollection","features":[`))
+	measures := viper.GetBool("measures")
+	first := true
+	for emt := range emts {
+		f := elementToFeature(&emt)
+		if f != nil && checks != nil && err == nil {
+			f, err = checks.check(f, &emt)
+		}
+		if f != nil && labels != nil {
+			labels.add(f, &emt)
+		}
+		if f != nil && measures {
+			measure(f, strict)
+		}
+		if f != nil && simplifier != nil {
+			f = simplifier.Feature(f)
+		}
+		if f != nil && strict != nil {
+			f = strict.Feature(f)
+		}
+		if f != nil && schema != nil {
+			f = schema.Feature(f, &emt)
+		}
+		if f == nil || err != nil {
+			continue
+		}
+		b, merr := json.Marshal(f)
+		if merr != nil {
+			err = merr
+			continue
+		}
+		if !first {
+			write([]byte(","))
+		}
+		first = false
+		write(b)
+	}
+	write([]byte("]}\n"))
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// labelPoints is the --label_points step, on the full geometry before
+// simplification.
+type labelPoints struct {
+	geometry bool
+	// strict, if any, rounds the points like the --rfc7946 coordinates.
+	strict *element.RFC7946
+}
+
+// newLabelPoints returns nil without --label_points.
+func newLabelPoints() (*labelPoints, error) {
+	switch mode := viper.GetString("label_points"); mode {
+	case "":
+		return nil, nil
+	case "properties":
+		return &labelPoints{}, nil
+	case "geometry":
+		return &labelPoints{geometry: true}, nil
+	default:
+		return nil, fmt.Errorf("invalid --label_points %q, want properties or geometry", mode)
+	}
+}
+
+// add sets the centroid and label point of f, the feature of way or
+// relation e. The label point of a relation is its label, else
+// admin_centre, member node if any.
+func (l *labelPoints) add(f *geojson.Feature, e *element.Element) {
+	if e.Type != "Way" && e.Type != "Relation" || f.Geometry == nil {
+		return
+	}
+	centroid := element.Centroid(f.Geometry)
+	label := element.MemberLabel(e)
+	if label == nil {
+		label = element.LabelPoint(f.Geometry)
+	}
+	if centroid == nil || label == nil {
+		return
+	}
+	if l.strict != nil {
+		centroid = []float64{l.strict.Round(centroid[0]), l.strict.Round(centroid[1])}
+		label = []float64{l.strict.Round(label[0]), l.strict.Round(label[1])}
+	}
+	if l.geometry {
+		f.SetProperty("centroid", geojson.NewPointGeometry(centroid))
+		f.SetProperty("label_point", geojson.NewPointGeometry(label))
+		return
+	}
+	f.SetProperty("centroid_lon", centroid[0])
+	f.SetProperty("centroid_lat", centroid[1])
+	f.SetProperty("label_lon", label[0])
+	f.SetProperty("label_lat", label[1])
+}
+
+// measure is the --measures step, on the full geometry before
+// simplification. Lengths and areas are rounded to the centimeter, the
+// bbox like the coordinates with strict.
+func measure(f *geojson.Feature, strict *element.RFC7946) {
+	if f.Geometry == nil {
+		return
+	}
+	m := element.Measure(f.Geometry)
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	switch f.Geometry.Type {
+	case geojson.GeometryLineString, geojson.GeometryMultiLineString:
+		f.SetProperty("length_m", round(m.Length))
+	case geojson.GeometryPolygon, geojson.GeometryMultiPolygon:
+		f.SetProperty("area_m2", round(m.Area))
+		f.SetProperty("perimeter_m", round(m.Perimeter))
+	case geojson.GeometryCollection:
+		f.SetProperty("length_m", round(m.Length))
+		f.SetProperty("area_m2", round(m.Area))
+		f.SetProperty("perimeter_m", round(m.Perimeter))
+	}
+	f.BoundingBox = m.BBox
+	if strict != nil {
+		for i, v := range f.BoundingBox {
+			f.BoundingBox[i] = strict.Round(v)
+		}
+	}
+}
+
+// featureChecks is the --validate and --repair step after conversion,
+// invalid features go to the rejects file if any.
+type featureChecks struct {
+	repair  bool
+	rejects *bufio.Writer
+	// schema, if any, lays out rejected features as the output.
+	schema *element.Schema
+}
+
+// newFeatureChecks returns nil without --validate or --repair.
+// Call close once done.
+func newFeatureChecks() (c *featureChecks, close func(), err error) {
+	if !viper.GetBool("validate") && !viper.GetBool("repair") {
+		return nil, func() {}, nil
+	}
+	c = &featureChecks{repair: viper.GetBool("repair")}
+	rejects := viper.GetString("rejects")
+	if rejects == "" {
+		return c, func() {}, nil
+	}
+	// Appended, replicate and history write several collections.
+	f, err := os.OpenFile(rejects, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.rejects = bufio.NewWriter(f)
+	return c, func() {
+		c.rejects.Flush()
+		f.Close()
+	}, nil
+}
+
+// check returns f, the feature of e, repaired with --repair, or nil if
+// it's rejected.
+func (c *featureChecks) check(f *geojson.Feature, e *element.Element) (*geojson.Feature, error) {
+	if f.Geometry == nil {
+		return f, nil
+	}
+	verr := element.Validate(f.Geometry)
+	if verr == nil {
+		return f, nil
+	}
+	if c.repair {
+		if g := element.Repair(f.Geometry); g != nil && element.Validate(g) == nil {
+			f.Geometry = g
+			return f, nil
+		}
+	}
+	if c.rejects == nil {
+		logrus.Warningf("Invalid %v: %v", f.ID, verr)
+		if c.repair {
+			return nil, nil
+		}
+		return f, nil
+	}
+	f.SetProperty("invalid_reason", verr.Reason)
+	f.SetProperty("invalid_location", verr.Location)
+	if c.schema != nil {
+		f = c.schema.Feature(f, e)
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.rejects.Write(append(b, '\n'))
+	return nil, err
+}
+
+func elementToFeature(e *element.Element) *geojson.Feature {
+	var f *geojson.Feature
+	switch {
+	case e.Action == "delete":
+		// Deleted features have no geometry left.
+		osmID := element.OSMID(strings.ToLower(e.Type), e.GetID())
+		f = geojson.NewFeature(nil)
+		f.ID = osmID
+		f.SetProperty("osmid", osmID)
+	case e.Type == "Node":
+		f = element.NodeElementToFeature(e)
+	case e.Type == "Way":
+		f = element.WayElementToFeature(e)
+	case e.Type == "Relation":
+		f = element.RelationElementToFeature(e)
+	default:
+		return nil
+	}
+	if e.Action != "" {
+		f.SetProperty("action", e.Action)
+	}
+	return f
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"strings"
+)
+
+var getidCmd = &cobra.Command{
+	Use:   "getid [input file|-] [id]...",
+	Short: "Write elements by id, ex r123 w456 n789, as GeoJSON, OSM XML or pbf following the output file name.",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runGetID,
+}
+
+func init() {
+	addPBFWriterFlags(getidCmd)
+	getidCmd.Flags().Lookup("output").Usage = "Output file, OSM XML if named .osm or .osm.gz, pbf if named .pbf, or GeoJSON if named .geojson (default stdout as GeoJSON)."
+	getidCmd.Flags().BoolP("add_referenced", "r", false, "Also write the members and nodes the elements need, recursively. GeoJSON always resolves them.")
+	addCacheFlags(getidCmd)
+	addGeoJSONFlags(getidCmd)
+}
+
+func runGetID(cmd *cobra.Command, args []string) error {
+	refs := make([]osm.ElementRef, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		ref, err := osm.ParseElementRef(arg)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	output := viper.GetString("output")
+	geoJSON := output == "" || strings.HasSuffix(output, ".geojson") || strings.HasSuffix(output, ".json")
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	for _, err := range []error{
+		c.Provide(func() []osm.ElementRef { return refs }, dig.Name("elementRefs")),
+		c.Provide(
+			// Geometries need the members.
+			func() bool { return geoJSON || viper.GetBool("add_referenced") },
+			dig.Name("addReferenced"),
+		),
+		c.Provide(osm.NewIDIndexer, dig.Name("pbfIndexer")),
+		c.Provide(osm.NewPBFRelationMemberIndexer, dig.Name("pbfRelationMemberIndexer")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	if geoJSON {
+		return writeGeoJSON(c)
+	}
+	if err := c.Provide(osm.NewPBFExtractWriter); err != nil {
+		return err
+	}
+	return c.Invoke(func(writer osm.PBFDataParser) error {
+		return writer.Run()
+	})
+}
@@ -5,16 +5,20 @@ go 1.12
 require (
 	github.com/benbjohnson/clock v1.0.0 // indirect
 	github.com/gogo/protobuf v1.3.1 // indirect
+	github.com/klauspost/compress v1.11.13
 	github.com/onrik/logrus v0.4.1
 	github.com/paulmach/go.geojson v1.4.0
+	github.com/pierrec/lz4/v4 v4.1.2
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.5.0
 	github.com/syndtr/goleveldb v1.0.0
 	github.com/thomersch/gosmparse v0.0.0-20190428115224-6be706b995b9
 	github.com/tmthrgd/go-popcount v0.0.0-20190904054823-afb1ace8b04f
+	github.com/ulikunitz/xz v0.5.10
 	go.uber.org/dig v1.8.0
 	golang.org/x/sys v0.0.0-20191204072324-ce4227a45e2e // indirect
 	golang.org/x/text v0.3.2 // indirect
 	golang.org/x/tools v0.0.0-20191205225056-3393d29bb9fe // indirect
+	gopkg.in/yaml.v2 v2.2.4
 )
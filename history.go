@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [history file|-]",
+	Short: "Convert the snapshots of a full-history file at some times to GeoJSON.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runHistory,
+}
+
+func init() {
+	historyCmd.Flags().StringSlice("at", nil, "Snapshot times, RFC 3339 or 2006-01-02, repeatable.")
+	historyCmd.Flags().String("from", "", "First snapshot time of a range.")
+	historyCmd.Flags().String("to", "", "Last snapshot time of a range (default now).")
+	historyCmd.Flags().String("every", "1y", "Range step: years (1y), months (6m) or days (30d).")
+	historyCmd.Flags().StringP("output", "o", "", "Output file, directory with one <time>.geojson per snapshot if several (default stdout).")
+	addCacheFlags(historyCmd)
+	addGeoJSONFlags(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	times, err := snapshotTimes()
+	if err != nil {
+		return err
+	}
+	output := viper.GetString("output")
+	if len(times) > 1 && output == "" {
+		return errors.New("several snapshots need an --output directory")
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	for _, t := range times {
+		stamp := t.UTC().Format("2006-01-02T150405Z")
+		path := output
+		if len(times) > 1 {
+			if err := os.MkdirAll(output, 0755); err != nil {
+				return err
+			}
+			path = filepath.Join(output, stamp+".geojson")
+		}
+		// A fresh cache, the previous snapshot may have other elements.
+		levelDBPath := filepath.Join(viper.GetString("level_db_path"), "history-"+stamp)
+		err := writeSnapshot(osm.NewHistorySource(source, t), levelDBPath, path)
+		os.RemoveAll(levelDBPath)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Wrote snapshot %s", t.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// writeSnapshot runs PBFParser on a snapshot, path "" is stdout.
+func writeSnapshot(source osm.Source, levelDBPath string, path string) error {
+	var out io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	c, err := newContainerWithCache(source, levelDBPath)
+	if err != nil {
+		return err
+	}
+	outputElementChan := make(chan element.Element)
+	for _, err := range []error{
+		provideIndexers(c),
+		c.Provide(
+			func() chan element.Element { return outputElementChan },
+			dig.Name("outputElementChan"),
+		),
+		c.Provide(osm.NewPBFParser),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return c.Invoke(func(parser osm.PBFDataParser) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- writeFeatureCollection(out, outputElementChan)
+		}()
+		if err := parser.Run(); err != nil {
+			return err
+		}
+		return <-done
+	})
+}
+
+// snapshotTimes returns the --at times, then the --from --to range.
+func snapshotTimes() ([]time.Time, error) {
+	var times []time.Time
+	for _, at := range viper.GetStringSlice("at") {
+		t, err := parseTime(at)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	if from := viper.GetString("from"); from != "" {
+		start, err := parseTime(from)
+		if err != nil {
+			return nil, err
+		}
+		end := time.Now().UTC()
+		if to := viper.GetString("to"); to != "" {
+			if end, err = parseTime(to); err != nil {
+				return nil, err
+			}
+		}
+		years, months, days, err := parseStep(viper.GetString("every"))
+		if err != nil {
+			return nil, err
+		}
+		for t := start; !t.After(end); t = t.AddDate(years, months, days) {
+			times = append(times, t)
+		}
+	}
+	if len(times) == 0 {
+		return nil, errors.New("missing --at or --from")
+	}
+	return times, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// parseStep parses 1y, 6m or 30d.
+func parseStep(s string) (years, months, days int, err error) {
+	if len(s) < 2 {
+		return 0, 0, 0, fmt.Errorf("invalid step %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid step %q", s)
+	}
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "y":
+		return n, 0, 0, nil
+	case "m":
+		return 0, n, 0, nil
+	case "d":
+		return 0, 0, n, nil
+	}
+	return 0, 0, 0, fmt.Errorf("invalid step %q", s)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var layersCmd = &cobra.Command{
+	Use:   "layers [pbf file|-]...",
+	Short: "Convert pbf files to a GeoJSON file per layer of a YAML tag mapping.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runLayers,
+}
+
+func init() {
+	layersCmd.Flags().String("mapping", "", "YAML mapping of elements to layers, see the README.")
+	layersCmd.Flags().String("output_dir", ".", "Directory of the <layer>.geojson files.")
+	addCacheFlags(layersCmd)
+	addBoundaryFlags(layersCmd)
+	addCheck(layersCmd, func() error {
+		_, err := loadMapping()
+		return err
+	})
+}
+
+func runLayers(cmd *cobra.Command, args []string) error {
+	source, closeSource, err := openSources(args)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	if err := provideIndexers(c); err != nil {
+		return err
+	}
+	return writeElements(c, writeLayers)
+}
+
+// loadMapping reads the --mapping file.
+func loadMapping() (*element.Mapping, error) {
+	path := viper.GetString("mapping")
+	if path == "" {
+		return nil, fmt.Errorf("--mapping is required")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := element.ParseMapping(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// layerWriter streams the FeatureCollection of a layer.
+type layerWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	first bool
+}
+
+func (l *layerWriter) write(b []byte) error {
+	if !l.first {
+		if err := l.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	l.first = false
+	_, err := l.w.Write(b)
+	return err
+}
+
+// writeLayers writes elements to the files of their mapping layers in
+// --output_dir, w is unused. It drains emts even after a write error.
+func writeLayers(w io.Writer, emts <-chan element.Element) error {
+	m, err := loadMapping()
+	writers := map[string]*layerWriter{}
+	defer func() {
+		for _, l := range writers {
+			l.f.Close()
+		}
+	}()
+	if err == nil {
+		err = os.MkdirAll(viper.GetString("output_dir"), 0755)
+	}
+	if err == nil {
+		for _, name := range m.LayerNames() {
+			f, cerr := os.Create(filepath.Join(viper.GetString("output_dir"), name+".geojson"))
+			if cerr != nil {
+				err = cerr
+				break
+			}
+			l := &layerWriter{f: f, w: bufio.NewWriter(f), first: true}
+			writers[name] = l
+			if _, err = l.w.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+				break
+			}
+		}
+	}
+	for emt := range emts {
+		if err != nil {
+			continue
+		}
+		for _, lf := range m.Map(&emt) {
+			b, merr := json.Marshal(lf.Feature)
+			if merr == nil {
+				merr = writers[lf.Layer].write(b)
+			}
+			if merr != nil {
+				err = merr
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, l := range writers {
+		if _, err := l.w.WriteString("]}\n"); err != nil {
+			return err
+		}
+		if err := l.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -33,7 +33,7 @@ var (
 
 // InitAll init viper & logrus.
 func InitAll(cmd *cobra.Command, args []string) error {
-	fmt.Println("InitAll")
+	fmt.Fprintln(os.Stderr, "InitAll")
 	if err := InitViper(cmd, args); err != nil {
 		return err
 	}
@@ -141,14 +141,29 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&logLevel, "log_level", "debug", fmt.Sprintf("Log Level (default is %s)", "DEBUG"))
 
 	// Add cmd
+	RootCmd.AddCommand(fileinfoCmd)
+	RootCmd.AddCommand(addLocationsToWaysCmd)
+	RootCmd.AddCommand(geojsonCmd)
+	RootCmd.AddCommand(catCmd)
+	RootCmd.AddCommand(extractCmd)
+	RootCmd.AddCommand(applyChangesCmd)
+	RootCmd.AddCommand(replicateCmd)
+	RootCmd.AddCommand(diffCmd)
+	RootCmd.AddCommand(historyCmd)
+	RootCmd.AddCommand(sortCmd)
+	RootCmd.AddCommand(renumberCmd)
+	RootCmd.AddCommand(getidCmd)
+	RootCmd.AddCommand(topojsonCmd)
+	RootCmd.AddCommand(layersCmd)
 }
 
 func main() {
 	// Prefix print.
 	// fmt.Println(logo)
-	fmt.Println("Version: ", version)
-	fmt.Println("BuildTime: ", buildTime)
-	fmt.Println()
+	// Stderr, stdout may carry data, ex geojson -.
+	fmt.Fprintln(os.Stderr, "Version: ", version)
+	fmt.Fprintln(os.Stderr, "BuildTime: ", buildTime)
+	fmt.Fprintln(os.Stderr)
 	if err := RootCmd.Execute(); err != nil {
 		logrus.Error(err)
 		os.Exit(1)
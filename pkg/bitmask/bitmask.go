@@ -6,25 +6,53 @@ import "sync"
 import "github.com/tmthrgd/go-popcount"
 
 // Bitmask - simple bitmask data structire based on a map
+// Negative ids, ex unsaved JOSM elements, are kept in N so they stay dense:
+// -1 is bit 0 of N.
 type Bitmask struct {
 	I     map[uint64]uint64
+	N     map[uint64]uint64
 	mutex *sync.RWMutex
 }
 
 // Has - basic get/set methods
 func (b *Bitmask) Has(val int64) bool {
-	var v = uint64(val)
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
-	return (b.I[v/64] & (1 << (v % 64))) != 0
+	m, v := b.I, uint64(val)
+	if val < 0 {
+		m, v = b.N, uint64(^val)
+	}
+	return (m[v/64] & (1 << (v % 64))) != 0
 }
 
 // Insert - basic get/set methods
 func (b *Bitmask) Insert(val int64) {
-	var v = uint64(val)
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	b.I[v/64] |= (1 << (v % 64))
+	m, v := b.I, uint64(val)
+	if val < 0 {
+		// Masks saved before N existed decode without it.
+		if b.N == nil {
+			b.N = make(map[uint64]uint64)
+		}
+		m, v = b.N, uint64(^val)
+	}
+	m[v/64] |= (1 << (v % 64))
+}
+
+// Remove - basic get/set methods
+func (b *Bitmask) Remove(val int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	m, v := b.I, uint64(val)
+	if val < 0 {
+		m, v = b.N, uint64(^val)
+	}
+	if w := m[v/64] &^ (1 << (v % 64)); w != 0 {
+		m[v/64] = w
+	} else {
+		delete(m, v/64)
+	}
 }
 
 // Len - total elements in mask (non performant!)
@@ -35,6 +63,9 @@ func (b *Bitmask) Len() uint64 {
 	for _, v := range b.I {
 		l += popcount.CountSlice64([]uint64{v})
 	}
+	for _, v := range b.N {
+		l += popcount.CountSlice64([]uint64{v})
+	}
 	return l
 }
 
@@ -42,13 +73,14 @@ func (b *Bitmask) Len() uint64 {
 func (b *Bitmask) Empty() bool {
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
-	return len(b.I) == 0
+	return len(b.I) == 0 && len(b.N) == 0
 }
 
 // NewBitMask - constructor
 func NewBitMask() *Bitmask {
 	return &Bitmask{
 		I:     make(map[uint64]uint64),
+		N:     make(map[uint64]uint64),
 		mutex: &sync.RWMutex{},
 	}
 }
@@ -0,0 +1,52 @@
+package bitmask
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitmaskNegative(t *testing.T) {
+	b := NewBitMask()
+	for _, id := range []int64{-1, -64, -65, 1, 63} {
+		b.Insert(id)
+	}
+	for _, id := range []int64{-1, -64, -65, 1, 63} {
+		if !b.Has(id) {
+			t.Errorf("missing %d", id)
+		}
+	}
+	for _, id := range []int64{0, -2, 2, 64, -63} {
+		if b.Has(id) {
+			t.Errorf("unexpected %d", id)
+		}
+	}
+	if b.Len() != 5 {
+		t.Errorf("len %d, want 5", b.Len())
+	}
+	// Small negative ids stay in the first buckets.
+	if len(b.N) != 2 || b.N[0] == 0 || b.N[1] == 0 {
+		t.Errorf("negative buckets %v", b.N)
+	}
+	b.Remove(-65)
+	b.Remove(1)
+	if b.Has(-65) || b.Has(1) || !b.Has(-64) || b.Len() != 3 {
+		t.Errorf("remove failed, len %d", b.Len())
+	}
+}
+
+func TestPBFMasksNegativeRoundTrip(t *testing.T) {
+	m := NewPBFMasks()
+	m.Nodes.Insert(-5)
+	m.Nodes.Insert(5)
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read := NewPBFMasks()
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !read.Nodes.Has(-5) || !read.Nodes.Has(5) || read.Nodes.Has(-4) {
+		t.Errorf("masks not read back: %v %v", read.Nodes.I, read.Nodes.N)
+	}
+}
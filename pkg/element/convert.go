@@ -16,12 +16,31 @@ func ByteToElement(byteArr []byte) (Element, error) {
 	return element, err
 }
 
+// OSMID is the osmid property of an element, ex "node/123". Ids of
+// unsaved elements keep their sign, ex "node/-5".
+func OSMID(osmType string, id int64) string {
+	return osmType + "/" + strconv.FormatInt(id, 10)
+}
+
+// elementFeature converts e by its type, nil if it has none.
+func elementFeature(e *Element) *geojson.Feature {
+	switch e.Type {
+	case "Node":
+		return NodeElementToFeature(e)
+	case "Way":
+		return WayElementToFeature(e)
+	case "Relation":
+		return RelationElementToFeature(e)
+	}
+	return nil
+}
+
 func NodeElementToFeature(e *Element) *geojson.Feature {
 	f := geojson.NewPointFeature(
 		[]float64{e.Node.Lon, e.Node.Lat},
 	)
 
-	nodeID := "node" + "/" + strconv.FormatInt(e.Node.ID, 10)
+	nodeID := OSMID("node", e.Node.ID)
 	f.ID = nodeID
 	f.SetProperty("osmid", nodeID)
 	f.SetProperty("osmType", "node")
@@ -56,7 +75,7 @@ func WayElementToFeature(e *Element) *geojson.Feature {
 		f = geojson.NewLineStringFeature(latLngs)
 	}
 
-	wayID := "way" + "/" + strconv.FormatInt(e.Way.ID, 10)
+	wayID := OSMID("way", e.Way.ID)
 	f.ID = wayID
 	f.SetProperty("osmid", wayID)
 	f.SetProperty("osmType", "way")
@@ -218,7 +237,7 @@ func RelationElementToFeature(e *Element) *geojson.Feature {
 		f = geojson.NewCollectionFeature(geometries...)
 	}
 	// Add tag to property.
-	relID := "relation" + "/" + strconv.FormatInt(e.Relation.ID, 10)
+	relID := OSMID("relation", e.Relation.ID)
 	f.ID = relID
 	f.SetProperty("osmid", relID)
 	f.SetProperty("osmType", "relation")
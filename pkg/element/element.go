@@ -15,6 +15,8 @@ type Element struct {
 	Role     string
 	Relation gosmparse.Relation
 	Elements []Element
+	// Action is create, modify or delete for changed elements.
+	Action string
 }
 
 func (e *Element) GetID() int64 {
@@ -0,0 +1,293 @@
+package element
+
+import (
+	"container/heap"
+	"github.com/paulmach/go.geojson"
+	"math"
+)
+
+// parts are the positions of a geometry by dimension, collections
+// flattened.
+type parts struct {
+	polygons [][][][]float64
+	lines    [][][]float64
+	points   [][]float64
+}
+
+func geometryParts(g *geojson.Geometry) parts {
+	var p parts
+	var collect func(g *geojson.Geometry)
+	collect = func(g *geojson.Geometry) {
+		switch g.Type {
+		case geojson.GeometryPoint:
+			p.points = append(p.points, g.Point)
+		case geojson.GeometryMultiPoint:
+			p.points = append(p.points, g.MultiPoint...)
+		case geojson.GeometryLineString:
+			p.lines = append(p.lines, g.LineString)
+		case geojson.GeometryMultiLineString:
+			p.lines = append(p.lines, g.MultiLineString...)
+		case geojson.GeometryPolygon:
+			p.polygons = append(p.polygons, g.Polygon)
+		case geojson.GeometryMultiPolygon:
+			p.polygons = append(p.polygons, g.MultiPolygon...)
+		case geojson.GeometryCollection:
+			for _, child := range g.Geometries {
+				collect(child)
+			}
+		}
+	}
+	collect(g)
+	return p
+}
+
+// Centroid is the center of mass of g: of its area if it has polygons,
+// else of its lines, else the mean of its points. It may be outside g, ex
+// for C shaped areas, see LabelPoint. nil if g is empty.
+func Centroid(g *geojson.Geometry) []float64 {
+	p := geometryParts(g)
+
+	// Relative to a position of g, to keep float precision.
+	var origin []float64
+	switch {
+	case len(p.polygons) > 0 && len(p.polygons[0]) > 0 && len(p.polygons[0][0]) > 0:
+		origin = p.polygons[0][0][0]
+	case len(p.lines) > 0 && len(p.lines[0]) > 0:
+		origin = p.lines[0][0]
+	case len(p.points) > 0:
+		origin = p.points[0]
+	default:
+		return nil
+	}
+
+	var x, y, total float64
+	for _, polygon := range p.polygons {
+		for i, ring := range polygon {
+			var a, cx, cy float64
+			for j := 0; j+1 < len(ring); j++ {
+				x0, y0 := ring[j][0]-origin[0], ring[j][1]-origin[1]
+				x1, y1 := ring[j+1][0]-origin[0], ring[j+1][1]-origin[1]
+				f := x0*y1 - x1*y0
+				a += f
+				cx += (x0 + x1) * f
+				cy += (y0 + y1) * f
+			}
+			if a == 0 {
+				continue
+			}
+			// Holes count against, whatever their winding.
+			w := math.Abs(a / 2)
+			if i > 0 {
+				w = -w
+			}
+			x += w * cx / (3 * a)
+			y += w * cy / (3 * a)
+			total += w
+		}
+	}
+	if total != 0 {
+		return []float64{origin[0] + x/total, origin[1] + y/total}
+	}
+
+	lines := p.lines
+	for _, polygon := range p.polygons {
+		lines = append(lines, polygon...)
+	}
+	for _, line := range lines {
+		for j := 0; j+1 < len(line); j++ {
+			l := math.Hypot(line[j+1][0]-line[j][0], line[j+1][1]-line[j][1])
+			x += l * ((line[j][0]+line[j+1][0])/2 - origin[0])
+			y += l * ((line[j][1]+line[j+1][1])/2 - origin[1])
+			total += l
+		}
+	}
+	if total != 0 {
+		return []float64{origin[0] + x/total, origin[1] + y/total}
+	}
+
+	points := p.points
+	for _, line := range lines {
+		points = append(points, line...)
+	}
+	for _, q := range points {
+		x += q[0] - origin[0]
+		y += q[1] - origin[1]
+	}
+	n := float64(len(points))
+	return []float64{origin[0] + x/n, origin[1] + y/n}
+}
+
+// LabelPoint is a point of g to put its label at: the pole of
+// inaccessibility of its largest polygon, the point inside farthest from
+// its edges, else the middle of its longest line, else its first point.
+// nil if g is empty.
+func LabelPoint(g *geojson.Geometry) []float64 {
+	p := geometryParts(g)
+	var largest [][][]float64
+	largestArea := 0.0
+	for _, polygon := range p.polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		if area := math.Abs(ringArea(polygon[0])); area > largestArea {
+			largest, largestArea = polygon, area
+		}
+	}
+	if largest != nil {
+		return polylabel(largest)
+	}
+
+	var longest [][]float64
+	longestLength := -1.0
+	for _, line := range p.lines {
+		if l := lineLength(line); len(line) > 0 && l > longestLength {
+			longest, longestLength = line, l
+		}
+	}
+	if longest != nil {
+		half := longestLength / 2
+		for j := 0; j+1 < len(longest); j++ {
+			a, b := longest[j], longest[j+1]
+			l := math.Hypot(b[0]-a[0], b[1]-a[1])
+			if l > 0 && half <= l {
+				return []float64{a[0] + (b[0]-a[0])*half/l, a[1] + (b[1]-a[1])*half/l}
+			}
+			half -= l
+		}
+		return longest[0]
+	}
+	if len(p.points) > 0 {
+		return p.points[0]
+	}
+	return nil
+}
+
+func lineLength(line [][]float64) float64 {
+	var l float64
+	for j := 0; j+1 < len(line); j++ {
+		l += math.Hypot(line[j+1][0]-line[j][0], line[j+1][1]-line[j][1])
+	}
+	return l
+}
+
+// MemberLabel is the position of the member node of relation e with role
+// label, else admin_centre, nil if it has none.
+func MemberLabel(e *Element) []float64 {
+	var centre []float64
+	for _, member := range e.Elements {
+		if member.Type != "Node" {
+			continue
+		}
+		switch member.Role {
+		case "label":
+			return []float64{member.Node.Lon, member.Node.Lat}
+		case "admin_centre":
+			if centre == nil {
+				centre = []float64{member.Node.Lon, member.Node.Lat}
+			}
+		}
+	}
+	return centre
+}
+
+// labelCell is a square of the polylabel search, d is the distance of
+// its center to the polygon edges, negative outside.
+type labelCell struct {
+	x, y, h, d, max float64
+}
+
+type labelCells []*labelCell
+
+func (c labelCells) Len() int            { return len(c) }
+func (c labelCells) Less(i, j int) bool  { return c[i].max > c[j].max }
+func (c labelCells) Swap(i, j int)       { c[i], c[j] = c[j], c[i] }
+func (c *labelCells) Push(x interface{}) { *c = append(*c, x.(*labelCell)) }
+func (c *labelCells) Pop() interface{} {
+	old := *c
+	cell := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return cell
+}
+
+// polylabel finds the pole of inaccessibility of polygon, the mapbox
+// polylabel quadtree search, to about a thousandth of its size.
+// Longitudes are scaled by the cosine of the latitude so distances are
+// even.
+func polylabel(polygon [][][]float64) []float64 {
+	scale := math.Cos(polygon[0][0][1] * math.Pi / 180)
+	if scale <= 0 {
+		scale = 1
+	}
+	rings := make([][][]float64, len(polygon))
+	west, south := math.Inf(1), math.Inf(1)
+	east, north := math.Inf(-1), math.Inf(-1)
+	for i, ring := range polygon {
+		rings[i] = make([][]float64, len(ring))
+		for j, p := range ring {
+			q := []float64{p[0] * scale, p[1]}
+			rings[i][j] = q
+			if i == 0 {
+				west, east = math.Min(west, q[0]), math.Max(east, q[0])
+				south, north = math.Min(south, q[1]), math.Max(north, q[1])
+			}
+		}
+	}
+	unscale := func(x, y float64) []float64 { return []float64{x / scale, y} }
+	size := math.Min(east-west, north-south)
+	if size == 0 || math.IsInf(size, 0) {
+		return unscale(west, south)
+	}
+	precision := math.Max(east-west, north-south) / 1000
+
+	newCell := func(x, y, h float64) *labelCell {
+		d := polygonDistance(rings, x, y)
+		return &labelCell{x: x, y: y, h: h, d: d, max: d + h*math.Sqrt2}
+	}
+	cells := &labelCells{}
+	h := size / 2
+	for x := west; x < east; x += size {
+		for y := south; y < north; y += size {
+			heap.Push(cells, newCell(x+h, y+h, h))
+		}
+	}
+	best := newCell((west+east)/2, (south+north)/2, 0)
+	if c := Centroid(geojson.NewPolygonGeometry(rings)); c != nil {
+		if cell := newCell(c[0], c[1], 0); cell.d > best.d {
+			best = cell
+		}
+	}
+	for cells.Len() > 0 {
+		cell := heap.Pop(cells).(*labelCell)
+		if cell.d > best.d {
+			best = cell
+		}
+		if cell.max-best.d <= precision {
+			continue
+		}
+		h := cell.h / 2
+		heap.Push(cells, newCell(cell.x-h, cell.y-h, h))
+		heap.Push(cells, newCell(cell.x+h, cell.y-h, h))
+		heap.Push(cells, newCell(cell.x-h, cell.y+h, h))
+		heap.Push(cells, newCell(cell.x+h, cell.y+h, h))
+	}
+	return unscale(best.x, best.y)
+}
+
+// polygonDistance is the distance of x, y to the rings, negative outside.
+func polygonDistance(rings [][][]float64, x, y float64) float64 {
+	p := []float64{x, y}
+	inside := false
+	d := math.Inf(1)
+	for _, ring := range rings {
+		if ringContains(ring, p) {
+			inside = !inside
+		}
+		for j := 0; j+1 < len(ring); j++ {
+			d = math.Min(d, segmentDistance(p, ring[j], ring[j+1]))
+		}
+	}
+	if !inside {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func near(p, q []float64, d float64) bool {
+	return len(p) == 2 && math.Abs(p[0]-q[0]) <= d && math.Abs(p[1]-q[1]) <= d
+}
+
+func TestCentroid(t *testing.T) {
+	// A 4x4 square with a 2x2 hole in its east half.
+	polygon := geojson.NewPolygonGeometry([][][]float64{square(0, 0, 4), square(2, 1, 2)})
+	if c, want := Centroid(polygon), []float64{5.0 / 3, 2}; !near(c, want, 1e-9) {
+		t.Errorf("polygon centroid %v, want %v", c, want)
+	}
+	line := geojson.NewLineStringGeometry([][]float64{{0, 0}, {3, 0}, {3, 1}})
+	if c, want := Centroid(line), []float64{1.875, 0.125}; !near(c, want, 1e-9) {
+		t.Errorf("line centroid %v, want %v", c, want)
+	}
+	points := geojson.NewMultiPointGeometry([]float64{0, 0}, []float64{2, 4})
+	if c, want := Centroid(points), []float64{1, 2}; !near(c, want, 1e-9) {
+		t.Errorf("points centroid %v, want %v", c, want)
+	}
+	if c := Centroid(geojson.NewCollectionGeometry()); c != nil {
+		t.Errorf("empty centroid %v", c)
+	}
+}
+
+func TestLabelPoint(t *testing.T) {
+	// A C shape, open to the east, its centroid in the opening.
+	c := geojson.NewPolygonGeometry([][][]float64{{
+		{0, 0}, {0.1, 0}, {0.1, 0.01}, {0.03, 0.01}, {0.03, 0.02},
+		{0.1, 0.02}, {0.1, 0.03}, {0, 0.03}, {0, 0},
+	}})
+	centroid := Centroid(c)
+	if ringContains(c.Polygon[0], centroid) {
+		t.Fatalf("centroid %v inside the C", centroid)
+	}
+	label := LabelPoint(c)
+	if !ringContains(c.Polygon[0], label) {
+		t.Errorf("label point %v outside the C", label)
+	}
+	// The farthest from the edges is in the middle of its square back.
+	if want := []float64{0.015, 0.015}; !near(label, want, 0.0005) {
+		t.Errorf("label point %v, want %v", label, want)
+	}
+
+	line := geojson.NewLineStringGeometry([][]float64{{0, 0}, {3, 0}, {3, 1}})
+	if p, want := LabelPoint(line), []float64{2, 0}; !near(p, want, 1e-9) {
+		t.Errorf("line label point %v, want %v", p, want)
+	}
+}
+
+func TestMemberLabel(t *testing.T) {
+	centre, label := testNode(1, 1, 2), testNode(2, 3, 4)
+	centre.Role, label.Role = "admin_centre", "label"
+	border := testWay(10, "outer", testNode(3, 0, 0), testNode(4, 5, 0))
+	r := testBoundary(1, "country", border, centre)
+	if p := MemberLabel(r); !reflect.DeepEqual(p, []float64{1, 2}) {
+		t.Errorf("admin_centre %v", p)
+	}
+	r.Elements = append(r.Elements, label)
+	if p := MemberLabel(r); !reflect.DeepEqual(p, []float64{3, 4}) {
+		t.Errorf("label %v", p)
+	}
+	if p := MemberLabel(testBoundary(2, "none", border)); p != nil {
+		t.Errorf("no member label %v", p)
+	}
+}
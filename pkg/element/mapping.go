@@ -0,0 +1,309 @@
+package element
+
+import (
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layer geometries. Without one a layer takes features as converted.
+const (
+	// PointGeometry takes nodes, and ways and relations at their label
+	// point.
+	PointGeometry = "point"
+	// LineStringGeometry takes lines and the rings of areas.
+	LineStringGeometry = "linestring"
+	// PolygonGeometry takes areas and closed ways.
+	PolygonGeometry = "polygon"
+)
+
+// Column types, string without one.
+const (
+	StringColumn  = "string"
+	IntegerColumn = "integer"
+	FloatColumn   = "float"
+	// BoolColumn is false for no, false and 0, else true.
+	BoolColumn = "bool"
+	// IDColumn is the OSM id.
+	IDColumn = "id"
+	// OSMTypeColumn is node, way or relation.
+	OSMTypeColumn = "osm_type"
+	// MappingKeyColumn and MappingValueColumn are the tag which mapped
+	// the element to the layer.
+	MappingKeyColumn   = "mapping_key"
+	MappingValueColumn = "mapping_value"
+	// TagsColumn is all tags, as an object.
+	TagsColumn = "tags"
+)
+
+// AnyValue in a tag value list matches any value.
+const AnyValue = "__any__"
+
+// Mapping sends elements to named layers, imposm style:
+//
+//	layers:
+//	  roads:
+//	    geometry: linestring
+//	    mapping:
+//	      highway: [motorway, primary, residential]
+//	    filters:
+//	      reject:
+//	        area: ["yes"]
+//	    columns:
+//	      - {name: id, type: id}
+//	      - {name: class, type: mapping_value}
+//	      - {name: lanes, key: lanes, type: integer}
+//	      - {name: surface, key: surface, values: {asphalt: paved, gravel: unpaved}}
+type Mapping struct {
+	Layers map[string]*Layer `yaml:"layers"`
+
+	names []string
+}
+
+// Layer is a mapping layer. Elements with a tag of Mapping, or all
+// elements without one, which pass Filters, go to it with only its
+// Columns as properties.
+type Layer struct {
+	Geometry string              `yaml:"geometry"`
+	Mapping  map[string][]string `yaml:"mapping"`
+	Filters  struct {
+		// Require is tags elements must all have.
+		Require map[string][]string `yaml:"require"`
+		// Reject is tags elements must have none of.
+		Reject map[string][]string `yaml:"reject"`
+	} `yaml:"filters"`
+	Columns []Column `yaml:"columns"`
+
+	// keys are the Mapping keys, sorted, the first matching wins.
+	keys []string
+}
+
+// Column is a layer property, from tag Key for string, integer, float and
+// bool columns. Values replaces tag values before conversion, others are
+// kept. Properties of missing tags or values failing conversion are
+// left out.
+type Column struct {
+	Name   string            `yaml:"name"`
+	Key    string            `yaml:"key"`
+	Type   string            `yaml:"type"`
+	Values map[string]string `yaml:"values"`
+}
+
+// LayerFeature is a feature of a mapping layer.
+type LayerFeature struct {
+	Layer   string
+	Feature *geojson.Feature
+}
+
+// ParseMapping parses and checks a YAML mapping. Unknown fields are
+// errors, to catch typos. Layer names are file names, without path
+// separators or "..".
+func ParseMapping(b []byte) (*Mapping, error) {
+	var m Mapping
+	if err := yaml.UnmarshalStrict(b, &m); err != nil {
+		return nil, err
+	}
+	if len(m.Layers) == 0 {
+		return nil, fmt.Errorf("mapping has no layers")
+	}
+	for name, l := range m.Layers {
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+			return nil, fmt.Errorf("invalid layer name %q, it names a file", name)
+		}
+		if l == nil {
+			return nil, fmt.Errorf("layer %s is empty", name)
+		}
+		switch l.Geometry {
+		case "", PointGeometry, LineStringGeometry, PolygonGeometry:
+		default:
+			return nil, fmt.Errorf("layer %s: invalid geometry %q, want point, linestring or polygon", name, l.Geometry)
+		}
+		if len(l.Columns) == 0 {
+			return nil, fmt.Errorf("layer %s has no columns", name)
+		}
+		for _, c := range l.Columns {
+			if c.Name == "" {
+				return nil, fmt.Errorf("layer %s: column without name", name)
+			}
+			switch c.Type {
+			case "", StringColumn, IntegerColumn, FloatColumn, BoolColumn:
+				if c.Key == "" {
+					return nil, fmt.Errorf("layer %s: column %s has no key", name, c.Name)
+				}
+			case IDColumn, OSMTypeColumn, MappingKeyColumn, MappingValueColumn, TagsColumn:
+			default:
+				return nil, fmt.Errorf("layer %s: column %s has invalid type %q", name, c.Name, c.Type)
+			}
+		}
+		for k := range l.Mapping {
+			l.keys = append(l.keys, k)
+		}
+		sort.Strings(l.keys)
+		m.names = append(m.names, name)
+	}
+	sort.Strings(m.names)
+	return &m, nil
+}
+
+// LayerNames are the names of the layers, sorted.
+func (m *Mapping) LayerNames() []string {
+	return m.names
+}
+
+// Map returns the features of e in each layer it goes to, in layer name
+// order.
+func (m *Mapping) Map(e *Element) []LayerFeature {
+	f := elementFeature(e)
+	if f == nil || f.Geometry == nil {
+		return nil
+	}
+	var features []LayerFeature
+	for _, name := range m.names {
+		if lf := m.Layers[name].feature(e, f.Geometry); lf != nil {
+			lf.ID = f.ID
+			features = append(features, LayerFeature{Layer: name, Feature: lf})
+		}
+	}
+	return features
+}
+
+func (l *Layer) feature(e *Element, g *geojson.Geometry) *geojson.Feature {
+	tags := e.GetTags()
+	var key, value string
+	if len(l.keys) > 0 {
+		for _, k := range l.keys {
+			if v, ok := tags[k]; ok && matchValue(l.Mapping[k], v) {
+				key, value = k, v
+				break
+			}
+		}
+		if key == "" {
+			return nil
+		}
+	}
+	for k, values := range l.Filters.Require {
+		if v, ok := tags[k]; !ok || !matchValue(values, v) {
+			return nil
+		}
+	}
+	for k, values := range l.Filters.Reject {
+		if v, ok := tags[k]; ok && matchValue(values, v) {
+			return nil
+		}
+	}
+	if g = l.geometry(e, g); g == nil {
+		return nil
+	}
+
+	f := geojson.NewFeature(g)
+	for _, c := range l.Columns {
+		var v interface{}
+		switch c.Type {
+		case IDColumn:
+			v = e.GetID()
+		case OSMTypeColumn:
+			v = strings.ToLower(e.Type)
+		case MappingKeyColumn:
+			v = key
+		case MappingValueColumn:
+			v = c.value(value)
+		case TagsColumn:
+			v = tags
+		default:
+			raw, ok := tags[c.Key]
+			if !ok {
+				continue
+			}
+			v = c.value(raw)
+		}
+		if v != nil {
+			f.SetProperty(c.Name, v)
+		}
+	}
+	return f
+}
+
+func matchValue(values []string, v string) bool {
+	for _, value := range values {
+		if value == v || value == AnyValue {
+			return true
+		}
+	}
+	return false
+}
+
+// value is v mapped and converted, nil if it fails conversion.
+func (c Column) value(v string) interface{} {
+	if mapped, ok := c.Values[v]; ok {
+		v = mapped
+	}
+	switch c.Type {
+	case IntegerColumn:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+		return nil
+	case FloatColumn:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		return nil
+	case BoolColumn:
+		switch v {
+		case "no", "false", "0":
+			return false
+		}
+		return true
+	}
+	return v
+}
+
+// geometry is g of e as the layer geometry, nil if it has none.
+func (l *Layer) geometry(e *Element, g *geojson.Geometry) *geojson.Geometry {
+	switch l.Geometry {
+	case PointGeometry:
+		if g.Type == geojson.GeometryPoint {
+			return g
+		}
+		p := MemberLabel(e)
+		if p == nil {
+			p = LabelPoint(g)
+		}
+		if p == nil {
+			return nil
+		}
+		return geojson.NewPointGeometry(p)
+	case LineStringGeometry:
+		p := geometryParts(g)
+		lines := p.lines
+		for _, polygon := range p.polygons {
+			lines = append(lines, polygon...)
+		}
+		switch len(lines) {
+		case 0:
+			return nil
+		case 1:
+			return geojson.NewLineStringGeometry(lines[0])
+		}
+		return geojson.NewMultiLineStringGeometry(lines...)
+	case PolygonGeometry:
+		p := geometryParts(g)
+		polygons := p.polygons
+		for _, line := range p.lines {
+			if len(line) >= 4 && samePosition(line[0], line[len(line)-1]) {
+				polygons = append(polygons, [][][]float64{line})
+			}
+		}
+		switch len(polygons) {
+		case 0:
+			return nil
+		case 1:
+			return geojson.NewPolygonGeometry(polygons[0])
+		}
+		return geojson.NewMultiPolygonGeometry(polygons...)
+	}
+	return g
+}
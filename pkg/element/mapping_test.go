@@ -0,0 +1,117 @@
+package element
+
+import (
+	"github.com/thomersch/gosmparse"
+	"reflect"
+	"testing"
+)
+
+const testMapping = `
+layers:
+  roads:
+    geometry: linestring
+    mapping:
+      highway: [motorway, primary]
+    filters:
+      reject:
+        area: [yes]
+    columns:
+      - {name: id, type: id}
+      - {name: class, type: mapping_value, values: {motorway: major, primary: major}}
+      - {name: lanes, key: lanes, type: integer}
+      - {name: oneway, key: oneway, type: bool}
+  buildings:
+    geometry: polygon
+    mapping:
+      building: [__any__]
+    columns:
+      - {name: type, type: osm_type}
+      - {name: levels, key: building:levels, type: float}
+  pois:
+    geometry: point
+    mapping:
+      amenity: [__any__]
+      shop: [__any__]
+    filters:
+      require:
+        name: [__any__]
+    columns:
+      - {name: key, type: mapping_key}
+      - {name: name, key: name}
+`
+
+func TestParseMapping(t *testing.T) {
+	m, err := ParseMapping([]byte(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := m.LayerNames(); !reflect.DeepEqual(names, []string{"buildings", "pois", "roads"}) {
+		t.Errorf("layers %v", names)
+	}
+	// Unquoted yes stays a string.
+	if reject := m.Layers["roads"].Filters.Reject["area"]; !reflect.DeepEqual(reject, []string{"yes"}) {
+		t.Errorf("reject %v", reject)
+	}
+	for _, s := range []string{
+		"",
+		"layers: {roads: {columns: [{name: a}]}}",
+		"layers: {roads: {geometry: area, columns: [{name: a, key: a}]}}",
+		"layers: {roads: {columns: [{name: a, type: date}]}}",
+		"layers: {roads: {colums: [{name: a, key: a}]}}",
+		"layers: {../roads: {columns: [{name: a, key: a}]}}",
+		"layers: {a/b: {columns: [{name: a, key: a}]}}",
+		`layers: {'a\\b': {columns: [{name: a, key: a}]}}`,
+		"layers: {'..': {columns: [{name: a, key: a}]}}",
+	} {
+		if _, err := ParseMapping([]byte(s)); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestMappingMap(t *testing.T) {
+	m, err := ParseMapping([]byte(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testNode(1, 0, 0)
+	square := []Element{a, testNode(2, 0.001, 0), testNode(3, 0.001, 0.001), testNode(4, 0, 0.001), a}
+	tagged := func(e Element, tags map[string]string) *Element {
+		e.Way.Tags = tags
+		return &e
+	}
+
+	road := tagged(testWay(10, "", square[:3]...), map[string]string{"highway": "motorway", "lanes": "3", "oneway": "no"})
+	features := m.Map(road)
+	if len(features) != 1 || features[0].Layer != "roads" {
+		t.Fatalf("road in %+v", features)
+	}
+	want := map[string]interface{}{"id": int64(10), "class": "major", "lanes": int64(3), "oneway": false}
+	if f := features[0].Feature; !reflect.DeepEqual(f.Properties, want) || f.Geometry.Type != "LineString" {
+		t.Errorf("road %v %v, want %v", f.Geometry.Type, f.Properties, want)
+	}
+	// Rejected by the filter.
+	if features := m.Map(tagged(*road, map[string]string{"highway": "primary", "area": "yes"})); len(features) != 0 {
+		t.Errorf("area road in %+v", features)
+	}
+
+	// A named shop building goes to buildings as a polygon, to pois at
+	// its label point.
+	shop := tagged(testWay(11, "", square...), map[string]string{"building": "retail", "shop": "bakery", "name": "Bread", "building:levels": "2"})
+	features = m.Map(shop)
+	if len(features) != 2 || features[0].Layer != "buildings" || features[1].Layer != "pois" {
+		t.Fatalf("shop in %+v", features)
+	}
+	if f := features[0].Feature; f.Geometry.Type != "Polygon" || !reflect.DeepEqual(f.Properties, map[string]interface{}{"type": "way", "levels": 2.0}) {
+		t.Errorf("building %v %v", f.Geometry.Type, f.Properties)
+	}
+	if f := features[1].Feature; f.Geometry.Type != "Point" || !reflect.DeepEqual(f.Properties, map[string]interface{}{"key": "shop", "name": "Bread"}) {
+		t.Errorf("poi %v %v", f.Geometry.Type, f.Properties)
+	}
+
+	// Unnamed, the shop is no poi.
+	node := Element{Type: "Node", Node: gosmparse.Node{Element: gosmparse.Element{ID: 5, Tags: map[string]string{"shop": "bakery"}}}}
+	if features := m.Map(&node); len(features) != 0 {
+		t.Errorf("unnamed shop in %+v", features)
+	}
+}
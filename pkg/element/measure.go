@@ -0,0 +1,164 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"math"
+)
+
+// WGS84 ellipsoid.
+const (
+	wgs84A = 6378137
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// wgs84E is the WGS84 eccentricity, wgs84Qp the authalic q of the pole.
+var (
+	wgs84E  = math.Sqrt(wgs84F * (2 - wgs84F))
+	wgs84Qp = authalicQ(1)
+)
+
+// Measures are the geodesic measures of a geometry on the WGS84
+// ellipsoid.
+type Measures struct {
+	// Length of its lines, in meters.
+	Length float64
+	// Area of its polygons, holes taken out, in square meters.
+	Area float64
+	// Perimeter of its polygons, holes included, in meters.
+	Perimeter float64
+	// BBox is [west, south, east, north], nil if it's empty.
+	BBox []float64
+}
+
+// Measure measures g. Areas are of rings as drawn on the authalic
+// sphere, of the same area as the ellipsoid, and exact for ex
+// latitude-longitude boxes.
+func Measure(g *geojson.Geometry) Measures {
+	var m Measures
+	if g == nil {
+		return m
+	}
+	p := geometryParts(g)
+	for _, line := range p.lines {
+		m.Length += geodesicLength(line)
+	}
+	for _, polygon := range p.polygons {
+		for i, ring := range polygon {
+			m.Perimeter += geodesicLength(ring)
+			if i == 0 {
+				m.Area += geodesicArea(ring)
+			} else {
+				m.Area -= geodesicArea(ring)
+			}
+		}
+	}
+	m.Area = math.Max(m.Area, 0)
+	if len(p.points) > 0 || len(p.lines) > 0 || len(p.polygons) > 0 {
+		m.BBox = geometryBBox(g, false)
+	}
+	return m
+}
+
+// Measure measures e as converted to GeoJSON.
+func (e *Element) Measure() Measures {
+	f := elementFeature(e)
+	if f == nil {
+		return Measures{}
+	}
+	return Measure(f.Geometry)
+}
+
+func geodesicLength(line [][]float64) float64 {
+	var l float64
+	for j := 0; j+1 < len(line); j++ {
+		l += geodesicDistance(line[j], line[j+1])
+	}
+	return l
+}
+
+// geodesicDistance is Vincenty's inverse formula, falling back to the
+// great circle for nearly antipodal points where it doesn't converge.
+func geodesicDistance(a, b []float64) float64 {
+	l := radians(lonDelta(a[0], b[0]))
+	u1 := math.Atan((1 - wgs84F) * math.Tan(radians(a[1])))
+	u2 := math.Atan((1 - wgs84F) * math.Tan(radians(b[1])))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+
+	lambda := l
+	for i := 0; i < 100; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		// On the equator cos2Alpha is 0.
+		var cos2SigmaM float64
+		if cos2Alpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		c := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		previous := lambda
+		lambda = l + (1-c)*wgs84F*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-previous) > 1e-12 {
+			continue
+		}
+		u := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+		bigA := 1 + u/16384*(4096+u*(-768+u*(320-175*u)))
+		bigB := u / 1024 * (256 + u*(-128+u*(74-47*u)))
+		deltaSigma := bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+		return wgs84B * bigA * (sigma - deltaSigma)
+	}
+
+	lat1, lat2 := radians(a[1]), radians(b[1])
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(l/2), 2)
+	return 2 * authalicRadius() * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// geodesicArea is the area of ring, whatever its winding: the spherical
+// excess on the authalic sphere of its authalic latitudes.
+func geodesicArea(ring [][]float64) float64 {
+	var area float64
+	for j := 0; j+1 < len(ring); j++ {
+		p, q := ring[j], ring[j+1]
+		area += radians(lonDelta(p[0], q[0])) * (2 + authalicSin(p[1]) + authalicSin(q[1]))
+	}
+	r := authalicRadius()
+	return math.Abs(area * r * r / 2)
+}
+
+func authalicRadius() float64 {
+	return wgs84A * math.Sqrt(wgs84Qp/2)
+}
+
+// authalicSin is the sine of the authalic latitude of lat.
+func authalicSin(lat float64) float64 {
+	return authalicQ(math.Sin(radians(lat))) / wgs84Qp
+}
+
+func authalicQ(sinLat float64) float64 {
+	e := wgs84E
+	es := e * sinLat
+	return (1 - e*e) * (sinLat/(1-es*es) - math.Log((1-es)/(1+es))/(2*e))
+}
+
+// lonDelta is to - from, the short way around.
+func lonDelta(from, to float64) float64 {
+	d := to - from
+	if d > 180 {
+		d -= 360
+	} else if d < -180 {
+		d += 360
+	}
+	return d
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,78 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGeodesicDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b []float64
+		want float64
+	}{
+		{[]float64{0, 0}, []float64{1, 0}, 111319.491},
+		{[]float64{0, 0}, []float64{0, 1}, 110574.389},
+		{[]float64{179.5, 0}, []float64{-179.5, 0}, 111319.491},
+		{[]float64{2.3522, 48.8566}, []float64{2.3522, 48.8566}, 0},
+	} {
+		if d := geodesicDistance(c.a, c.b); math.Abs(d-c.want) > 0.01 {
+			t.Errorf("%v to %v: %f, want %f", c.a, c.b, d, c.want)
+		}
+	}
+	// Antipodes fall back to the great circle.
+	if d := geodesicDistance([]float64{0, 0}, []float64{180, 0}); math.Abs(d-2e7)/2e7 > 0.01 {
+		t.Errorf("antipodes %f", d)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	// An eighth of the 510065621.7 km² of the ellipsoid, whatever the winding.
+	octant := [][]float64{{0, 0}, {0, 90}, {90, 90}, {90, 0}, {0, 0}}
+	m := Measure(geojson.NewPolygonGeometry([][][]float64{octant}))
+	if want := 510065621.7e6 / 8; math.Abs(m.Area-want)/want > 1e-6 {
+		t.Errorf("octant area %f, want %f", m.Area, want)
+	}
+	if !reflect.DeepEqual(m.BBox, []float64{0, 0, 90, 90}) {
+		t.Errorf("octant bbox %v", m.BBox)
+	}
+
+	// Holes are taken out of the area, added to the perimeter.
+	shell, hole := square(0, 0, 0.01), square(0.002, 0.002, 0.005)
+	full := Measure(geojson.NewPolygonGeometry([][][]float64{shell}))
+	holed := Measure(geojson.NewPolygonGeometry([][][]float64{shell, hole}))
+	holeArea := Measure(geojson.NewPolygonGeometry([][][]float64{hole})).Area
+	if math.Abs(holed.Area-(full.Area-holeArea)) > 1e-6 || holed.Perimeter <= full.Perimeter {
+		t.Errorf("holed %+v, full %+v", holed, full)
+	}
+	if m.Length != 0 || full.Length != 0 {
+		t.Errorf("polygon lengths %f %f", m.Length, full.Length)
+	}
+
+	line := Measure(geojson.NewLineStringGeometry([][]float64{{0, 0}, {1, 0}, {1, 1}}))
+	if want := 111319.491 + 110574.389; math.Abs(line.Length-want) > 1 || line.Area != 0 {
+		t.Errorf("line %+v, want length %f", line, want)
+	}
+	if m := Measure(geojson.NewCollectionGeometry()); m.BBox != nil {
+		t.Errorf("empty bbox %v", m.BBox)
+	}
+}
+
+func TestElementMeasure(t *testing.T) {
+	a := testNode(1, 0, 0)
+	way := testWay(1, "", a, testNode(2, 0.01, 0), testNode(3, 0.01, 0.01), testNode(4, 0, 0.01), a)
+	m := way.Measure()
+	if m.Area != 0 || m.Length < 4000 {
+		t.Errorf("closed way %+v", m)
+	}
+	way.Way.Tags = map[string]string{"area": "yes"}
+	if m := way.Measure(); m.Area < 1.2e6 || m.Area > 1.25e6 || m.Length != 0 {
+		t.Errorf("area %+v", m)
+	}
+	node := Element{Type: "Node", Node: gosmparse.Node{Lon: 1, Lat: 2}}
+	if m := node.Measure(); !reflect.DeepEqual(m.BBox, []float64{1, 2, 1, 2}) {
+		t.Errorf("node %+v", m)
+	}
+}
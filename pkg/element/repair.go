@@ -0,0 +1,366 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"math"
+	"sort"
+)
+
+// Repair returns g fixed to pass Validate, nil if nothing valid is left.
+// Invalid coordinates and repeated positions are dropped, and so are lines
+// with less than two positions. Invalid polygons are rebuilt: their rings
+// are noded, split where they meet, and the area is the union of the
+// polygons, a polygon being what is inside its shell and outside its
+// holes, even-odd for self-intersecting rings. Rebuilt shells are
+// counterclockwise and holes clockwise.
+func Repair(g *geojson.Geometry) *geojson.Geometry {
+	switch g.Type {
+	case geojson.GeometryPoint:
+		if !validPosition(g.Point) {
+			return nil
+		}
+		return g
+	case geojson.GeometryMultiPoint:
+		var points [][]float64
+		for _, p := range g.MultiPoint {
+			if validPosition(p) {
+				points = append(points, p)
+			}
+		}
+		if len(points) == 0 {
+			return nil
+		}
+		return geojson.NewMultiPointGeometry(points...)
+	case geojson.GeometryLineString:
+		if line := repairLine(g.LineString); line != nil {
+			return geojson.NewLineStringGeometry(line)
+		}
+		return nil
+	case geojson.GeometryMultiLineString:
+		var lines [][][]float64
+		for _, line := range g.MultiLineString {
+			if line := repairLine(line); line != nil {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return geojson.NewMultiLineStringGeometry(lines...)
+	case geojson.GeometryPolygon, geojson.GeometryMultiPolygon:
+		if Validate(g) == nil {
+			return g
+		}
+		polygons := g.MultiPolygon
+		if g.Type == geojson.GeometryPolygon {
+			polygons = [][][][]float64{g.Polygon}
+		}
+		switch rebuilt := rebuildPolygons(polygons); len(rebuilt) {
+		case 0:
+			return nil
+		case 1:
+			return geojson.NewPolygonGeometry(rebuilt[0])
+		default:
+			return geojson.NewMultiPolygonGeometry(rebuilt...)
+		}
+	case geojson.GeometryCollection:
+		var geometries []*geojson.Geometry
+		for _, child := range g.Geometries {
+			if fixed := Repair(child); fixed != nil {
+				geometries = append(geometries, fixed)
+			}
+		}
+		if len(geometries) == 0 {
+			return nil
+		}
+		return geojson.NewCollectionGeometry(geometries...)
+	}
+	return nil
+}
+
+func repairLine(line [][]float64) [][]float64 {
+	var valid [][]float64
+	for _, p := range line {
+		if validPosition(p) {
+			valid = append(valid, p)
+		}
+	}
+	if valid = dedup(valid); len(valid) < 2 {
+		return nil
+	}
+	return valid
+}
+
+// snap rounds noded positions to 1e-9 degrees so computed intersections
+// match, well under the 1e-7 precision of OSM.
+func snap(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+// vertex is a snapped position of the noded rings.
+type vertex [2]float64
+
+func (v vertex) position() []float64 {
+	return []float64{v[0], v[1]}
+}
+
+// halfEdge is a directed edge of the noded rings, twin is its reverse.
+type halfEdge struct {
+	from, to vertex
+	twin     int
+	// pos is the index in the edges leaving from, counterclockwise.
+	pos  int
+	face int
+}
+
+// rebuildPolygons nodes the rings of polygons into a planar graph, keeps
+// the faces inside the area and traces the edges between kept and other
+// faces back into rings.
+func rebuildPolygons(polygons [][][][]float64) [][][][]float64 {
+	// Clean rings, a polygon without a usable shell is dropped.
+	var cleaned [][][][]float64
+	var segs []segment
+	rings := 0
+	for _, polygon := range polygons {
+		var kept [][][]float64
+		for i, ring := range polygon {
+			var r [][]float64
+			for _, p := range ring {
+				if validPosition(p) {
+					r = append(r, []float64{snap(p[0]), snap(p[1])})
+				}
+			}
+			r = dedup(r)
+			if len(r) > 0 && !samePosition(r[0], r[len(r)-1]) {
+				r = append(r, r[0])
+			}
+			if len(r) < 4 {
+				if i == 0 {
+					break
+				}
+				continue
+			}
+			kept = append(kept, r)
+			segs = append(segs, ringSegments(r, rings)...)
+			rings++
+		}
+		if len(kept) > 0 {
+			cleaned = append(cleaned, kept)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil
+	}
+	inside := func(p []float64) bool {
+		for _, polygon := range cleaned {
+			if !ringContains(polygon[0], p) {
+				continue
+			}
+			inHole := false
+			for _, hole := range polygon[1:] {
+				if ringContains(hole, p) {
+					inHole = true
+					break
+				}
+			}
+			if !inHole {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Node: split segments where they meet.
+	splits := make([][][]float64, len(segs))
+	sweep(segs, func(i, j int, points [][]float64) bool {
+		for _, p := range points {
+			q := []float64{snap(p[0]), snap(p[1])}
+			splits[i] = append(splits[i], q)
+			splits[j] = append(splits[j], q)
+		}
+		return true
+	})
+	type edgeKey [2]vertex
+	edges := map[edgeKey]bool{}
+	for i, s := range segs {
+		points := append([][]float64{s.a, s.b}, splits[i]...)
+		dx, dy := s.b[0]-s.a[0], s.b[1]-s.a[1]
+		sort.Slice(points, func(i, j int) bool {
+			return (points[i][0]-s.a[0])*dx+(points[i][1]-s.a[1])*dy < (points[j][0]-s.a[0])*dx+(points[j][1]-s.a[1])*dy
+		})
+		for j := 1; j < len(points); j++ {
+			u, v := vertex{points[j-1][0], points[j-1][1]}, vertex{points[j][0], points[j][1]}
+			if u == v {
+				continue
+			}
+			if v[0] < u[0] || (v[0] == u[0] && v[1] < u[1]) {
+				u, v = v, u
+			}
+			edges[edgeKey{u, v}] = true
+		}
+	}
+
+	// Planar graph, edges around each vertex counterclockwise. Sorted
+	// edges keep the output stable.
+	keys := make([]edgeKey, 0, len(edges))
+	for e := range edges {
+		keys = append(keys, e)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		for k := 0; k < 2; k++ {
+			for c := 0; c < 2; c++ {
+				if a[k][c] != b[k][c] {
+					return a[k][c] < b[k][c]
+				}
+			}
+		}
+		return false
+	})
+	var half []halfEdge
+	out := map[vertex][]int{}
+	for _, e := range keys {
+		h := len(half)
+		half = append(half, halfEdge{from: e[0], to: e[1], twin: h + 1, face: -1})
+		half = append(half, halfEdge{from: e[1], to: e[0], twin: h, face: -1})
+		out[e[0]] = append(out[e[0]], h)
+		out[e[1]] = append(out[e[1]], h+1)
+	}
+	angle := func(h int) float64 {
+		return math.Atan2(half[h].to[1]-half[h].from[1], half[h].to[0]-half[h].from[0])
+	}
+	for _, hs := range out {
+		sort.Slice(hs, func(i, j int) bool { return angle(hs[i]) < angle(hs[j]) })
+		for i, h := range hs {
+			half[h].pos = i
+		}
+	}
+	// next turns at the end of h to the first edge clockwise from its
+	// twin, following the face on the left of h.
+	next := func(h int, keep func(int) bool) int {
+		twin := half[half[h].twin]
+		hs := out[twin.from]
+		for k := 1; k <= len(hs); k++ {
+			n := hs[(twin.pos-k+len(hs))%len(hs)]
+			if keep(n) {
+				return n
+			}
+		}
+		return -1
+	}
+	all := func(int) bool { return true }
+
+	// Faces, each tested at a point left of its longest edge.
+	var faceInside []bool
+	for h := range half {
+		if half[h].face >= 0 {
+			continue
+		}
+		face := len(faceInside)
+		longest, length := h, 0.0
+		for e := h; half[e].face < 0; e = next(e, all) {
+			half[e].face = face
+			if l := edgeLength(half[e].from, half[e].to); l > length {
+				longest, length = e, l
+			}
+		}
+		faceInside = append(faceInside, inside(leftOf(half[longest].from, half[longest].to)))
+	}
+
+	// Boundary edges have the area on their left only.
+	boundary := func(h int) bool {
+		return faceInside[half[h].face] && !faceInside[half[half[h].twin].face]
+	}
+	used := make([]bool, len(half))
+	var shells, holes [][][]float64
+	var holeSamples [][]float64
+	for h := range half {
+		if used[h] || !boundary(h) {
+			continue
+		}
+		walk := []vertex{half[h].from}
+		for e := h; e >= 0 && !used[e]; e = next(e, boundary) {
+			used[e] = true
+			walk = append(walk, half[e].to)
+		}
+		if walk[0] != walk[len(walk)-1] {
+			continue
+		}
+		for _, cycle := range splitWalk(walk) {
+			ring := make([][]float64, len(cycle))
+			longest, length := 0, 0.0
+			for i, v := range cycle {
+				ring[i] = v.position()
+				if i > 0 {
+					if l := edgeLength(cycle[i-1], v); l > length {
+						longest, length = i, l
+					}
+				}
+			}
+			if len(ring) < 4 {
+				continue
+			}
+			if ringArea(ring) > 0 {
+				shells = append(shells, ring)
+			} else {
+				holes = append(holes, ring)
+				holeSamples = append(holeSamples, leftOf(cycle[longest-1], cycle[longest]))
+			}
+		}
+	}
+
+	// Holes go to the smallest shell around them.
+	rebuilt := make([][][][]float64, len(shells))
+	for i, shell := range shells {
+		rebuilt[i] = [][][]float64{shell}
+	}
+	for i, hole := range holes {
+		best, bestArea := -1, math.Inf(1)
+		for j, shell := range shells {
+			if area := ringArea(shell); area < bestArea && ringContains(shell, holeSamples[i]) {
+				best, bestArea = j, area
+			}
+		}
+		if best >= 0 {
+			rebuilt[best] = append(rebuilt[best], hole)
+		}
+	}
+	return rebuilt
+}
+
+// splitWalk splits a closed walk at the vertices it passes twice, ex a
+// shell pinched around a hole, into simple closed rings.
+func splitWalk(walk []vertex) [][]vertex {
+	var cycles [][]vertex
+	var stack []vertex
+	seen := map[vertex]int{}
+	for _, v := range walk[:len(walk)-1] {
+		if i, ok := seen[v]; ok {
+			cycle := append(append([]vertex{}, stack[i:]...), v)
+			cycles = append(cycles, cycle)
+			for _, u := range stack[i+1:] {
+				delete(seen, u)
+			}
+			stack = stack[:i+1]
+			continue
+		}
+		seen[v] = len(stack)
+		stack = append(stack, v)
+	}
+	return append(cycles, append(stack, stack[0]))
+}
+
+func edgeLength(from, to vertex) float64 {
+	return math.Hypot(to[0]-from[0], to[1]-from[1])
+}
+
+// leftOf is a point just left of the middle of edge from, to.
+func leftOf(from, to vertex) []float64 {
+	dx, dy := to[0]-from[0], to[1]-from[1]
+	length := math.Hypot(dx, dy)
+	offset := math.Min(length/1000, 1e-8) / length
+	return []float64{
+		(from[0]+to[0])/2 - dy*offset,
+		(from[1]+to[1])/2 + dx*offset,
+	}
+}
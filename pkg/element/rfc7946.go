@@ -0,0 +1,395 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"math"
+)
+
+// RFC7946 fixes features for strict RFC 7946 output.
+type RFC7946 struct {
+	// Precision is the decimals coordinates keep, negative keeps them all.
+	// 7 is the OSM precision, about 1cm.
+	Precision int
+	// BBox adds a bbox member to features.
+	BBox bool
+}
+
+// Feature fixes f in place: exterior rings counterclockwise and holes
+// clockwise, coordinates rounded, geometries split at the antimeridian,
+// unclosed rings closed and parts too small to be valid dropped.
+// It returns nil if no part of the geometry is left. Features without
+// geometry, ex deleted ones, pass as they are.
+func (o RFC7946) Feature(f *geojson.Feature) *geojson.Feature {
+	if f.Geometry == nil {
+		return f
+	}
+	g, crossed := o.geometry(f.Geometry)
+	if g == nil {
+		return nil
+	}
+	f.Geometry = g
+	if o.BBox {
+		f.BoundingBox = geometryBBox(g, crossed)
+	}
+	return f
+}
+
+// geometry returns a fixed copy of g, nil if degenerate, and whether it
+// crossed the antimeridian.
+func (o RFC7946) geometry(g *geojson.Geometry) (*geojson.Geometry, bool) {
+	switch g.Type {
+	case geojson.GeometryPoint:
+		if len(g.Point) < 2 {
+			return nil, false
+		}
+		return geojson.NewPointGeometry(o.position(g.Point[0], g.Point[1])), false
+	case geojson.GeometryMultiPoint:
+		var points [][]float64
+		for _, p := range g.MultiPoint {
+			if len(p) >= 2 {
+				points = append(points, o.position(p[0], p[1]))
+			}
+		}
+		if len(points) == 0 {
+			return nil, false
+		}
+		return geojson.NewMultiPointGeometry(points...), false
+	case geojson.GeometryLineString, geojson.GeometryMultiLineString:
+		lines := g.MultiLineString
+		if g.Type == geojson.GeometryLineString {
+			lines = [][][]float64{g.LineString}
+		}
+		var parts [][][]float64
+		crossed := false
+		for _, line := range lines {
+			split, c := o.lineString(line)
+			parts = append(parts, split...)
+			crossed = crossed || c
+		}
+		switch {
+		case len(parts) == 0:
+			return nil, false
+		case len(parts) == 1 && g.Type == geojson.GeometryLineString:
+			return geojson.NewLineStringGeometry(parts[0]), crossed
+		}
+		return geojson.NewMultiLineStringGeometry(parts...), crossed
+	case geojson.GeometryPolygon, geojson.GeometryMultiPolygon:
+		polygons := g.MultiPolygon
+		if g.Type == geojson.GeometryPolygon {
+			polygons = [][][][]float64{g.Polygon}
+		}
+		var parts [][][][]float64
+		crossed := false
+		for _, polygon := range polygons {
+			split, c := o.polygon(polygon)
+			parts = append(parts, split...)
+			crossed = crossed || c
+		}
+		switch {
+		case len(parts) == 0:
+			return nil, false
+		case len(parts) == 1 && g.Type == geojson.GeometryPolygon:
+			return geojson.NewPolygonGeometry(parts[0]), crossed
+		}
+		return geojson.NewMultiPolygonGeometry(parts...), crossed
+	case geojson.GeometryCollection:
+		var geometries []*geojson.Geometry
+		crossed := false
+		for _, child := range g.Geometries {
+			if fixed, c := o.geometry(child); fixed != nil {
+				geometries = append(geometries, fixed)
+				crossed = crossed || c
+			}
+		}
+		if len(geometries) == 0 {
+			return nil, false
+		}
+		return geojson.NewCollectionGeometry(geometries...), crossed
+	}
+	return nil, false
+}
+
+// Round rounds a coordinate to Precision, ex of positions or bboxes
+// computed before Feature.
+func (o RFC7946) Round(v float64) float64 {
+	if o.Precision < 0 {
+		return v
+	}
+	scale := math.Pow10(o.Precision)
+	return math.Round(v*scale) / scale
+}
+
+func (o RFC7946) position(lon, lat float64) []float64 {
+	return []float64{o.Round(lon), o.Round(lat)}
+}
+
+// unwrap returns the coordinates with longitudes made continuous, ex 179 then
+// -179 becomes 179 then 181. Positions are copied.
+func unwrap(coords [][]float64) [][]float64 {
+	out := make([][]float64, 0, len(coords))
+	for _, p := range coords {
+		if len(p) < 2 {
+			continue
+		}
+		lon := p[0]
+		if len(out) > 0 {
+			prev := out[len(out)-1][0]
+			for lon-prev > 180 {
+				lon -= 360
+			}
+			for lon-prev < -180 {
+				lon += 360
+			}
+		}
+		out = append(out, []float64{lon, p[1]})
+	}
+	return out
+}
+
+// Bands are 360 degrees of unwrapped longitude, band 0 is -180 to 180.
+// Edges belong to both bands, so ways already split at the antimeridian
+// don't cross it.
+
+// eastBand is the highest band holding lon.
+func eastBand(lon float64) int {
+	return int(math.Ceil((lon - 180) / 360))
+}
+
+// westBand is the lowest band holding lon.
+func westBand(lon float64) int {
+	return int(math.Floor((lon + 180) / 360))
+}
+
+// lineString splits a line at the antimeridian, rounds it and drops parts
+// with less than two positions.
+func (o RFC7946) lineString(coords [][]float64) ([][][]float64, bool) {
+	pts := unwrap(coords)
+	var parts [][][]float64
+	var part [][]float64
+	band := 0
+	for i, p := range pts {
+		for i > 0 && (eastBand(p[0]) > band || westBand(p[0]) < band) {
+			// Leave the band at its edge.
+			prev := pts[i-1]
+			step := 1
+			edge := 180 + 360*float64(band)
+			if westBand(p[0]) < band {
+				step = -1
+				edge = -180 + 360*float64(band)
+			}
+			cross := crossing(prev, p, edge)
+			part = append(part, []float64{edge - 360*float64(band), cross[1]})
+			parts = append(parts, part)
+			band += step
+			part = [][]float64{{edge - 360*float64(band), cross[1]}}
+		}
+		part = append(part, []float64{p[0] - 360*float64(band), p[1]})
+	}
+	parts = append(parts, part)
+
+	var lines [][][]float64
+	for _, part := range parts {
+		if line := o.clean(part); len(line) >= 2 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, len(parts) > 1
+}
+
+// polygon splits a polygon at the antimeridian and returns the valid
+// polygons, rings closed, rounded and wound.
+func (o RFC7946) polygon(rings [][][]float64) ([][][][]float64, bool) {
+	if len(rings) == 0 {
+		return nil, false
+	}
+	unwrapped := make([][][]float64, 0, len(rings))
+	for i, ring := range rings {
+		r := unwrap(ring)
+		if len(r) == 0 {
+			if i == 0 {
+				return nil, false
+			}
+			continue
+		}
+		if first, last := r[0], r[len(r)-1]; first[0] != last[0] || first[1] != last[1] {
+			r = append(r, []float64{first[0], first[1]})
+		}
+		// Holes in the same band as the exterior.
+		if i > 0 {
+			shift := 360 * math.Round((unwrapped[0][0][0]-r[0][0])/360)
+			for _, p := range r {
+				p[0] += shift
+			}
+		}
+		unwrapped = append(unwrapped, r)
+	}
+
+	minBand, maxBand := 0, 0
+	for _, p := range unwrapped[0] {
+		if t := westBand(p[0]); t < minBand {
+			minBand = t
+		}
+		if t := eastBand(p[0]); t > maxBand {
+			maxBand = t
+		}
+	}
+	var polygons [][][][]float64
+	for t := minBand; t <= maxBand; t++ {
+		west, east := -180+360*float64(t), 180+360*float64(t)
+		var polygon [][][]float64
+		for i, ring := range unwrapped {
+			if minBand != maxBand {
+				ring = clipRing(ring, west, east)
+			}
+			for _, p := range ring {
+				p[0] -= 360 * float64(t)
+			}
+			fixed := o.ring(ring, i == 0)
+			if fixed == nil {
+				if i == 0 {
+					break
+				}
+				continue
+			}
+			polygon = append(polygon, fixed)
+		}
+		if len(polygon) > 0 {
+			polygons = append(polygons, polygon)
+		}
+	}
+	return polygons, minBand != maxBand
+}
+
+// ring rounds and closes a ring, nil if it has less than four positions
+// or no area, exterior rings are wound counterclockwise, holes clockwise.
+func (o RFC7946) ring(coords [][]float64, exterior bool) [][]float64 {
+	r := o.clean(coords)
+	if len(r) > 0 && (r[0][0] != r[len(r)-1][0] || r[0][1] != r[len(r)-1][1]) {
+		r = append(r, []float64{r[0][0], r[0][1]})
+	}
+	if len(r) < 4 {
+		return nil
+	}
+	area := ringArea(r)
+	if area == 0 {
+		return nil
+	}
+	if (area > 0) != exterior {
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+	}
+	return r
+}
+
+// clean rounds positions and drops repeated ones.
+func (o RFC7946) clean(coords [][]float64) [][]float64 {
+	out := make([][]float64, 0, len(coords))
+	for _, p := range coords {
+		q := o.position(p[0], p[1])
+		if n := len(out); n > 0 && out[n-1][0] == q[0] && out[n-1][1] == q[1] {
+			continue
+		}
+		out = append(out, q)
+	}
+	return out
+}
+
+// ringArea is the signed shoelace area, positive counterclockwise.
+func ringArea(ring [][]float64) float64 {
+	var area float64
+	for i := 0; i < len(ring)-1; i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// clipRing clips a closed ring to west <= lon <= east, Sutherland-Hodgman.
+func clipRing(ring [][]float64, west, east float64) [][]float64 {
+	inWest := func(p []float64) bool { return p[0] >= west }
+	inEast := func(p []float64) bool { return p[0] <= east }
+	out := clipHalf(ring, west, inWest)
+	return clipHalf(out, east, inEast)
+}
+
+// clipHalf keeps the part of a closed ring where inside holds, edge is the
+// longitude bounding it.
+func clipHalf(ring [][]float64, edge float64, inside func([]float64) bool) [][]float64 {
+	if len(ring) < 2 {
+		return nil
+	}
+	open := ring[:len(ring)-1]
+	var out [][]float64
+	for i, cur := range open {
+		prev := open[(i+len(open)-1)%len(open)]
+		if inside(cur) {
+			if !inside(prev) {
+				out = append(out, crossing(prev, cur, edge))
+			}
+			out = append(out, []float64{cur[0], cur[1]})
+		} else if inside(prev) {
+			out = append(out, crossing(prev, cur, edge))
+		}
+	}
+	if len(out) > 0 {
+		out = append(out, []float64{out[0][0], out[0][1]})
+	}
+	return out
+}
+
+func crossing(a, b []float64, lon float64) []float64 {
+	return []float64{lon, a[1] + (lon-a[0])/(b[0]-a[0])*(b[1]-a[1])}
+}
+
+// geometryBBox is [west, south, east, north]. Geometries split at the
+// antimeridian get west > east, the parts east of it give west.
+func geometryBBox(g *geojson.Geometry, crossed bool) []float64 {
+	var positions [][]float64
+	var collect func(g *geojson.Geometry)
+	collect = func(g *geojson.Geometry) {
+		switch g.Type {
+		case geojson.GeometryPoint:
+			positions = append(positions, g.Point)
+		case geojson.GeometryMultiPoint:
+			positions = append(positions, g.MultiPoint...)
+		case geojson.GeometryLineString:
+			positions = append(positions, g.LineString...)
+		case geojson.GeometryMultiLineString:
+			for _, line := range g.MultiLineString {
+				positions = append(positions, line...)
+			}
+		case geojson.GeometryPolygon:
+			for _, ring := range g.Polygon {
+				positions = append(positions, ring...)
+			}
+		case geojson.GeometryMultiPolygon:
+			for _, polygon := range g.MultiPolygon {
+				for _, ring := range polygon {
+					positions = append(positions, ring...)
+				}
+			}
+		case geojson.GeometryCollection:
+			for _, child := range g.Geometries {
+				collect(child)
+			}
+		}
+	}
+	collect(g)
+
+	west, east := math.Inf(1), math.Inf(-1)
+	south, north := math.Inf(1), math.Inf(-1)
+	eastWest, westEast := math.Inf(1), math.Inf(-1)
+	for _, p := range positions {
+		west, east = math.Min(west, p[0]), math.Max(east, p[0])
+		south, north = math.Min(south, p[1]), math.Max(north, p[1])
+		if p[0] >= 0 {
+			eastWest = math.Min(eastWest, p[0])
+		} else {
+			westEast = math.Max(westEast, p[0])
+		}
+	}
+	if crossed && !math.IsInf(eastWest, 1) && !math.IsInf(westEast, -1) {
+		west, east = eastWest, westEast
+	}
+	return []float64{west, south, east, north}
+}
@@ -0,0 +1,113 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"testing"
+)
+
+func TestRFC7946Winding(t *testing.T) {
+	// Clockwise exterior, counterclockwise hole.
+	f := geojson.NewPolygonFeature([][][]float64{
+		{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}},
+		{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}},
+	})
+	f = RFC7946{Precision: 7}.Feature(f)
+	if f == nil {
+		t.Fatal("polygon dropped")
+	}
+	rings := f.Geometry.Polygon
+	if ringArea(rings[0]) <= 0 {
+		t.Errorf("exterior not counterclockwise: %v", rings[0])
+	}
+	if ringArea(rings[1]) >= 0 {
+		t.Errorf("hole not clockwise: %v", rings[1])
+	}
+}
+
+func TestRFC7946Precision(t *testing.T) {
+	f := RFC7946{Precision: 3}.Feature(geojson.NewPointFeature([]float64{121.123456, 25.0004999}))
+	if want := []float64{121.123, 25}; !reflect.DeepEqual(f.Geometry.Point, want) {
+		t.Errorf("point %v, want %v", f.Geometry.Point, want)
+	}
+	f = RFC7946{Precision: -1}.Feature(geojson.NewPointFeature([]float64{121.123456, 25.0004999}))
+	if want := []float64{121.123456, 25.0004999}; !reflect.DeepEqual(f.Geometry.Point, want) {
+		t.Errorf("point %v, want %v", f.Geometry.Point, want)
+	}
+}
+
+func TestRFC7946AntimeridianLine(t *testing.T) {
+	f := geojson.NewLineStringFeature([][]float64{{178, 0}, {-178, 4}})
+	f = RFC7946{Precision: 7, BBox: true}.Feature(f)
+	if f.Geometry.Type != geojson.GeometryMultiLineString {
+		t.Fatalf("type %s, want MultiLineString", f.Geometry.Type)
+	}
+	want := [][][]float64{{{178, 0}, {180, 2}}, {{-180, 2}, {-178, 4}}}
+	if !reflect.DeepEqual(f.Geometry.MultiLineString, want) {
+		t.Errorf("lines %v, want %v", f.Geometry.MultiLineString, want)
+	}
+	if want := []float64{178, 0, -178, 4}; !reflect.DeepEqual(f.BoundingBox, want) {
+		t.Errorf("bbox %v, want %v", f.BoundingBox, want)
+	}
+
+	// Ways already split at the antimeridian stay as they are.
+	f = geojson.NewLineStringFeature([][]float64{{170, 0}, {180, 0}, {170, 1}})
+	f = RFC7946{Precision: 7}.Feature(f)
+	if f.Geometry.Type != geojson.GeometryLineString || len(f.Geometry.LineString) != 3 {
+		t.Errorf("line touching 180 changed: %v", f.Geometry)
+	}
+}
+
+func TestRFC7946AntimeridianPolygon(t *testing.T) {
+	f := geojson.NewPolygonFeature([][][]float64{
+		{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}},
+	})
+	f = RFC7946{Precision: 7}.Feature(f)
+	if f.Geometry.Type != geojson.GeometryMultiPolygon || len(f.Geometry.MultiPolygon) != 2 {
+		t.Fatalf("not split in two polygons: %v", f.Geometry)
+	}
+	for _, polygon := range f.Geometry.MultiPolygon {
+		ring := polygon[0]
+		if area := ringArea(ring); area != 200 {
+			t.Errorf("part area %v, want 200: %v", area, ring)
+		}
+		for _, p := range ring {
+			if p[0] < -180 || p[0] > 180 {
+				t.Errorf("position %v out of range", p)
+			}
+		}
+	}
+}
+
+func TestRFC7946Degenerate(t *testing.T) {
+	o := RFC7946{Precision: 7}
+	if f := o.Feature(geojson.NewPolygonFeature([][][]float64{{{0, 0}, {1, 1}, {0, 0}}})); f != nil {
+		t.Errorf("three position ring kept: %v", f.Geometry)
+	}
+	if f := o.Feature(geojson.NewLineStringFeature([][]float64{{1, 1}, {1, 1}})); f != nil {
+		t.Errorf("single position line kept: %v", f.Geometry)
+	}
+
+	// Unclosed ring.
+	f := o.Feature(geojson.NewPolygonFeature([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}))
+	if f == nil {
+		t.Fatal("unclosed ring dropped")
+	}
+	if ring := f.Geometry.Polygon[0]; len(ring) != 5 || !reflect.DeepEqual(ring[0], ring[4]) {
+		t.Errorf("ring not closed: %v", ring)
+	}
+
+	// Degenerate members of collections are dropped, not the feature.
+	f = o.Feature(geojson.NewCollectionFeature(
+		geojson.NewPointGeometry([]float64{1, 1}),
+		geojson.NewLineStringGeometry([][]float64{{1, 1}}),
+	))
+	if f == nil || len(f.Geometry.Geometries) != 1 {
+		t.Errorf("collection not cleaned: %v", f)
+	}
+
+	// Deleted features have no geometry.
+	if f := o.Feature(geojson.NewFeature(nil)); f == nil {
+		t.Error("feature without geometry dropped")
+	}
+}
@@ -0,0 +1,136 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Property layouts of a Schema.
+const (
+	// FlatLayout puts tags next to osmid and osmType, as the converters
+	// do. A tag named like them wins.
+	FlatLayout = "flat"
+	// NestedLayout puts tags in a tags object next to osmid and osmType.
+	NestedLayout = "nested"
+	// PrefixedLayout puts tags next to @id, @type and the other
+	// properties, all prefixed with @.
+	PrefixedLayout = "prefixed"
+)
+
+// Id formats of a Schema.
+const (
+	// SlashID is ex node/1.
+	SlashID = "slash"
+	// ShortID is ex n1.
+	ShortID = "short"
+	// NumericID is the OSM id, negative for relations, as osm2pgsql
+	// writes it. A node and a way may share one.
+	NumericID = "numeric"
+)
+
+// numberValue is a decimal number without leading zeros, so refs like
+// 007 stay strings.
+var numberValue = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// Schema lays out the id and properties of converted features.
+type Schema struct {
+	Layout   string
+	IDFormat string
+	// TypedValues writes tag values that are numbers as numbers.
+	TypedValues bool
+}
+
+// ID is the feature id of e.
+func (s Schema) ID(e *Element) interface{} {
+	osmType := strings.ToLower(e.Type)
+	switch s.IDFormat {
+	case ShortID:
+		return osmType[:1] + strconv.FormatInt(e.GetID(), 10)
+	case NumericID:
+		if e.Type == "Relation" {
+			return -e.GetID()
+		}
+		return e.GetID()
+	}
+	return OSMID(osmType, e.GetID())
+}
+
+// Feature lays out the id and properties of f, the feature of e, in
+// place. Properties which are not tags, ex action or those added by
+// later steps, go with osmid and osmType, also when named like a tag.
+// Deleted elements have no tags.
+func (s Schema) Feature(f *geojson.Feature, e *Element) *geojson.Feature {
+	var tags map[string]string
+	if e.Action != "delete" {
+		tags = e.GetTags()
+	}
+	id := s.ID(e)
+	osmType := strings.ToLower(e.Type)
+	others := map[string]interface{}{}
+	for k, v := range f.Properties {
+		if k == "osmid" || k == "osmType" {
+			continue
+		}
+		// A property named like a tag is the tag unless a step changed it.
+		if tag, ok := tags[k]; ok {
+			if value, ok := v.(string); ok && value == tag {
+				continue
+			}
+		}
+		others[k] = v
+	}
+	if e.Action != "" {
+		others["action"] = e.Action
+	}
+
+	properties := make(map[string]interface{}, len(tags)+len(others)+2)
+	switch s.Layout {
+	case NestedLayout:
+		nested := make(map[string]interface{}, len(tags))
+		for k, v := range tags {
+			nested[k] = s.value(v)
+		}
+		properties["tags"] = nested
+		for k, v := range others {
+			properties[k] = v
+		}
+		properties["osmid"] = id
+		properties["osmType"] = osmType
+	case PrefixedLayout:
+		for k, v := range tags {
+			properties[k] = s.value(v)
+		}
+		for k, v := range others {
+			properties["@"+k] = v
+		}
+		properties["@id"] = id
+		properties["@type"] = osmType
+	default:
+		properties["osmid"] = id
+		properties["osmType"] = osmType
+		for k, v := range tags {
+			properties[k] = s.value(v)
+		}
+		for k, v := range others {
+			properties[k] = v
+		}
+	}
+	f.ID = id
+	f.Properties = properties
+	return f
+}
+
+func (s Schema) value(v string) interface{} {
+	if !s.TypedValues || !numberValue.MatchString(v) {
+		return v
+	}
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	return v
+}
@@ -0,0 +1,68 @@
+package element
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaID(t *testing.T) {
+	node := testNode(5, 0, 0)
+	r := testBoundary(7, "country")
+	for _, c := range []struct {
+		format  string
+		node, r interface{}
+	}{
+		{SlashID, "node/5", "relation/7"},
+		{ShortID, "n5", "r7"},
+		{NumericID, int64(5), int64(-7)},
+	} {
+		s := Schema{IDFormat: c.format}
+		if id := s.ID(&node); id != c.node {
+			t.Errorf("%s: node id %#v, want %#v", c.format, id, c.node)
+		}
+		if id := s.ID(r); id != c.r {
+			t.Errorf("%s: relation id %#v, want %#v", c.format, id, c.r)
+		}
+	}
+}
+
+func TestSchemaFeature(t *testing.T) {
+	node := testNode(5, 0, 0)
+	// The action and area_m2 tags clash with computed properties.
+	node.Node.Tags = map[string]string{"osmid": "tag", "ele": "12.5", "ref": "007", "lanes": "2", "action": "yes", "area_m2": "3"}
+	node.Action = "modify"
+	feature := func() map[string]interface{} {
+		f := NodeElementToFeature(&node)
+		f.SetProperty("action", node.Action)
+		f.SetProperty("length_m", 0.0)
+		f.SetProperty("area_m2", 4.5)
+		return f.Properties
+	}
+	for _, c := range []struct {
+		schema Schema
+		want   map[string]interface{}
+	}{
+		{Schema{Layout: FlatLayout, IDFormat: SlashID}, map[string]interface{}{
+			"osmid": "tag", "osmType": "node", "ele": "12.5", "ref": "007", "lanes": "2",
+			"action": "modify", "length_m": 0.0, "area_m2": 4.5,
+		}},
+		{Schema{Layout: NestedLayout, IDFormat: ShortID, TypedValues: true}, map[string]interface{}{
+			"osmid": "n5", "osmType": "node", "action": "modify", "length_m": 0.0, "area_m2": 4.5,
+			"tags": map[string]interface{}{"osmid": "tag", "ele": 12.5, "ref": "007", "lanes": int64(2), "action": "yes", "area_m2": int64(3)},
+		}},
+		{Schema{Layout: PrefixedLayout, IDFormat: NumericID}, map[string]interface{}{
+			"@id": int64(5), "@type": "node", "@action": "modify", "@length_m": 0.0, "@area_m2": 4.5,
+			"osmid": "tag", "ele": "12.5", "ref": "007", "lanes": "2", "action": "yes", "area_m2": "3",
+		}},
+	} {
+		f := NodeElementToFeature(&node)
+		f.Properties = feature()
+		c.schema.Feature(f, &node)
+		if !reflect.DeepEqual(f.Properties, c.want) {
+			t.Errorf("%+v: %v, want %v", c.schema, f.Properties, c.want)
+		}
+		if f.ID != c.schema.ID(&node) {
+			t.Errorf("%+v: id %v", c.schema, f.ID)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package element
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Simplification algorithms.
+const (
+	DouglasPeucker = "dp"
+	Visvalingam    = "vw"
+)
+
+// metersPerDegree is a degree of latitude, or of longitude at the equator.
+const metersPerDegree = 6378137 * math.Pi / 180
+
+// Tolerance is a simplification tolerance in meters or degrees.
+type Tolerance struct {
+	Value  float64
+	Meters bool
+}
+
+// meters is about t in meters, degrees taken as degrees of latitude.
+func (t Tolerance) meters() float64 {
+	if t.Meters {
+		return t.Value
+	}
+	return t.Value * metersPerDegree
+}
+
+// ParseTolerance parses ex "10m" or "0.0001deg".
+func ParseTolerance(s string) (Tolerance, error) {
+	t := Tolerance{}
+	text := s
+	switch {
+	case strings.HasSuffix(text, "deg"):
+		text = strings.TrimSuffix(text, "deg")
+	case strings.HasSuffix(text, "m"):
+		text = strings.TrimSuffix(text, "m")
+		t.Meters = true
+	default:
+		return t, fmt.Errorf("invalid tolerance %q, want ex 10m or 0.0001deg", s)
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil || v < 0 {
+		return t, fmt.Errorf("invalid tolerance %q, want ex 10m or 0.0001deg", s)
+	}
+	t.Value = v
+	return t, nil
+}
+
+// SimplifyClass is the tolerance of features tagged Key=Value, any value
+// if Value is empty.
+type SimplifyClass struct {
+	Key, Value string
+	Tolerance  Tolerance
+}
+
+// ParseSimplifyClass parses ex "natural=coastline:50m" or "building:1m".
+func ParseSimplifyClass(s string) (SimplifyClass, error) {
+	c := SimplifyClass{}
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return c, fmt.Errorf("invalid tolerance class %q, want ex natural=coastline:50m", s)
+	}
+	tolerance, err := ParseTolerance(s[i+1:])
+	if err != nil {
+		return c, err
+	}
+	c.Tolerance = tolerance
+	c.Key = s[:i]
+	if j := strings.IndexByte(c.Key, '='); j >= 0 {
+		c.Key, c.Value = c.Key[:j], c.Key[j+1:]
+	}
+	return c, nil
+}
+
+// Simplifier removes vertices of feature geometries closer than a
+// tolerance to the simplified shape. Lines keep their ends and rings stay
+// closed with at least four positions: a ring that would get less, and a
+// polygon that would turn invalid even at an eighth of the tolerance, is
+// kept as is.
+type Simplifier struct {
+	// Algorithm is DouglasPeucker or Visvalingam. Visvalingam drops
+	// vertices whose triangle area is under the tolerance squared.
+	Algorithm string
+	Tolerance Tolerance
+	// Classes are tried in order before Tolerance, ex coastlines simplified
+	// more than buildings.
+	Classes []SimplifyClass
+}
+
+// Feature simplifies f in place.
+func (s *Simplifier) Feature(f *geojson.Feature) *geojson.Feature {
+	if f.Geometry == nil {
+		return f
+	}
+	if tolerance := s.tolerance(f.Properties); tolerance.Value > 0 {
+		f.Geometry = s.geometry(f.Geometry, tolerance)
+	}
+	return f
+}
+
+// tolerance is the tolerance of a feature with properties.
+func (s *Simplifier) tolerance(properties map[string]interface{}) Tolerance {
+	for _, c := range s.Classes {
+		if v, ok := properties[c.Key]; ok && (c.Value == "" || v == c.Value) {
+			return c.Tolerance
+		}
+	}
+	return s.Tolerance
+}
+
+func (s *Simplifier) geometry(g *geojson.Geometry, t Tolerance) *geojson.Geometry {
+	switch g.Type {
+	case geojson.GeometryLineString:
+		return geojson.NewLineStringGeometry(s.line(g.LineString, t, 2))
+	case geojson.GeometryMultiLineString:
+		lines := make([][][]float64, len(g.MultiLineString))
+		for i, line := range g.MultiLineString {
+			lines[i] = s.line(line, t, 2)
+		}
+		return geojson.NewMultiLineStringGeometry(lines...)
+	case geojson.GeometryPolygon, geojson.GeometryMultiPolygon:
+		wasValid := Validate(g) == nil
+		for i := 0; i < 4; i++ {
+			simplified := s.polygons(g, t)
+			if !wasValid || Validate(simplified) == nil {
+				return simplified
+			}
+			t.Value /= 2
+		}
+		return g
+	case geojson.GeometryCollection:
+		geometries := make([]*geojson.Geometry, len(g.Geometries))
+		for i, child := range g.Geometries {
+			geometries[i] = s.geometry(child, t)
+		}
+		return geojson.NewCollectionGeometry(geometries...)
+	}
+	return g
+}
+
+func (s *Simplifier) polygons(g *geojson.Geometry, t Tolerance) *geojson.Geometry {
+	simplify := func(polygon [][][]float64) [][][]float64 {
+		out := make([][][]float64, len(polygon))
+		for i, ring := range polygon {
+			out[i] = s.line(ring, t, 4)
+		}
+		return out
+	}
+	if g.Type == geojson.GeometryPolygon {
+		return geojson.NewPolygonGeometry(simplify(g.Polygon))
+	}
+	polygons := make([][][][]float64, len(g.MultiPolygon))
+	for i, polygon := range g.MultiPolygon {
+		polygons[i] = simplify(polygon)
+	}
+	return geojson.NewMultiPolygonGeometry(polygons...)
+}
+
+// line simplifies coords, returned as is if less than min positions would
+// be left.
+func (s *Simplifier) line(coords [][]float64, t Tolerance, min int) [][]float64 {
+	if len(coords) <= min {
+		return coords
+	}
+	// Meters on a plane tangent at the first latitude, good enough for the
+	// size of a feature.
+	points := coords
+	tolerance := t.Value
+	if t.Meters {
+		scale := math.Cos(coords[0][1] * math.Pi / 180)
+		points = make([][]float64, len(coords))
+		for i, p := range coords {
+			points[i] = []float64{p[0] * scale * metersPerDegree, p[1] * metersPerDegree}
+		}
+	}
+	var keep []bool
+	if s.Algorithm == Visvalingam {
+		keep = visvalingam(points, tolerance*tolerance, min)
+	} else {
+		keep = douglasPeucker(points, tolerance)
+	}
+	var out [][]float64
+	for i, k := range keep {
+		if k {
+			out = append(out, coords[i])
+		}
+	}
+	if len(out) < min {
+		return coords
+	}
+	return out
+}
+
+// douglasPeucker marks the positions to keep.
+func douglasPeucker(points [][]float64, tolerance float64) []bool {
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	// Iterative, coastlines have a lot of positions.
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		farthest, distance := -1, tolerance
+		for i := span[0] + 1; i < span[1]; i++ {
+			if d := segmentDistance(points[i], points[span[0]], points[span[1]]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{span[0], farthest}, [2]int{farthest, span[1]})
+		}
+	}
+	return keep
+}
+
+// segmentDistance is the distance of p to segment ab, to a if a is b like
+// the ends of a ring.
+func segmentDistance(p, a, b []float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l))
+	}
+	return math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+}
+
+// vwVertex is a position in the Visvalingam heap, linked to its
+// neighbours still kept.
+type vwVertex struct {
+	i, prev, next int
+	area          float64
+	index         int
+}
+
+type vwHeap []*vwVertex
+
+func (h vwHeap) Len() int           { return len(h) }
+func (h vwHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vwHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *vwHeap) Push(x interface{}) {
+	v := x.(*vwVertex)
+	v.index = len(*h)
+	*h = append(*h, v)
+}
+func (h *vwHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// visvalingam marks the positions to keep, dropping the one with the
+// smallest triangle until it's over minArea or min are left.
+func visvalingam(points [][]float64, minArea float64, min int) []bool {
+	n := len(points)
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	vertices := make([]*vwVertex, n)
+	h := make(vwHeap, 0, n)
+	triangle := func(v *vwVertex) float64 {
+		a, b, c := points[v.prev], points[v.i], points[v.next]
+		return math.Abs((b[0]-a[0])*(c[1]-a[1])-(c[0]-a[0])*(b[1]-a[1])) / 2
+	}
+	for i := 1; i < n-1; i++ {
+		vertices[i] = &vwVertex{i: i, prev: i - 1, next: i + 1}
+		vertices[i].area = triangle(vertices[i])
+		heap.Push(&h, vertices[i])
+	}
+	left := n
+	for h.Len() > 0 && left > min {
+		v := heap.Pop(&h).(*vwVertex)
+		if v.area >= minArea {
+			break
+		}
+		keep[v.i] = false
+		left--
+		// Neighbour areas don't go under the dropped one, as in the paper,
+		// so they are dropped after it.
+		for _, j := range []int{v.prev, v.next} {
+			u := vertices[j]
+			if u == nil {
+				continue
+			}
+			if j == v.prev {
+				u.next = v.next
+			} else {
+				u.prev = v.prev
+			}
+			u.area = math.Max(triangle(u), v.area)
+			heap.Fix(&h, u.index)
+		}
+	}
+	return keep
+}
@@ -0,0 +1,110 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"testing"
+)
+
+func TestParseSimplifyClass(t *testing.T) {
+	c, err := ParseSimplifyClass("natural=coastline:50m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SimplifyClass{Key: "natural", Value: "coastline", Tolerance: Tolerance{Value: 50, Meters: true}}); c != want {
+		t.Errorf("class %+v, want %+v", c, want)
+	}
+	c, err = ParseSimplifyClass("building:0.00001deg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SimplifyClass{Key: "building", Tolerance: Tolerance{Value: 0.00001}}); c != want {
+		t.Errorf("class %+v, want %+v", c, want)
+	}
+	for _, s := range []string{"building", "building:5", "building:-1m", ":5m"} {
+		if _, err := ParseSimplifyClass(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
+
+func TestSimplifyLine(t *testing.T) {
+	// A zigzag of 1e-5 degrees, about 1.1m, along the equator.
+	var line [][]float64
+	for i := 0; i <= 10; i++ {
+		line = append(line, []float64{float64(i) * 0.001, float64(i%2) * 0.00001})
+	}
+	// Visvalingam compares triangle areas, growing to 1.1km by 1.1m here.
+	for algorithm, tolerance := range map[string]float64{DouglasPeucker: 2, Visvalingam: 30} {
+		s := &Simplifier{Algorithm: algorithm, Tolerance: Tolerance{Value: tolerance, Meters: true}}
+		f := s.Feature(geojson.NewLineStringFeature(line))
+		if want := [][]float64{line[0], line[10]}; !reflect.DeepEqual(f.Geometry.LineString, want) {
+			t.Errorf("%s: %v, want %v", algorithm, f.Geometry.LineString, want)
+		}
+		s.Tolerance = Tolerance{Value: 0.5, Meters: true}
+		if f := s.Feature(geojson.NewLineStringFeature(line)); len(f.Geometry.LineString) != len(line) {
+			t.Errorf("%s: zigzag over tolerance simplified to %v", algorithm, f.Geometry.LineString)
+		}
+	}
+}
+
+func TestSimplifyClasses(t *testing.T) {
+	line := [][]float64{{0, 0}, {0.001, 0.00001}, {0.002, 0}}
+	s := &Simplifier{
+		Algorithm: DouglasPeucker,
+		Tolerance: Tolerance{Value: 0.1, Meters: true},
+		Classes: []SimplifyClass{
+			{Key: "natural", Value: "coastline", Tolerance: Tolerance{Value: 0.0001}},
+		},
+	}
+	coast := geojson.NewLineStringFeature(line)
+	coast.SetProperty("natural", "coastline")
+	if f := s.Feature(coast); len(f.Geometry.LineString) != 2 {
+		t.Errorf("coastline not simplified: %v", f.Geometry.LineString)
+	}
+	wood := geojson.NewLineStringFeature(line)
+	wood.SetProperty("natural", "wood")
+	if f := s.Feature(wood); len(f.Geometry.LineString) != 3 {
+		t.Errorf("wood simplified: %v", f.Geometry.LineString)
+	}
+}
+
+func TestSimplifyRings(t *testing.T) {
+	for algorithm, tolerance := range map[string]float64{DouglasPeucker: 0.5, Visvalingam: 1} {
+		s := &Simplifier{Algorithm: algorithm, Tolerance: Tolerance{Value: tolerance}}
+
+		// Small rings don't collapse.
+		f := s.Feature(geojson.NewPolygonFeature([][][]float64{square(0, 0, 0.1)}))
+		if ring := f.Geometry.Polygon[0]; len(ring) < 4 || !reflect.DeepEqual(ring[0], ring[len(ring)-1]) {
+			t.Errorf("%s: small ring collapsed: %v", algorithm, ring)
+		}
+
+		// Positions on the edges go, the ring stays closed.
+		ring := [][]float64{{0, 0}, {5, 0.1}, {10, 0}, {10, 10}, {5, 9.9}, {0, 10}, {0, 0}}
+		f = s.Feature(geojson.NewPolygonFeature([][][]float64{ring}))
+		if want := square(0, 0, 10); !reflect.DeepEqual(sortRing(f.Geometry.Polygon[0]), sortRing(want)) {
+			t.Errorf("%s: ring %v, want %v", algorithm, f.Geometry.Polygon[0], want)
+		}
+
+		// Simplifying the shell alone would leave the hole sticking out.
+		shell := [][]float64{{0, 0}, {10, 0}, {10, 10}, {5, 10.4}, {0, 10}, {0, 0}}
+		hole := [][]float64{{4, 9}, {6, 9}, {6, 10.2}, {5, 10.3}, {4, 10.2}, {4, 9}}
+		s.Tolerance = Tolerance{Value: 3 * tolerance}
+		f = s.Feature(geojson.NewPolygonFeature([][][]float64{shell, hole}))
+		if err := Validate(f.Geometry); err != nil {
+			t.Errorf("%s: simplified polygon invalid, %v: %v", algorithm, err, f.Geometry.Polygon)
+		}
+	}
+}
+
+// sortRing is ring from its lowest position, to compare rings.
+func sortRing(ring [][]float64) [][]float64 {
+	low := 0
+	for i, p := range ring[:len(ring)-1] {
+		if p[0] < ring[low][0] || (p[0] == ring[low][0] && p[1] < ring[low][1]) {
+			low = i
+		}
+	}
+	out := append(append([][]float64{}, ring[low:len(ring)-1]...), ring[:low]...)
+	return append(out, out[0])
+}
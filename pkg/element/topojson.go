@@ -0,0 +1,460 @@
+package element
+
+import (
+	"encoding/json"
+	"github.com/paulmach/go.geojson"
+	"math"
+)
+
+// Topology builds a TopoJSON topology: every way is an arc, shared by the
+// features using it, ex the border ways of adjacent admin boundaries, so
+// simplification and quantization keep shared borders identical.
+// Features are kept in memory until marshaled.
+type Topology struct {
+	// Name of the GeometryCollection of the features in objects.
+	Name string
+	// Quantization is the number of grid steps of quantized coordinates,
+	// ex 1e5, 0 writes them as they are.
+	Quantization int
+	// Simplifier, if any, simplifies each arc once at the smallest
+	// tolerance of its features. Arc ends and positions shared with other
+	// arcs are kept.
+	Simplifier *Simplifier
+	// Schema, if any, lays out feature ids and properties.
+	Schema *Schema
+
+	arcs       [][][]float64
+	arcIDs     map[int64]int
+	tolerances []*Tolerance
+	// minPositions keeps rings from collapsing when simplified.
+	minPositions []int
+	geometries   []*topoGeometry
+}
+
+// NewTopology .
+func NewTopology(name string) *Topology {
+	return &Topology{Name: name, arcIDs: map[int64]int{}}
+}
+
+type topoGeometry struct {
+	Type        string                 `json:"type"`
+	ID          interface{}            `json:"id,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+	Coordinates []float64              `json:"coordinates,omitempty"`
+	Arcs        interface{}            `json:"arcs,omitempty"`
+	Geometries  []*topoGeometry        `json:"geometries,omitempty"`
+}
+
+type topoTransform struct {
+	Scale     [2]float64 `json:"scale"`
+	Translate [2]float64 `json:"translate"`
+}
+
+// Add adds e as a feature, with the properties of its GeoJSON feature.
+// Like RelationElementToFeature, type=multipolygon relations are areas,
+// and so are type=boundary ones. Their rings are chained from the outer
+// and inner member ways, unclosed ones are left out.
+func (t *Topology) Add(e *Element) {
+	var properties map[string]interface{}
+	switch e.Type {
+	case "Node":
+		properties = NodeElementToFeature(e).Properties
+	case "Way":
+		properties = WayElementToFeature(e).Properties
+	case "Relation":
+		properties = relationProperties(e)
+	default:
+		return
+	}
+	var tolerance *Tolerance
+	if t.Simplifier != nil {
+		tol := t.Simplifier.tolerance(properties)
+		tolerance = &tol
+	}
+	var g *topoGeometry
+	switch e.Type {
+	case "Node":
+		g = t.node(e)
+	case "Way":
+		g = t.way(e, tolerance)
+	case "Relation":
+		g = t.relation(e, tolerance)
+	}
+	if g == nil {
+		return
+	}
+	if t.Schema != nil {
+		f := t.Schema.Feature(&geojson.Feature{Properties: properties}, e)
+		g.ID, g.Properties = f.ID, f.Properties
+	} else {
+		g.ID, g.Properties = properties["osmid"], properties
+	}
+	t.geometries = append(t.geometries, g)
+}
+
+// relationProperties are the properties of RelationElementToFeature,
+// without converting the members.
+func relationProperties(e *Element) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for k, v := range e.Relation.Tags {
+		properties[k] = v
+	}
+	osmID := OSMID("relation", e.Relation.ID)
+	properties["osmid"] = osmID
+	properties["osmType"] = "relation"
+	return properties
+}
+
+func (t *Topology) node(e *Element) *topoGeometry {
+	return &topoGeometry{Type: "Point", Coordinates: []float64{e.Node.Lon, e.Node.Lat}}
+}
+
+// arc returns the arc of way e, added on first use, -1 if it has less than
+// two nodes.
+func (t *Topology) arc(e *Element, tolerance *Tolerance) int {
+	i, ok := t.arcIDs[e.Way.ID]
+	if !ok {
+		if len(e.Elements) < 2 {
+			return -1
+		}
+		positions := make([][]float64, len(e.Elements))
+		for j, n := range e.Elements {
+			positions[j] = []float64{n.Node.Lon, n.Node.Lat}
+		}
+		i = len(t.arcs)
+		t.arcs = append(t.arcs, positions)
+		t.tolerances = append(t.tolerances, nil)
+		t.minPositions = append(t.minPositions, 2)
+		if samePosition(positions[0], positions[len(positions)-1]) {
+			t.minPositions[i] = 4
+		}
+		t.arcIDs[e.Way.ID] = i
+	}
+	t.useTolerance(i, tolerance)
+	return i
+}
+
+// useTolerance keeps the smallest tolerance of the features using arc i.
+func (t *Topology) useTolerance(i int, tolerance *Tolerance) {
+	if tolerance == nil {
+		return
+	}
+	if current := t.tolerances[i]; current == nil || tolerance.meters() < current.meters() {
+		t.tolerances[i] = tolerance
+	}
+}
+
+func (t *Topology) way(e *Element, tolerance *Tolerance) *topoGeometry {
+	i := t.arc(e, tolerance)
+	if i < 0 {
+		return nil
+	}
+	nodes := e.Elements
+	if e.IsArea() && nodes[0].Node.ID == nodes[len(nodes)-1].Node.ID {
+		return &topoGeometry{Type: "Polygon", Arcs: [][]int{t.orient([]int{i}, true)}}
+	}
+	return &topoGeometry{Type: "LineString", Arcs: []int{i}}
+}
+
+func (t *Topology) relation(e *Element, tolerance *Tolerance) *topoGeometry {
+	if v := e.Relation.Tags["type"]; v == "multipolygon" || v == "boundary" {
+		return t.area(e, tolerance)
+	}
+	var geometries []*topoGeometry
+	for i := range e.Elements {
+		member := &e.Elements[i]
+		var g *topoGeometry
+		switch member.Type {
+		case "Node":
+			g = t.node(member)
+		case "Way":
+			g = t.way(member, tolerance)
+		case "Relation":
+			g = t.relation(member, tolerance)
+		}
+		if g != nil {
+			geometries = append(geometries, g)
+		}
+	}
+	if len(geometries) == 0 {
+		return nil
+	}
+	return &topoGeometry{Type: "GeometryCollection", Geometries: geometries}
+}
+
+// ringWay is a member way of an area, by its end nodes.
+type ringWay struct {
+	arc         int
+	first, last int64
+	outer       bool
+}
+
+// area chains the outer and inner ways of e into rings, outer rings
+// counterclockwise and inner ones clockwise, each inner ring in the
+// smallest outer ring around it.
+func (t *Topology) area(e *Element, tolerance *Tolerance) *topoGeometry {
+	var ways []ringWay
+	for i := range e.Elements {
+		member := &e.Elements[i]
+		if member.Type != "Way" || (member.Role != "outer" && member.Role != "inner" && member.Role != "") {
+			continue
+		}
+		arc := t.arc(member, tolerance)
+		if arc < 0 {
+			continue
+		}
+		nodes := member.Elements
+		ways = append(ways, ringWay{
+			arc:   arc,
+			first: nodes[0].Node.ID,
+			last:  nodes[len(nodes)-1].Node.ID,
+			outer: member.Role != "inner",
+		})
+	}
+
+	used := make([]bool, len(ways))
+	var outers, inners [][]int
+	for start := range ways {
+		if used[start] {
+			continue
+		}
+		used[start] = true
+		ring := []int{ways[start].arc}
+		begin, end := ways[start].first, ways[start].last
+		for end != begin {
+			found := false
+			for i, w := range ways {
+				if used[i] || w.outer != ways[start].outer {
+					continue
+				}
+				switch end {
+				case w.first:
+					ring, end = append(ring, w.arc), w.last
+				case w.last:
+					ring, end = append(ring, ^w.arc), w.first
+				default:
+					continue
+				}
+				used[i], found = true, true
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		if end != begin {
+			continue
+		}
+		if len(ring) == 2 {
+			for _, arc := range ring {
+				if arc < 0 {
+					arc = ^arc
+				}
+				if t.minPositions[arc] < 3 {
+					t.minPositions[arc] = 3
+				}
+			}
+		}
+		if ways[start].outer {
+			outers = append(outers, t.orient(ring, true))
+		} else {
+			inners = append(inners, t.orient(ring, false))
+		}
+	}
+	if len(outers) == 0 {
+		return nil
+	}
+
+	polygons := make([][][]int, len(outers))
+	outerRings := make([][][]float64, len(outers))
+	for i, outer := range outers {
+		polygons[i] = [][]int{outer}
+		outerRings[i] = t.ringPositions(outer)
+	}
+	for _, inner := range inners {
+		p := t.ringPositions(inner)[0]
+		best, bestArea := -1, math.Inf(1)
+		for i, ring := range outerRings {
+			if area := ringArea(ring); area < bestArea && ringContains(ring, p) {
+				best, bestArea = i, area
+			}
+		}
+		if best >= 0 {
+			polygons[best] = append(polygons[best], inner)
+		}
+	}
+	if len(polygons) == 1 {
+		return &topoGeometry{Type: "Polygon", Arcs: polygons[0]}
+	}
+	return &topoGeometry{Type: "MultiPolygon", Arcs: polygons}
+}
+
+// ringPositions are the positions of a ring of arcs, ~i is arc i reversed.
+func (t *Topology) ringPositions(ring []int) [][]float64 {
+	var positions [][]float64
+	for _, i := range ring {
+		var arc [][]float64
+		if i >= 0 {
+			arc = t.arcs[i]
+		} else {
+			arc = t.arcs[^i]
+			reversed := make([][]float64, len(arc))
+			for j, p := range arc {
+				reversed[len(arc)-1-j] = p
+			}
+			arc = reversed
+		}
+		if len(positions) > 0 {
+			arc = arc[1:]
+		}
+		positions = append(positions, arc...)
+	}
+	return positions
+}
+
+// orient returns ring counterclockwise, or clockwise if not ccw.
+func (t *Topology) orient(ring []int, ccw bool) []int {
+	if (ringArea(t.ringPositions(ring)) > 0) == ccw {
+		return ring
+	}
+	reversed := make([]int, len(ring))
+	for i, arc := range ring {
+		reversed[len(ring)-1-i] = ^arc
+	}
+	return reversed
+}
+
+// MarshalJSON writes the topology, simplified and quantized.
+func (t *Topology) MarshalJSON() ([]byte, error) {
+	arcs := t.arcs
+	if t.Simplifier != nil {
+		arcs = t.simplifiedArcs()
+	}
+
+	west, south := math.Inf(1), math.Inf(1)
+	east, north := math.Inf(-1), math.Inf(-1)
+	extend := func(p []float64) {
+		west, east = math.Min(west, p[0]), math.Max(east, p[0])
+		south, north = math.Min(south, p[1]), math.Max(north, p[1])
+	}
+	for _, arc := range arcs {
+		for _, p := range arc {
+			extend(p)
+		}
+	}
+	var points []*topoGeometry
+	var collect func(gs []*topoGeometry)
+	collect = func(gs []*topoGeometry) {
+		for _, g := range gs {
+			if g.Coordinates != nil {
+				extend(g.Coordinates)
+				points = append(points, g)
+			}
+			collect(g.Geometries)
+		}
+	}
+	collect(t.geometries)
+
+	topology := struct {
+		Type      string                 `json:"type"`
+		BBox      []float64              `json:"bbox,omitempty"`
+		Transform *topoTransform         `json:"transform,omitempty"`
+		Objects   map[string]interface{} `json:"objects"`
+		Arcs      interface{}            `json:"arcs"`
+	}{
+		Type: "Topology",
+		Objects: map[string]interface{}{
+			t.Name: &topoGeometry{Type: "GeometryCollection", Geometries: t.geometries},
+		},
+		Arcs: arcs,
+	}
+	if t.geometries == nil {
+		topology.Objects[t.Name] = json.RawMessage(`{"type":"GeometryCollection","geometries":[]}`)
+	}
+	if west > east {
+		topology.Arcs = [][][]float64{}
+		return json.Marshal(topology)
+	}
+	topology.BBox = []float64{west, south, east, north}
+	if t.Quantization < 2 {
+		return json.Marshal(topology)
+	}
+
+	// Quantized positions, arcs delta-encoded.
+	transform := &topoTransform{Translate: [2]float64{west, south}}
+	transform.Scale = [2]float64{1, 1}
+	if east > west {
+		transform.Scale[0] = (east - west) / float64(t.Quantization-1)
+	}
+	if north > south {
+		transform.Scale[1] = (north - south) / float64(t.Quantization-1)
+	}
+	quantize := func(p []float64) [2]int {
+		return [2]int{
+			int(math.Round((p[0] - west) / transform.Scale[0])),
+			int(math.Round((p[1] - south) / transform.Scale[1])),
+		}
+	}
+	quantized := make([][][2]int, len(arcs))
+	for i, arc := range arcs {
+		var prev [2]int
+		for j, p := range arc {
+			q := quantize(p)
+			// Positions on the same grid cell go, but an arc keeps two.
+			if j > 0 && q == prev && (j < len(arc)-1 || len(quantized[i]) > 1) {
+				continue
+			}
+			quantized[i] = append(quantized[i], [2]int{q[0] - prev[0], q[1] - prev[1]})
+			prev = q
+		}
+	}
+	for _, g := range points {
+		defer func(g *topoGeometry, coordinates []float64) { g.Coordinates = coordinates }(g, g.Coordinates)
+		q := quantize(g.Coordinates)
+		g.Coordinates = []float64{float64(q[0]), float64(q[1])}
+	}
+	topology.Transform = transform
+	topology.Arcs = quantized
+	return json.Marshal(topology)
+}
+
+// simplifiedArcs simplifies arcs between the positions they share.
+func (t *Topology) simplifiedArcs() [][][]float64 {
+	uses := map[[2]float64]int{}
+	for _, arc := range t.arcs {
+		for j, p := range arc {
+			if j == len(arc)-1 && samePosition(p, arc[0]) {
+				continue
+			}
+			key := [2]float64{p[0], p[1]}
+			uses[key]++
+			if j == 0 || j == len(arc)-1 {
+				// Arc ends are always kept.
+				uses[key]++
+			}
+		}
+	}
+	arcs := make([][][]float64, len(t.arcs))
+	for i, arc := range t.arcs {
+		tolerance := t.tolerances[i]
+		if tolerance == nil || tolerance.Value == 0 {
+			arcs[i] = arc
+			continue
+		}
+		out := [][]float64{arc[0]}
+		start := 0
+		for j := 1; j < len(arc); j++ {
+			if j < len(arc)-1 && uses[[2]float64{arc[j][0], arc[j][1]}] < 2 {
+				continue
+			}
+			piece := t.Simplifier.line(arc[start:j+1], *tolerance, 2)
+			out = append(out, piece[1:]...)
+			start = j
+		}
+		if len(out) < t.minPositions[i] {
+			out = arc
+		}
+		arcs[i] = out
+	}
+	return arcs
+}
@@ -0,0 +1,137 @@
+package element
+
+import (
+	"encoding/json"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testNode(id int64, lon, lat float64) Element {
+	return Element{Type: "Node", Node: gosmparse.Node{Element: gosmparse.Element{ID: id}, Lon: lon, Lat: lat}}
+}
+
+func testWay(id int64, role string, nodes ...Element) Element {
+	return Element{Type: "Way", Role: role, Way: gosmparse.Way{Element: gosmparse.Element{ID: id}}, Elements: nodes}
+}
+
+func testBoundary(id int64, name string, ways ...Element) *Element {
+	return &Element{
+		Type: "Relation",
+		Relation: gosmparse.Relation{Element: gosmparse.Element{
+			ID:   id,
+			Tags: map[string]string{"type": "boundary", "name": name},
+		}},
+		Elements: ways,
+	}
+}
+
+// topoJSON is the decoded output of a topology.
+type topoJSON struct {
+	Transform *topoTransform
+	Objects   map[string]struct {
+		Geometries []struct {
+			Type       string
+			ID         string
+			Arcs       json.RawMessage
+			Properties map[string]interface{}
+		}
+	}
+	Arcs [][][]float64
+}
+
+func marshalTopology(t *testing.T, topology *Topology) topoJSON {
+	b, err := json.Marshal(topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out topoJSON
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// twoCountries are two boundaries sharing the border way 10 from (1, 0)
+// to (1, 2), with a wiggle at (1.0001, 1) and the junction of way 13 at
+// (1, 0.5).
+func twoCountries() (*Element, *Element) {
+	a, b := testNode(1, 1, 0), testNode(2, 1, 2)
+	border := testWay(10, "outer", a, testNode(3, 1, 0.5), testNode(4, 1.0001, 1), b)
+	west := testWay(11, "outer", b, testNode(5, 0, 2), testNode(6, 0, 0), a)
+	east := testWay(12, "outer", a, testNode(7, 2, 0), testNode(8, 2, 2), b)
+	return testBoundary(1, "west", border, west), testBoundary(2, "east", border, east)
+}
+
+func TestTopologySharedArcs(t *testing.T) {
+	topology := NewTopology("osm")
+	west, east := twoCountries()
+	topology.Add(west)
+	topology.Add(east)
+	out := marshalTopology(t, topology)
+
+	if len(out.Arcs) != 3 {
+		t.Fatalf("%d arcs, want 3", len(out.Arcs))
+	}
+	geometries := out.Objects["osm"].Geometries
+	if len(geometries) != 2 || geometries[0].ID != "relation/1" || geometries[0].Properties["name"] != "west" {
+		t.Fatalf("geometries %+v", geometries)
+	}
+	var westArcs, eastArcs [][]int
+	json.Unmarshal(geometries[0].Arcs, &westArcs)
+	json.Unmarshal(geometries[1].Arcs, &eastArcs)
+	if geometries[0].Type != "Polygon" || len(westArcs) != 1 || len(eastArcs) != 1 {
+		t.Fatalf("polygons %s %s", geometries[0].Arcs, geometries[1].Arcs)
+	}
+	// Both rings are counterclockwise, so the border goes both ways.
+	if !reflect.DeepEqual(westArcs[0], []int{0, 1}) || !reflect.DeepEqual(eastArcs[0], []int{2, ^0}) {
+		t.Errorf("rings %v %v", westArcs, eastArcs)
+	}
+}
+
+func TestTopologySimplify(t *testing.T) {
+	topology := NewTopology("osm")
+	topology.Simplifier = &Simplifier{Algorithm: DouglasPeucker, Tolerance: Tolerance{Value: 0.01}}
+	west, east := twoCountries()
+	topology.Add(west)
+	topology.Add(east)
+	// A way ending on the border keeps its junction.
+	topology.Add(&Element{
+		Type:     "Way",
+		Way:      gosmparse.Way{Element: gosmparse.Element{ID: 13, Tags: map[string]string{"highway": "primary"}}},
+		Elements: []Element{testNode(9, 1.5, 0.5), testNode(3, 1, 0.5)},
+	})
+	out := marshalTopology(t, topology)
+	if want := [][]float64{{1, 0}, {1, 0.5}, {1, 2}}; !reflect.DeepEqual(out.Arcs[0], want) {
+		t.Errorf("border %v, want %v", out.Arcs[0], want)
+	}
+}
+
+func TestTopologyQuantization(t *testing.T) {
+	topology := NewTopology("osm")
+	topology.Quantization = 1e4
+	west, east := twoCountries()
+	topology.Add(west)
+	topology.Add(east)
+	out := marshalTopology(t, topology)
+	if out.Transform == nil {
+		t.Fatal("no transform")
+	}
+	// Decode the delta-encoded border.
+	var x, y float64
+	var border [][]float64
+	for _, d := range out.Arcs[0] {
+		x, y = x+d[0], y+d[1]
+		border = append(border, []float64{
+			x*out.Transform.Scale[0] + out.Transform.Translate[0],
+			y*out.Transform.Scale[1] + out.Transform.Translate[1],
+		})
+	}
+	want := [][]float64{{1, 0}, {1, 0.5}, {1.0001, 1}, {1, 2}}
+	for i, p := range want {
+		if i >= len(border) || math.Abs(border[i][0]-p[0]) > 2e-4 || math.Abs(border[i][1]-p[1]) > 2e-4 {
+			t.Fatalf("border %v, want %v", border, want)
+		}
+	}
+}
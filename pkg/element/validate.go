@@ -0,0 +1,352 @@
+package element
+
+import (
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"math"
+	"sort"
+)
+
+// Validity error reasons, worded like GEOS IsValidReason.
+const (
+	InvalidCoordinate    = "Invalid Coordinate"
+	TooFewPoints         = "Too few points in geometry component"
+	RingNotClosed        = "Ring is not closed"
+	RingSelfIntersection = "Ring Self-intersection"
+	SelfIntersection     = "Self-intersection"
+	HoleOutsideShell     = "Hole lies outside shell"
+	NestedHoles          = "Holes are nested"
+	NestedShells         = "Nested shells"
+)
+
+// ValidityError is an OGC validity error of a geometry at Location.
+type ValidityError struct {
+	Reason   string
+	Location []float64
+}
+
+func (e *ValidityError) Error() string {
+	if e.Location == nil {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s at %v", e.Reason, e.Location)
+}
+
+// Validate returns the first OGC validity error of g, nil if it's valid.
+// Rings may touch other rings at points but not cross or share edges,
+// holes must be inside their shell and shells outside each other.
+// Ring orientation isn't checked, RFC7946 fixes it.
+func Validate(g *geojson.Geometry) *ValidityError {
+	switch g.Type {
+	case geojson.GeometryPoint:
+		return validPositions([][]float64{g.Point})
+	case geojson.GeometryMultiPoint:
+		return validPositions(g.MultiPoint)
+	case geojson.GeometryLineString:
+		return validLine(g.LineString)
+	case geojson.GeometryMultiLineString:
+		for _, line := range g.MultiLineString {
+			if err := validLine(line); err != nil {
+				return err
+			}
+		}
+	case geojson.GeometryPolygon:
+		return validPolygons([][][][]float64{g.Polygon})
+	case geojson.GeometryMultiPolygon:
+		return validPolygons(g.MultiPolygon)
+	case geojson.GeometryCollection:
+		for _, child := range g.Geometries {
+			if err := Validate(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validPositions(positions [][]float64) *ValidityError {
+	for _, p := range positions {
+		if !validPosition(p) {
+			return &ValidityError{Reason: InvalidCoordinate, Location: p}
+		}
+	}
+	return nil
+}
+
+func validPosition(p []float64) bool {
+	return len(p) >= 2 && !math.IsNaN(p[0]) && !math.IsNaN(p[1]) && !math.IsInf(p[0], 0) && !math.IsInf(p[1], 0)
+}
+
+func validLine(line [][]float64) *ValidityError {
+	if err := validPositions(line); err != nil {
+		return err
+	}
+	if len(dedup(line)) < 2 {
+		return &ValidityError{Reason: TooFewPoints, Location: firstPosition(line)}
+	}
+	return nil
+}
+
+func firstPosition(coords [][]float64) []float64 {
+	if len(coords) == 0 {
+		return nil
+	}
+	return coords[0]
+}
+
+// dedup drops repeated positions.
+func dedup(coords [][]float64) [][]float64 {
+	out := make([][]float64, 0, len(coords))
+	for _, p := range coords {
+		if n := len(out); n > 0 && samePosition(out[n-1], p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func samePosition(a, b []float64) bool {
+	return a[0] == b[0] && a[1] == b[1]
+}
+
+func validPolygons(polygons [][][][]float64) *ValidityError {
+	var rings [][][]float64
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			if err := validPositions(ring); err != nil {
+				return err
+			}
+			r := dedup(ring)
+			if len(r) < 4 {
+				return &ValidityError{Reason: TooFewPoints, Location: firstPosition(ring)}
+			}
+			if !samePosition(r[0], r[len(r)-1]) {
+				return &ValidityError{Reason: RingNotClosed, Location: r[0]}
+			}
+			rings = append(rings, r)
+		}
+	}
+
+	// Crossings, rings of every polygon at once.
+	var segs []segment
+	for i, ring := range rings {
+		segs = append(segs, ringSegments(ring, i)...)
+	}
+	var err *ValidityError
+	sweep(segs, func(i, j int, points [][]float64) bool {
+		s, t := &segs[i], &segs[j]
+		switch {
+		case s.ring == t.ring && adjacent(s, t):
+			// Only a spike folds back over the shared vertex.
+			if len(points) > 1 {
+				err = &ValidityError{Reason: RingSelfIntersection, Location: points[1]}
+			}
+		case s.ring == t.ring:
+			err = &ValidityError{Reason: RingSelfIntersection, Location: points[0]}
+		case len(points) > 1:
+			err = &ValidityError{Reason: SelfIntersection, Location: points[0]}
+		case !isEndpoint(points[0], s) && !isEndpoint(points[0], t):
+			err = &ValidityError{Reason: SelfIntersection, Location: points[0]}
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Rings don't cross, one position off the other ring tells which is in.
+	next := 0
+	shells := make([][][]float64, len(polygons))
+	holes := make([][][][]float64, len(polygons))
+	for i, polygon := range polygons {
+		shells[i] = rings[next]
+		holes[i] = rings[next+1 : next+len(polygon)]
+		next += len(polygon)
+	}
+	for i, shell := range shells {
+		for j, hole := range holes[i] {
+			if p := offRing(hole, shell); p != nil && !ringContains(shell, p) {
+				return &ValidityError{Reason: HoleOutsideShell, Location: p}
+			}
+			for _, other := range holes[i][j+1:] {
+				if p := offRing(hole, other); p != nil && ringContains(other, p) {
+					return &ValidityError{Reason: NestedHoles, Location: p}
+				}
+				if p := offRing(other, hole); p != nil && ringContains(hole, p) {
+					return &ValidityError{Reason: NestedHoles, Location: p}
+				}
+			}
+		}
+		for j, other := range shells {
+			if j == i {
+				continue
+			}
+			p := offRing(shell, other)
+			if p == nil || !ringContains(other, p) {
+				continue
+			}
+			inHole := false
+			for _, hole := range holes[j] {
+				if ringContains(hole, p) || onRing(p, hole) {
+					inHole = true
+				}
+			}
+			if !inHole {
+				return &ValidityError{Reason: NestedShells, Location: p}
+			}
+		}
+	}
+	return nil
+}
+
+// offRing returns a position of ring not on other, nil if there's none.
+func offRing(ring, other [][]float64) []float64 {
+	for _, p := range ring {
+		if !onRing(p, other) {
+			return p
+		}
+	}
+	return nil
+}
+
+func onRing(p []float64, ring [][]float64) bool {
+	for i := 0; i < len(ring)-1; i++ {
+		if onSegment(p, ring[i], ring[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains tells if p is inside ring, even-odd.
+func ringContains(ring [][]float64, p []float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, c := ring[i], ring[j]
+		if (a[1] > p[1]) != (c[1] > p[1]) &&
+			p[0] < (c[0]-a[0])*(p[1]-a[1])/(c[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// segment is an edge of ring, the index-th of size.
+type segment struct {
+	a, b              []float64
+	ring, index, size int
+}
+
+func ringSegments(ring [][]float64, ringIndex int) []segment {
+	segs := make([]segment, 0, len(ring)-1)
+	for i := 0; i < len(ring)-1; i++ {
+		segs = append(segs, segment{a: ring[i], b: ring[i+1], ring: ringIndex, index: i, size: len(ring) - 1})
+	}
+	return segs
+}
+
+func adjacent(s, t *segment) bool {
+	d := s.index - t.index
+	return d == 1 || d == -1 || d == s.size-1 || d == 1-s.size
+}
+
+func isEndpoint(p []float64, s *segment) bool {
+	return samePosition(p, s.a) || samePosition(p, s.b)
+}
+
+// sweep calls found with the indexes and intersection points of every
+// pair of segments that meet, until it returns false. segs is sorted by
+// west end first, to only compare those overlapping in longitude.
+func sweep(segs []segment, found func(i, j int, points [][]float64) bool) {
+	sort.Slice(segs, func(i, j int) bool {
+		return math.Min(segs[i].a[0], segs[i].b[0]) < math.Min(segs[j].a[0], segs[j].b[0])
+	})
+	for i := range segs {
+		s := &segs[i]
+		east := math.Max(s.a[0], s.b[0])
+		south, north := math.Min(s.a[1], s.b[1]), math.Max(s.a[1], s.b[1])
+		for j := i + 1; j < len(segs); j++ {
+			t := &segs[j]
+			if math.Min(t.a[0], t.b[0]) > east {
+				break
+			}
+			if math.Max(t.a[1], t.b[1]) < south || math.Min(t.a[1], t.b[1]) > north {
+				continue
+			}
+			if points := segmentIntersection(s.a, s.b, t.a, t.b); len(points) > 0 {
+				if !found(i, j, points) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// segmentIntersection returns where ab and cd meet: nothing, a point, or
+// both ends of a collinear overlap.
+func segmentIntersection(a, b, c, d []float64) [][]float64 {
+	r := []float64{b[0] - a[0], b[1] - a[1]}
+	s := []float64{d[0] - c[0], d[1] - c[1]}
+	qp := []float64{c[0] - a[0], c[1] - a[1]}
+	den := cross(r, s)
+	if den != 0 {
+		for _, p := range [][]float64{a, b} {
+			if samePosition(p, c) || samePosition(p, d) {
+				return [][]float64{p}
+			}
+		}
+		t := cross(qp, s) / den
+		u := cross(qp, r) / den
+		if t < 0 || t > 1 || u < 0 || u > 1 {
+			return nil
+		}
+		switch {
+		case u == 0:
+			return [][]float64{c}
+		case u == 1:
+			return [][]float64{d}
+		case t == 0:
+			return [][]float64{a}
+		case t == 1:
+			return [][]float64{b}
+		}
+		return [][]float64{{a[0] + t*r[0], a[1] + t*r[1]}}
+	}
+	if cross(qp, r) != 0 {
+		return nil
+	}
+	var points [][]float64
+	add := func(p []float64) {
+		for _, q := range points {
+			if samePosition(p, q) {
+				return
+			}
+		}
+		points = append(points, p)
+	}
+	for _, p := range [][]float64{c, d} {
+		if onSegment(p, a, b) {
+			add(p)
+		}
+	}
+	for _, p := range [][]float64{a, b} {
+		if onSegment(p, c, d) {
+			add(p)
+		}
+	}
+	return points
+}
+
+func cross(a, b []float64) float64 {
+	return a[0]*b[1] - a[1]*b[0]
+}
+
+// onSegment tells if p is on ab.
+func onSegment(p, a, b []float64) bool {
+	if (b[0]-a[0])*(p[1]-a[1])-(b[1]-a[1])*(p[0]-a[0]) != 0 {
+		return false
+	}
+	return p[0] >= math.Min(a[0], b[0]) && p[0] <= math.Max(a[0], b[0]) &&
+		p[1] >= math.Min(a[1], b[1]) && p[1] <= math.Max(a[1], b[1])
+}
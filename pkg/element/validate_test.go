@@ -0,0 +1,128 @@
+package element
+
+import (
+	"github.com/paulmach/go.geojson"
+	"math"
+	"testing"
+)
+
+func square(x, y, size float64) [][]float64 {
+	return [][]float64{{x, y}, {x + size, y}, {x + size, y + size}, {x, y + size}, {x, y}}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		g      *geojson.Geometry
+		reason string
+	}{
+		{"valid", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(2, 2, 2)}), ""},
+		{"touching shells", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 1)},
+			[][][]float64{square(1, 1, 1)},
+		), ""},
+		{"nan", geojson.NewPointGeometry([]float64{math.NaN(), 1}), InvalidCoordinate},
+		{"short line", geojson.NewLineStringGeometry([][]float64{{1, 1}, {1, 1}}), TooFewPoints},
+		{"short ring", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 1}, {0, 0}}}), TooFewPoints},
+		{"unclosed", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}), RingNotClosed},
+		{"bowtie", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {2, 2}, {2, 0}, {0, 2}, {0, 0}}}), RingSelfIntersection},
+		{"spike", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {2, 0}, {3, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}), RingSelfIntersection},
+		{"hole crossing shell", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(8, 2, 4)}), SelfIntersection},
+		{"hole outside", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(20, 2, 2)}), HoleOutsideShell},
+		{"nested holes", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(1, 1, 8), square(2, 2, 2)}), NestedHoles},
+		{"overlapping outers", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 10)},
+			[][][]float64{square(5, 5, 10)},
+		), SelfIntersection},
+		{"nested shells", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 10)},
+			[][][]float64{square(2, 2, 2)},
+		), NestedShells},
+		{"island in hole", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 10), square(2, 2, 6)},
+			[][][]float64{square(4, 4, 2)},
+		), ""},
+	} {
+		err := Validate(c.g)
+		switch {
+		case c.reason == "" && err != nil:
+			t.Errorf("%s: unexpected %v", c.name, err)
+		case c.reason != "" && err == nil:
+			t.Errorf("%s: valid, want %s", c.name, c.reason)
+		case c.reason != "" && err.Reason != c.reason:
+			t.Errorf("%s: %v, want %s", c.name, err, c.reason)
+		}
+	}
+	err := Validate(geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {2, 2}, {2, 0}, {0, 2}, {0, 0}}}))
+	if err == nil || err.Location[0] != 1 || err.Location[1] != 1 {
+		t.Errorf("bowtie location %v, want [1 1]", err)
+	}
+}
+
+func polygonsArea(g *geojson.Geometry) float64 {
+	polygons := g.MultiPolygon
+	if g.Type == geojson.GeometryPolygon {
+		polygons = [][][][]float64{g.Polygon}
+	}
+	var area float64
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			area += ringArea(ring)
+		}
+	}
+	return area
+}
+
+func TestRepair(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		g        *geojson.Geometry
+		polygons int
+		area     float64
+	}{
+		{"bowtie", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {2, 2}, {2, 0}, {0, 2}, {0, 0}}}), 2, 2},
+		{"spike", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {2, 0}, {3, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}), 1, 4},
+		{"unclosed", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}), 1, 1},
+		{"hole crossing shell", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(8, 2, 4)}), 1, 92},
+		{"hole outside", geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(20, 2, 2)}), 1, 100},
+		{"overlapping outers", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 10)},
+			[][][]float64{square(5, 5, 10)},
+		), 1, 175},
+		{"nested shells", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 10)},
+			[][][]float64{square(2, 2, 2)},
+		), 1, 100},
+		{"shared edge", geojson.NewMultiPolygonGeometry(
+			[][][]float64{square(0, 0, 1)},
+			[][][]float64{square(1, 0, 1)},
+		), 1, 2},
+	} {
+		fixed := Repair(c.g)
+		if fixed == nil {
+			t.Errorf("%s: dropped", c.name)
+			continue
+		}
+		if err := Validate(fixed); err != nil {
+			t.Errorf("%s: still invalid, %v: %v", c.name, err, fixed.MultiPolygon)
+		}
+		polygons := 1
+		if fixed.Type == geojson.GeometryMultiPolygon {
+			polygons = len(fixed.MultiPolygon)
+		}
+		if polygons != c.polygons {
+			t.Errorf("%s: %d polygons, want %d", c.name, polygons, c.polygons)
+		}
+		if area := polygonsArea(fixed); math.Abs(area-c.area) > 1e-9 {
+			t.Errorf("%s: area %v, want %v", c.name, area, c.area)
+		}
+	}
+
+	if Repair(geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 1}, {0, 0}}})) != nil {
+		t.Error("ring without area not dropped")
+	}
+	valid := geojson.NewPolygonGeometry([][][]float64{square(0, 0, 10), square(2, 2, 2)})
+	if Repair(valid) != valid {
+		t.Error("valid polygon rebuilt")
+	}
+}
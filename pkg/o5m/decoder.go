@@ -0,0 +1,483 @@
+package o5m
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"time"
+)
+
+// Dataset types.
+const (
+	typeNode      = 0x10
+	typeWay       = 0x11
+	typeRelation  = 0x12
+	typeBBox      = 0xdb
+	typeTimestamp = 0xdc
+	typeHeader    = 0xe0
+	typeEnd       = 0xfe
+	typeReset     = 0xff
+	// Datasets from 0xf0 on are a single byte, without length.
+	typeNoLength = 0xf0
+
+	// Strings up to 250 bytes, plus their zero bytes, go into the table.
+	maxTableString = 252
+	tableSize      = 15000
+	// Coordinates are in units of 100 nanodegrees.
+	granularity = 100
+)
+
+var (
+	errNoHeader = errors.New("o5m: missing o5m2 or o5c2 header")
+	errInvalid  = errors.New("o5m: invalid dataset")
+)
+
+// IsO5M tells o5m and o5c data from the first bytes of a stream.
+func IsO5M(head []byte) bool {
+	return len(head) >= 2 && head[0] == typeReset && head[1] == typeHeader
+}
+
+// Decoder reads o5m and o5c data and streams elements into a
+// gosmparse.OSMReader, like pbf.Decoder.
+// Deleted elements, ex from o5c files, always have Info with Visible false.
+type Decoder struct {
+	r        *bufio.Reader
+	withInfo bool
+	header   *pbf.Header
+	// Change is true for o5c files, known after Header.
+	Change bool
+
+	// pending is the first element dataset, read with the header.
+	pendingType byte
+	pending     []byte
+
+	buf   []byte
+	table *stringTable
+	delta deltas
+}
+
+// deltas are the running values, cleared by a reset dataset.
+type deltas struct {
+	id        [3]int64
+	timestamp int64
+	changeset int64
+	lon, lat  int64
+	wayNode   int64
+	member    [3]int64
+}
+
+// NewDecoder returns a decoder that ignores element metadata.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), table: &stringTable{}}
+}
+
+// NewDecoderWithInfo returns a decoder that populates Element.Info.
+func NewDecoderWithInfo(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.withInfo = true
+	return d
+}
+
+// Header returns the file bbox and timestamp as a pbf header.
+func (d *Decoder) Header() (*pbf.Header, error) {
+	if d.header != nil {
+		return d.header, nil
+	}
+	header := &pbf.Header{RequiredFeatures: []string{pbf.FeatureOsmSchema}}
+	seenHeader := false
+	for {
+		t, data, err := d.next()
+		if err == io.EOF && seenHeader {
+			break
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if !seenHeader && t != typeReset && t != typeHeader {
+			return nil, errNoHeader
+		}
+		switch t {
+		case typeHeader:
+			switch string(data) {
+			case "o5m2":
+			case "o5c2":
+				d.Change = true
+			default:
+				return nil, fmt.Errorf("o5m: unsupported format %q", data)
+			}
+			seenHeader = true
+			continue
+		case typeBBox:
+			if header.BBox, err = decodeBBox(data); err != nil {
+				return nil, err
+			}
+			continue
+		case typeTimestamp:
+			ts, err := newReader(data).signed()
+			if err != nil {
+				return nil, err
+			}
+			header.ReplicationTimestamp = time.Unix(ts, 0).UTC()
+			continue
+		case typeNode, typeWay, typeRelation, typeEnd:
+			d.pendingType = t
+			d.pending = data
+		}
+		if d.pending != nil || t == typeEnd {
+			break
+		}
+	}
+	d.header = header
+	return header, nil
+}
+
+// Parse reads the whole stream into o.
+func (d *Decoder) Parse(o gosmparse.OSMReader) error {
+	if _, err := d.Header(); err != nil {
+		return err
+	}
+	for {
+		var t byte
+		var data []byte
+		if d.pending != nil || d.pendingType == typeEnd {
+			t, data = d.pendingType, d.pending
+			d.pendingType, d.pending = 0, nil
+		} else {
+			var err error
+			if t, data, err = d.next(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+
+		var err error
+		switch t {
+		case typeEnd:
+			return nil
+		case typeNode:
+			var n gosmparse.Node
+			if n, err = d.decodeNode(data); err == nil {
+				o.ReadNode(n)
+			}
+		case typeWay:
+			var w gosmparse.Way
+			if w, err = d.decodeWay(data); err == nil {
+				o.ReadWay(w)
+			}
+		case typeRelation:
+			var r gosmparse.Relation
+			if r, err = d.decodeRelation(data); err == nil {
+				o.ReadRelation(r)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// next reads one dataset, handling resets.
+func (d *Decoder) next() (byte, []byte, error) {
+	for {
+		t, err := d.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if t >= typeNoLength {
+			if t == typeReset {
+				d.delta = deltas{}
+				d.table.reset()
+				continue
+			}
+			return t, nil, nil
+		}
+		length, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+		if length > 1<<28 {
+			return 0, nil, fmt.Errorf("o5m: dataset of %d bytes", length)
+		}
+		if uint64(cap(d.buf)) < length {
+			d.buf = make([]byte, length)
+		}
+		data := d.buf[:length]
+		if _, err := io.ReadFull(d.r, data); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+		// Datasets before the first element are kept, copy them.
+		if d.header == nil {
+			data = append([]byte{}, data...)
+		}
+		return t, data, nil
+	}
+}
+
+// element decodes the id and version section, shared by all types.
+// It returns false for deleted elements, which have nothing more.
+func (d *Decoder) element(r *reader, kind gosmparse.MemberType) (gosmparse.Element, bool, error) {
+	e := gosmparse.Element{Tags: map[string]string{}}
+	delta, err := r.signed()
+	if err != nil {
+		return e, false, err
+	}
+	d.delta.id[kind] += delta
+	e.ID = d.delta.id[kind]
+
+	info := &gosmparse.Info{Version: -1, Visible: true}
+	version, err := r.uvarint()
+	if err != nil {
+		return e, false, err
+	}
+	if version != 0 {
+		info.Version = int(version)
+		if delta, err = r.signed(); err != nil {
+			return e, false, err
+		}
+		d.delta.timestamp += delta
+		if d.delta.timestamp != 0 {
+			info.Timestamp = time.Unix(d.delta.timestamp, 0).UTC()
+			if delta, err = r.signed(); err != nil {
+				return e, false, err
+			}
+			d.delta.changeset += delta
+			info.Changeset = d.delta.changeset
+			if !r.done() {
+				uid, user, err := d.decodeUser(r)
+				if err != nil {
+					return e, false, err
+				}
+				info.UID = int(uid)
+				info.User = user
+			}
+		}
+	}
+
+	if r.done() {
+		info.Visible = false
+		e.Info = info
+		return e, false, nil
+	}
+	if d.withInfo {
+		e.Info = info
+	}
+	return e, true, nil
+}
+
+func (d *Decoder) decodeNode(data []byte) (gosmparse.Node, error) {
+	r := newReader(data)
+	n := gosmparse.Node{}
+	var err error
+	var visible bool
+	if n.Element, visible, err = d.element(r, gosmparse.NodeType); err != nil || !visible {
+		return n, err
+	}
+	lon, err := r.signed()
+	if err != nil {
+		return n, err
+	}
+	lat, err := r.signed()
+	if err != nil {
+		return n, err
+	}
+	d.delta.lon += lon
+	d.delta.lat += lat
+	n.Lon = 1e-9 * float64(granularity*d.delta.lon)
+	n.Lat = 1e-9 * float64(granularity*d.delta.lat)
+	return n, d.decodeTags(r, n.Tags)
+}
+
+func (d *Decoder) decodeWay(data []byte) (gosmparse.Way, error) {
+	r := newReader(data)
+	w := gosmparse.Way{}
+	var err error
+	var visible bool
+	if w.Element, visible, err = d.element(r, gosmparse.WayType); err != nil || !visible {
+		return w, err
+	}
+	refs, err := r.section()
+	if err != nil {
+		return w, err
+	}
+	for !refs.done() {
+		delta, err := refs.signed()
+		if err != nil {
+			return w, err
+		}
+		d.delta.wayNode += delta
+		w.NodeIDs = append(w.NodeIDs, d.delta.wayNode)
+	}
+	return w, d.decodeTags(r, w.Tags)
+}
+
+func (d *Decoder) decodeRelation(data []byte) (gosmparse.Relation, error) {
+	r := newReader(data)
+	rel := gosmparse.Relation{}
+	var err error
+	var visible bool
+	if rel.Element, visible, err = d.element(r, gosmparse.RelationType); err != nil || !visible {
+		return rel, err
+	}
+	refs, err := r.section()
+	if err != nil {
+		return rel, err
+	}
+	for !refs.done() {
+		delta, err := refs.signed()
+		if err != nil {
+			return rel, err
+		}
+		// One string: the member type digit, then the role.
+		s, err := d.decodeStrings(refs, 1)
+		if err != nil {
+			return rel, err
+		}
+		if len(s[0]) == 0 || s[0][0] < '0' || s[0][0] > '2' {
+			return rel, fmt.Errorf("o5m: relation %d: invalid member type", rel.ID)
+		}
+		kind := gosmparse.MemberType(s[0][0] - '0')
+		d.delta.member[kind] += delta
+		rel.Members = append(rel.Members, gosmparse.RelationMember{
+			ID:   d.delta.member[kind],
+			Type: kind,
+			Role: string(s[0][1:]),
+		})
+	}
+	return rel, d.decodeTags(r, rel.Tags)
+}
+
+func (d *Decoder) decodeTags(r *reader, tags map[string]string) error {
+	for !r.done() {
+		s, err := d.decodeStrings(r, 2)
+		if err != nil {
+			return err
+		}
+		tags[string(s[0])] = string(s[1])
+	}
+	return nil
+}
+
+// decodeUser reads the uid and user pair, the uid is a varint.
+func (d *Decoder) decodeUser(r *reader) (uint64, string, error) {
+	raw, err := d.decodeString(r, func(b []byte) int {
+		if _, n := binary.Uvarint(b); n > 0 && n < len(b) && b[n] == 0 {
+			if end := bytes.IndexByte(b[n+1:], 0); end >= 0 {
+				return n + 1 + end + 1
+			}
+		}
+		return -1
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	uid, n := binary.Uvarint(raw)
+	return uid, string(raw[n+1 : len(raw)-1]), nil
+}
+
+// decodeStrings reads count zero terminated strings.
+func (d *Decoder) decodeStrings(r *reader, count int) ([][]byte, error) {
+	raw, err := d.decodeString(r, func(b []byte) int {
+		length := 0
+		for i := 0; i < count; i++ {
+			end := bytes.IndexByte(b[length:], 0)
+			if end < 0 {
+				return -1
+			}
+			length += end + 1
+		}
+		return length
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.SplitN(raw, []byte{0}, count+1)[:count], nil
+}
+
+// decodeString reads an entry inline, measured by length, or as a
+// reference to the string table.
+func (d *Decoder) decodeString(r *reader, length func([]byte) int) ([]byte, error) {
+	if r.done() {
+		return nil, errInvalid
+	}
+	if r.data[r.pos] != 0 {
+		index, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		raw := d.table.get(index)
+		if raw == nil || length(raw) != len(raw) {
+			return nil, fmt.Errorf("o5m: invalid string reference %d", index)
+		}
+		return raw, nil
+	}
+	r.pos++
+	n := length(r.data[r.pos:])
+	if n < 0 {
+		return nil, errInvalid
+	}
+	raw := r.data[r.pos : r.pos+n]
+	r.pos += n
+	d.table.add(raw)
+	return raw, nil
+}
+
+// decodeBBox reads x1, y1, x2, y2 in 100 nanodegrees.
+func decodeBBox(data []byte) (*pbf.BBox, error) {
+	r := newReader(data)
+	var v [4]int64
+	for i := range v {
+		var err error
+		if v[i], err = r.signed(); err != nil {
+			return nil, err
+		}
+	}
+	return &pbf.BBox{
+		Left:   float64(v[0]) / 1e7,
+		Bottom: float64(v[1]) / 1e7,
+		Right:  float64(v[2]) / 1e7,
+		Top:    float64(v[3]) / 1e7,
+	}, nil
+}
+
+// stringTable keeps the last tableSize short strings or string pairs.
+type stringTable struct {
+	entries [][]byte
+	next    int
+}
+
+func (t *stringTable) add(s []byte) {
+	if len(s) > maxTableString {
+		return
+	}
+	if t.entries == nil {
+		t.entries = make([][]byte, tableSize)
+	}
+	t.entries[t.next] = append(t.entries[t.next][:0], s...)
+	t.next = (t.next + 1) % tableSize
+}
+
+// get returns the index-th most recent string, 1 is the last one.
+func (t *stringTable) get(index uint64) []byte {
+	if t.entries == nil || index == 0 || index > tableSize {
+		return nil
+	}
+	return t.entries[(t.next+tableSize-int(index))%tableSize]
+}
+
+func (t *stringTable) reset() {
+	t.entries = nil
+	t.next = 0
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package o5m
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type collector struct {
+	nodes     []gosmparse.Node
+	ways      []gosmparse.Way
+	relations []gosmparse.Relation
+}
+
+func (c *collector) ReadNode(n gosmparse.Node)         { c.nodes = append(c.nodes, n) }
+func (c *collector) ReadWay(w gosmparse.Way)           { c.ways = append(c.ways, w) }
+func (c *collector) ReadRelation(r gosmparse.Relation) { c.relations = append(c.relations, r) }
+
+func uv(v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, v)]
+}
+
+func sv(v int64) []byte {
+	return uv(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func inline(s ...string) []byte {
+	return []byte("\x00" + strings.Join(s, "\x00") + "\x00")
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func dataset(t byte, parts ...[]byte) []byte {
+	data := join(parts...)
+	return join([]byte{t}, uv(uint64(len(data))), data)
+}
+
+// sampleO5M follows the o5m format description of the OSM wiki.
+func sampleO5M(format string) []byte {
+	return join(
+		[]byte{typeReset},
+		dataset(typeHeader, []byte(format)),
+		dataset(typeBBox, sv(1214000000), sv(249000000), sv(1216000000), sv(251000000)),
+		dataset(typeTimestamp, sv(1546398245)),
+		// Node 1 with author and an inline tag.
+		dataset(typeNode,
+			sv(1), uv(3), sv(1546398245), sv(42),
+			[]byte{0}, uv(7), inline("mapper"),
+			sv(1215000000), sv(250000000),
+			inline("amenity", "cafe"),
+		),
+		// Node 2 references the tag, a long tag doesn't go into the table.
+		dataset(typeNode,
+			sv(1), uv(0), sv(1000), sv(-1000),
+			uv(1), inline("note", strings.Repeat("x", 300)),
+		),
+		dataset(typeNode, sv(1), uv(0), sv(0), sv(0), uv(1)),
+		dataset(typeWay,
+			sv(10), uv(0),
+			uv(2), sv(1), sv(1),
+			inline("highway", "path"),
+		),
+		dataset(typeRelation,
+			sv(100), uv(0),
+			uv(uint64(len(join(sv(10), inline("1outer"), sv(1), inline("0"))))),
+			sv(10), inline("1outer"), sv(1), inline("0"),
+			inline("type", "route"),
+		),
+		// Deleted node 5.
+		dataset(typeNode, sv(2), uv(0)),
+		[]byte{typeEnd},
+		[]byte("ignored"),
+	)
+}
+
+func TestDecoder(t *testing.T) {
+	decoder := NewDecoderWithInfo(bytes.NewReader(sampleO5M("o5m2")))
+	header, err := decoder.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BBox == nil || header.BBox.Left != 121.4 || header.BBox.Top != 25.1 {
+		t.Errorf("bbox %+v", header.BBox)
+	}
+	if !header.ReplicationTimestamp.Equal(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("timestamp %v", header.ReplicationTimestamp)
+	}
+	if decoder.Change {
+		t.Error("o5m is not a change file")
+	}
+
+	got := &collector{}
+	if err := decoder.Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.nodes) != 4 || len(got.ways) != 1 || len(got.relations) != 1 {
+		t.Fatalf("got %d nodes, %d ways, %d relations", len(got.nodes), len(got.ways), len(got.relations))
+	}
+
+	n := got.nodes[0]
+	wantInfo := &gosmparse.Info{
+		Version:   3,
+		Timestamp: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Changeset: 42,
+		UID:       7,
+		User:      "mapper",
+		Visible:   true,
+	}
+	if n.ID != 1 || math.Abs(n.Lat-25) > 1e-9 || math.Abs(n.Lon-121.5) > 1e-9 || n.Tags["amenity"] != "cafe" || !reflect.DeepEqual(n.Info, wantInfo) {
+		t.Errorf("node %+v %+v", n, n.Info)
+	}
+	n = got.nodes[1]
+	if n.ID != 2 || math.Abs(n.Lon-121.5001) > 1e-9 || math.Abs(n.Lat-24.9999) > 1e-9 || len(n.Tags) != 2 || n.Tags["amenity"] != "cafe" {
+		t.Errorf("node %+v", n)
+	}
+	if n = got.nodes[2]; n.ID != 3 || !reflect.DeepEqual(n.Tags, map[string]string{"amenity": "cafe"}) {
+		t.Errorf("node %+v", n)
+	}
+	if n = got.nodes[3]; n.ID != 5 || n.Info == nil || n.Info.Visible {
+		t.Errorf("deleted node %+v %+v", n, n.Info)
+	}
+
+	w := got.ways[0]
+	if w.ID != 10 || !reflect.DeepEqual(w.NodeIDs, []int64{1, 2}) || w.Tags["highway"] != "path" {
+		t.Errorf("way %+v", w)
+	}
+	wantMembers := []gosmparse.RelationMember{
+		{ID: 10, Type: gosmparse.WayType, Role: "outer"},
+		{ID: 1, Type: gosmparse.NodeType},
+	}
+	if r := got.relations[0]; r.ID != 100 || !reflect.DeepEqual(r.Members, wantMembers) || r.Tags["type"] != "route" {
+		t.Errorf("relation %+v", r)
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	data := join(
+		[]byte{typeReset},
+		dataset(typeHeader, []byte("o5c2")),
+		dataset(typeNode, sv(5), uv(0), sv(10), sv(20), inline("a", "b")),
+		[]byte{typeReset},
+		dataset(typeNode, sv(7), uv(0), sv(10), sv(20), inline("a", "b")),
+		dataset(typeNode, sv(1), uv(0), sv(0), sv(0), uv(1)),
+	)
+	decoder := NewDecoder(bytes.NewReader(data))
+	got := &collector{}
+	if err := decoder.Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	if !decoder.Change {
+		t.Error("o5c is a change file")
+	}
+	var ids []int64
+	for _, n := range got.nodes {
+		ids = append(ids, n.ID)
+		if n.Info != nil || n.Tags["a"] != "b" || math.Abs(n.Lat-2e-6) > 1e-12 {
+			t.Errorf("node %+v", n)
+		}
+	}
+	if !reflect.DeepEqual(ids, []int64{5, 7, 8}) {
+		t.Errorf("ids %v", ids)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	header := join([]byte{typeReset}, dataset(typeHeader, []byte("o5m2")))
+	for name, data := range map[string][]byte{
+		"no header":        {typeReset, typeNode, 0},
+		"unknown format":   join([]byte{typeReset}, dataset(typeHeader, []byte("o5m1"))),
+		"empty table":      join(header, dataset(typeNode, sv(1), uv(0), sv(0), sv(0), uv(1))),
+		"reset table":      join(header, dataset(typeNode, sv(1), uv(0), sv(0), sv(0), inline("a", "b")), []byte{typeReset}, dataset(typeNode, sv(2), uv(0), sv(0), sv(0), uv(1))),
+		"member type":      join(header, dataset(typeRelation, sv(1), uv(0), uv(4), sv(1), inline("3"))),
+		"unterminated tag": join(header, dataset(typeNode, sv(1), uv(0), sv(0), sv(0), []byte("\x00a\x00b"))),
+		"truncated":        join(header, []byte{typeNode, 10, 2}),
+	} {
+		if err := NewDecoder(bytes.NewReader(data)).Parse(&collector{}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestIsO5M(t *testing.T) {
+	if !IsO5M(sampleO5M("o5m2")) {
+		t.Error("o5m not detected")
+	}
+	if IsO5M([]byte("<?xml")) || IsO5M([]byte{0, 0, 0, 13}) {
+		t.Error("detected xml or pbf as o5m")
+	}
+}
@@ -0,0 +1,48 @@
+package o5m
+
+import (
+	"encoding/binary"
+)
+
+// reader reads the numbers of one dataset.
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func newReader(data []byte) *reader {
+	return &reader{data: data}
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, errInvalid
+	}
+	r.pos += n
+	return v, nil
+}
+
+// signed reads a varint with the sign in its lowest bit.
+func (r *reader) signed() (int64, error) {
+	v, err := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// section returns a reader over a length prefixed part, ex way refs.
+func (r *reader) section() (*reader, error) {
+	length, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.data)-r.pos) < length {
+		return nil, errInvalid
+	}
+	s := newReader(r.data[r.pos : r.pos+int(length)])
+	r.pos += int(length)
+	return s, nil
+}
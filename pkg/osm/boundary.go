@@ -0,0 +1,297 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/sirupsen/logrus"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// Boundary is an area spatial filter, GeoJSON MultiPolygon coordinates.
+type Boundary struct {
+	MultiPolygon [][][][]float64
+
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// NewBoundary .
+func NewBoundary(multiPolygon [][][][]float64) *Boundary {
+	b := &Boundary{
+		MultiPolygon: multiPolygon,
+		minLon:       math.Inf(1),
+		minLat:       math.Inf(1),
+		maxLon:       math.Inf(-1),
+		maxLat:       math.Inf(-1),
+	}
+	for _, polygon := range multiPolygon {
+		for _, ring := range polygon {
+			for _, p := range ring {
+				b.minLon = math.Min(b.minLon, p[0])
+				b.maxLon = math.Max(b.maxLon, p[0])
+				b.minLat = math.Min(b.minLat, p[1])
+				b.maxLat = math.Max(b.maxLat, p[1])
+			}
+		}
+	}
+	return b
+}
+
+// Contains tells if a location is inside, even-odd over every ring so inner
+// rings are holes.
+func (b *Boundary) Contains(lon, lat float64) bool {
+	if lon < b.minLon || lon > b.maxLon || lat < b.minLat || lat > b.maxLat {
+		return false
+	}
+	inside := false
+	for _, polygon := range b.MultiPolygon {
+		for _, ring := range polygon {
+			for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+				a, c := ring[i], ring[j]
+				if (a[1] > lat) != (c[1] > lat) &&
+					lon < (c[0]-a[0])*(lat-a[1])/(c[1]-a[1])+a[0] {
+					inside = !inside
+				}
+			}
+		}
+	}
+	return inside
+}
+
+// BBox .
+func (b *Boundary) BBox() *pbf.BBox {
+	return &pbf.BBox{Left: b.minLon, Right: b.maxLon, Top: b.maxLat, Bottom: b.minLat}
+}
+
+// RelationBoundary builds the area of a relation of source, ex an admin
+// boundary, with the multipolygon code of RelationElementToFeature. Its
+// outer and inner ways are parsed in a temp cache under levelDBPath.
+func RelationBoundary(source Source, relationID int64, levelDBPath string, batchSize int) (*Boundary, error) {
+	if err := os.MkdirAll(levelDBPath, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(levelDBPath, "boundary")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	defaultParams := DefaultPBFParserParams{Source: source, PBFMasks: bitmask.NewPBFMasks()}
+	outputChan := make(chan element.Element)
+	parser := NewPBFParser(defaultParams, PBFParserParams{
+		LevelDBPath: dir,
+		PBFIndexer: NewIDIndexer(defaultParams, IDIndexerParams{
+			ElementRefs:   []ElementRef{{Type: gosmparse.RelationType, ID: relationID}},
+			AddReferenced: true,
+		}),
+		PBFRelationMemberIndexer: NewPBFRelationMemberIndexer(defaultParams),
+		BatchSize:                batchSize,
+		OutputElementChan:        outputChan,
+	})
+	found := make(chan []element.Element, 1)
+	go func() {
+		var relations []element.Element
+		for emt := range outputChan {
+			relations = append(relations, emt)
+		}
+		found <- relations
+	}()
+	if err := parser.Run(); err != nil {
+		return nil, err
+	}
+	relations := <-found
+	if len(relations) == 0 {
+		return nil, fmt.Errorf("boundary relation %d missing or incomplete in %s", relationID, source.Name())
+	}
+
+	// Only rings make the area, ex not the label node of a boundary.
+	rel := relations[0]
+	area := element.Element{
+		Type:     "Relation",
+		Relation: gosmparse.Relation{Element: gosmparse.Element{ID: relationID, Tags: map[string]string{"type": "multipolygon"}}},
+	}
+	for _, member := range rel.Elements {
+		if member.Type != "Way" || (member.Role != "outer" && member.Role != "inner" && member.Role != "") {
+			continue
+		}
+		if member.Role == "" {
+			member.Role = "outer"
+		}
+		area.Elements = append(area.Elements, member)
+	}
+	f := element.RelationElementToFeature(&area)
+	if len(f.Geometry.MultiPolygon) == 0 {
+		return nil, fmt.Errorf("boundary relation %d has no closed outer ring", relationID)
+	}
+	boundary := NewBoundary(f.Geometry.MultiPolygon)
+	logrus.Infof("Boundary relation %d, bbox %v", relationID, *boundary.BBox())
+	return boundary, nil
+}
+
+// NewBoundaryIndexer .
+func NewBoundaryIndexer(defaultParams DefaultPBFParserParams, params BoundaryIndexerParams) PBFDataParser {
+	return &BoundaryIndexer{
+		Source:      defaultParams.source(),
+		Indexer:     NewPBFIndexer(defaultParams),
+		RelationID:  params.BoundaryRelation,
+		LevelDBPath: params.LevelDBPath,
+		BatchSize:   params.BatchSize,
+	}
+}
+
+// BoundaryIndexer runs Indexer on the elements inside Boundary only, the
+// spatial filter of the rest of the run: nodes inside, ways with a node
+// inside and relations with a member inside. Kept ways and relations stay
+// complete.
+// Without Boundary it's built from relation RelationID of Source.
+type BoundaryIndexer struct {
+	Source      Source
+	Indexer     PBFDataParser
+	Boundary    *Boundary
+	RelationID  int64
+	LevelDBPath string
+	BatchSize   int
+
+	nodes     *bitmask.Bitmask
+	ways      *bitmask.Bitmask
+	relations *bitmask.Bitmask
+	firstPass bool
+	added     bool
+}
+
+// Run .
+func (p *BoundaryIndexer) Run() error {
+	if p.Boundary == nil {
+		boundary, err := RelationBoundary(p.Source, p.RelationID, p.LevelDBPath, p.BatchSize)
+		if err != nil {
+			return err
+		}
+		p.Boundary = boundary
+	}
+	p.nodes = bitmask.NewBitMask()
+	p.ways = bitmask.NewBitMask()
+	p.relations = bitmask.NewBitMask()
+
+	// Nodes first, the input may be unsorted.
+	if err := decodeSource(p.Source, &boundaryNodeScan{p}); err != nil {
+		return err
+	}
+	// Relations of relations take a pass per level.
+	p.firstPass = true
+	for {
+		p.added = false
+		if err := decodeSource(p.Source, p); err != nil {
+			return err
+		}
+		p.firstPass = false
+		if !p.added {
+			break
+		}
+	}
+	logrus.Infof("Inside boundary: %d nodes, %d ways, %d relations", p.nodes.Len(), p.ways.Len(), p.relations.Len())
+	return decodeSource(p.Source, &boundaryFilter{p})
+}
+
+// ReadNode .
+func (p *BoundaryIndexer) ReadNode(n gosmparse.Node) {}
+
+// ReadWay .
+func (p *BoundaryIndexer) ReadWay(w gosmparse.Way) {
+	if !p.firstPass {
+		return
+	}
+	for _, id := range w.NodeIDs {
+		if p.nodes.Has(id) {
+			p.ways.Insert(w.ID)
+			return
+		}
+	}
+}
+
+// ReadWayWithLocations skips located ways, the node scan has them.
+func (p *BoundaryIndexer) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {}
+
+// ReadRelation .
+func (p *BoundaryIndexer) ReadRelation(r gosmparse.Relation) {
+	if p.relations.Has(r.ID) {
+		return
+	}
+	for _, member := range r.Members {
+		var inside bool
+		switch member.Type {
+		case gosmparse.NodeType:
+			inside = p.nodes.Has(member.ID)
+		case gosmparse.WayType:
+			inside = p.ways.Has(member.ID)
+		case gosmparse.RelationType:
+			inside = p.relations.Has(member.ID)
+		}
+		if inside {
+			p.relations.Insert(r.ID)
+			p.added = true
+			return
+		}
+	}
+}
+
+// boundaryNodeScan finds the nodes and located ways inside.
+type boundaryNodeScan struct {
+	p *BoundaryIndexer
+}
+
+func (s *boundaryNodeScan) ReadNode(n gosmparse.Node) {
+	if s.p.Boundary.Contains(n.Lon, n.Lat) {
+		s.p.nodes.Insert(n.ID)
+	}
+}
+
+func (s *boundaryNodeScan) ReadWay(w gosmparse.Way) {}
+
+func (s *boundaryNodeScan) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	for _, n := range nodes {
+		if s.p.Boundary.Contains(n.Lon, n.Lat) {
+			s.p.ways.Insert(w.ID)
+			return
+		}
+	}
+}
+
+func (s *boundaryNodeScan) ReadRelation(r gosmparse.Relation) {}
+
+// boundaryFilter passes the elements inside to the Indexer.
+type boundaryFilter struct {
+	p *BoundaryIndexer
+}
+
+func (f *boundaryFilter) ReadNode(n gosmparse.Node) {
+	if f.p.nodes.Has(n.ID) {
+		f.p.Indexer.ReadNode(n)
+	}
+}
+
+func (f *boundaryFilter) ReadWay(w gosmparse.Way) {
+	if f.p.ways.Has(w.ID) {
+		f.p.Indexer.ReadWay(w)
+	}
+}
+
+func (f *boundaryFilter) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if !f.p.ways.Has(w.ID) {
+		return
+	}
+	if located, ok := f.p.Indexer.(pbf.WayLocationReader); ok {
+		located.ReadWayWithLocations(w, nodes)
+	} else {
+		f.p.Indexer.ReadWay(w)
+	}
+}
+
+func (f *boundaryFilter) ReadRelation(r gosmparse.Relation) {
+	if f.p.relations.Has(r.ID) {
+		f.p.Indexer.ReadRelation(r)
+	}
+}
@@ -0,0 +1,104 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Boundary 90 is the square 0..10 with the hole 4..6, its ways split in
+// two. Node 5 is a label member inside the hole.
+const boundaryCountry = `<osm version="0.6">
+ <node id="1" lat="0" lon="0"/>
+ <node id="2" lat="0" lon="10"/>
+ <node id="3" lat="10" lon="10"/>
+ <node id="4" lat="10" lon="0"/>
+ <node id="5" lat="5" lon="5"><tag k="place" v="city"/></node>
+ <node id="6" lat="4" lon="4"/>
+ <node id="7" lat="4" lon="6"/>
+ <node id="8" lat="6" lon="6"/>
+ <node id="9" lat="6" lon="4"/>
+ <node id="20" lat="2" lon="2"><tag k="amenity" v="cafe"/></node>
+ <node id="21" lat="20" lon="20"><tag k="amenity" v="bar"/></node>
+ <node id="22" lat="2" lon="8"/>
+ <node id="23" lat="2" lon="15"/>
+ <node id="24" lat="15" lon="15"/>
+ <way id="50"><nd ref="1"/><nd ref="2"/><nd ref="3"/></way>
+ <way id="51"><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>
+ <way id="52"><nd ref="6"/><nd ref="7"/><nd ref="8"/><nd ref="9"/><nd ref="6"/></way>
+ <way id="60"><nd ref="22"/><nd ref="23"/><tag k="highway" v="primary"/></way>
+ <way id="61"><nd ref="23"/><nd ref="24"/><tag k="highway" v="primary"/></way>
+ <relation id="90"><member type="way" ref="50" role="outer"/><member type="way" ref="51" role="outer"/><member type="way" ref="52" role="inner"/><member type="node" ref="5" role="label"/><tag k="type" v="boundary"/><tag k="boundary" v="administrative"/></relation>
+ <relation id="91"><member type="way" ref="60" role=""/><member type="way" ref="61" role=""/><tag k="type" v="route"/><tag k="route" v="road"/></relation>
+ <relation id="92"><member type="way" ref="61" role=""/><tag k="type" v="route"/><tag k="route" v="bus"/></relation>
+</osm>`
+
+func TestBoundaryContains(t *testing.T) {
+	b := NewBoundary([][][][]float64{{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}},
+	}})
+	for _, tc := range []struct {
+		lon, lat float64
+		want     bool
+	}{
+		{2, 2, true},
+		{5, 5, false},
+		{11, 5, false},
+		{-1, -1, false},
+		{9.9, 9.9, true},
+	} {
+		if got := b.Contains(tc.lon, tc.lat); got != tc.want {
+			t.Errorf("%v,%v: got %v, want %v", tc.lon, tc.lat, got, tc.want)
+		}
+	}
+}
+
+func TestBoundaryIndexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-boundary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, boundaryCountry)
+	levelDBPath := filepath.Join(dir, "cache")
+
+	defaultParams := DefaultPBFParserParams{PBFFile: files[0], PBFMasks: bitmask.NewPBFMasks()}
+	var features []string
+	ways := map[int64]element.Element{}
+	for _, emt := range parseElements(t, defaultParams, PBFParserParams{
+		LevelDBPath: levelDBPath,
+		PBFIndexer: NewBoundaryIndexer(defaultParams, BoundaryIndexerParams{
+			BoundaryRelation: 90,
+			LevelDBPath:      levelDBPath,
+			BatchSize:        5000,
+		}),
+	}) {
+		features = append(features, element.OSMID(strings.ToLower(emt.Type), emt.GetID()))
+		if emt.Type == "Way" {
+			ways[emt.Way.ID] = emt
+		}
+	}
+	sort.Strings(features)
+	// The city is in the hole, route 92 only uses the way outside.
+	want := "node/20 relation/90 relation/91 way/60"
+	if got := strings.Join(features, " "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// Ways crossing the boundary stay complete.
+	if len(ways[60].Elements) != 2 || ways[60].Elements[1].Node.Lon != 15 {
+		t.Errorf("way 60 %+v", ways[60].Elements)
+	}
+
+	if _, err := RelationBoundary(FileSource(files[0]), 91, levelDBPath, 5000); err == nil {
+		t.Error("expected an error for a relation without closed rings")
+	}
+	if _, err := RelationBoundary(FileSource(files[0]), 99, levelDBPath, 5000); err == nil {
+		t.Error("expected an error for a missing relation")
+	}
+}
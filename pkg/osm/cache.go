@@ -0,0 +1,234 @@
+package osm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"strconv"
+)
+
+// LevelDB cache layout:
+//   "<id>"            node lat, lon.
+//   "W<id>", "R<id>"  way and relation as gob element.
+// Updatable caches keep every element, plus:
+//   "P<member>/<parent>", ex "Pn12/w5", way 5 has node 12.
+//   "Masks"           the gob PBFMasks.
+// Ids are signed decimals, negative ones of unsaved elements included: only
+// node keys start with a digit or '-', so "-5" is node -5 and nothing else.
+
+var masksKey = []byte("Masks")
+
+var memberTypeKeys = []string{"n", "w", "r"}
+
+var memberTypeNames = []string{"node", "way", "relation"}
+
+func nodeKey(id int64) []byte {
+	return []byte(strconv.FormatInt(id, 10))
+}
+
+func wayKey(id int64) []byte {
+	return []byte("W" + strconv.FormatInt(id, 10))
+}
+
+func relationKey(id int64) []byte {
+	return []byte("R" + strconv.FormatInt(id, 10))
+}
+
+func parentPrefix(t gosmparse.MemberType, id int64) []byte {
+	return []byte("P" + memberTypeKeys[t] + strconv.FormatInt(id, 10) + "/")
+}
+
+func parentKey(t gosmparse.MemberType, id int64, parentType gosmparse.MemberType, parentID int64) []byte {
+	return append(parentPrefix(t, id), memberTypeKeys[parentType]+strconv.FormatInt(parentID, 10)...)
+}
+
+// cacheReader is a leveldb.DB or a leveldb.Transaction.
+type cacheReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// elementCache looks up the elements cached by PBFParser.
+type elementCache struct {
+	db cacheReader
+}
+
+func (c elementCache) element(key []byte) (element.Element, error) {
+	data, err := c.db.Get(key, nil)
+	if err != nil {
+		return element.Element{}, err
+	}
+	return element.ByteToElement(data)
+}
+
+// way returns a cached way, without its node elements.
+func (c elementCache) way(id int64) (element.Element, error) {
+	return c.element(wayKey(id))
+}
+
+// relation returns a cached relation, without its member elements.
+func (c elementCache) relation(id int64) (element.Element, error) {
+	return c.element(relationKey(id))
+}
+
+// parents returns the ways and relations having the member.
+func (c elementCache) parents(t gosmparse.MemberType, id int64) ([]gosmparse.RelationMember, error) {
+	var parents []gosmparse.RelationMember
+	prefix := parentPrefix(t, id)
+	iter := c.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		parent := iter.Key()[len(prefix):]
+		parentID, err := strconv.ParseInt(string(parent[1:]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		parentType := gosmparse.WayType
+		if parent[0] == memberTypeKeys[gosmparse.RelationType][0] {
+			parentType = gosmparse.RelationType
+		}
+		parents = append(parents, gosmparse.RelationMember{ID: parentID, Type: parentType})
+	}
+	return parents, iter.Error()
+}
+
+// wayElements get refs node from db.
+func (c elementCache) wayElements(way *gosmparse.Way) ([]element.Element, error) {
+	var emts []element.Element
+	for _, nodeID := range way.NodeIDs {
+		data, err := c.db.Get(nodeKey(nodeID), nil)
+		if err != nil {
+			return []element.Element{}, err
+		}
+		e := bytesToNodeElement(data)
+		emts = append(emts, e)
+	}
+	return emts, nil
+}
+
+func (c elementCache) relationElements(relation *gosmparse.Relation, blacklist []int64) ([]element.Element, error) {
+	var emts []element.Element
+
+	// blacklist to avoid recursive relation member.
+	blacklist = append(blacklist, relation.ID)
+	for _, member := range relation.Members {
+		switch member.Type {
+		case 0: // Node
+			nodeBytes, err := c.db.Get(nodeKey(member.ID), nil)
+			if err != nil {
+				logrus.Error(err)
+				return []element.Element{}, err
+			}
+			emt := bytesToNodeElement(nodeBytes)
+			emts = append(emts, emt)
+		case 1: // Way
+			// Get element from db.
+			emt, err := c.way(member.ID)
+			if err != nil {
+				logrus.Error(err)
+				return []element.Element{}, err
+			}
+			// Get ref nodes from db, unless cached with locations.
+			if len(emt.Elements) == 0 {
+				nodeElements, err := c.wayElements(&emt.Way)
+				if err != nil {
+					logrus.Error(err)
+					return []element.Element{}, err
+				}
+				emt.Elements = nodeElements
+			}
+			emt.Role = member.Role
+			emts = append(emts, emt)
+		case 2: // Relation
+			// Skip if relation recursive. A -> B -> A
+			var recursive bool
+			for _, blackID := range blacklist {
+				if member.ID == blackID {
+					recursive = true
+				}
+			}
+			if recursive {
+				continue
+			}
+
+			// Get element from db.
+			emt, err := c.relation(member.ID)
+			if err != nil {
+				logrus.Error(err)
+				return []element.Element{}, err
+			}
+
+			// Get relation member emts.
+			newElements, err := c.relationElements(&emt.Relation, blacklist)
+			if err != nil {
+				logrus.Error(err)
+				return []element.Element{}, err
+			}
+			emt.Elements = newElements
+			emt.Role = member.Role
+			emts = append(emts, emt)
+		}
+	}
+	return emts, nil
+}
+
+// loadMasks reads the masks of an updatable cache.
+func loadMasks(db cacheReader) (*bitmask.PBFMasks, error) {
+	data, err := db.Get(masksKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	masks := bitmask.NewPBFMasks()
+	if _, err := masks.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return masks, nil
+}
+
+func encodeMasks(masks *bitmask.PBFMasks) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := masks.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// nodeToBytes transfrom node to bytes.
+func nodeToBytes(n gosmparse.Node) (string, []byte) {
+	var buf bytes.Buffer
+
+	// Encoding lat as 64 bit float64 packed into 8 bytes.
+	var latBytes = make([]byte, 8)
+	binary.BigEndian.PutUint64(latBytes, math.Float64bits(n.Lat))
+	buf.Write(latBytes)
+
+	// Encoding lng as 64 bit float64 packed into 8 bytes.
+	var lonBytes = make([]byte, 8)
+	binary.BigEndian.PutUint64(lonBytes, math.Float64bits(n.Lon))
+	buf.Write(lonBytes)
+
+	return string(nodeKey(n.ID)), buf.Bytes()
+}
+
+// bytesToNodeElement transfrom node from bytes to element.
+func bytesToNodeElement(data []byte) element.Element {
+
+	node := gosmparse.Node{}
+	// bytes to LatLon .
+	var latBytes = append([]byte{}, data[0:8]...)
+	var lat = math.Float64frombits(binary.BigEndian.Uint64(latBytes))
+	node.Lat = lat
+
+	var lonBytes = append([]byte{}, data[8:16]...)
+	var lon = math.Float64frombits(binary.BigEndian.Uint64(lonBytes))
+	node.Lon = lon
+	return element.Element{
+		Type: "Node",
+		Node: node,
+	}
+}
@@ -0,0 +1,265 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/thomersch/gosmparse"
+)
+
+// NewChangeApplier .
+func NewChangeApplier(params ChangeApplierParams) *ChangeApplier {
+	return &ChangeApplier{
+		ChangeFile:        params.ChangeFile,
+		Source:            params.ChangeSource,
+		LevelDBPath:       params.LevelDBPath,
+		OutputElementChan: params.OutputElementChan,
+	}
+}
+
+// ChangeApplier applies an osmChange (.osc) file to the cache of a
+// PBFParser run with UpdatableCache, then sends the features it changed to
+// OutputElementChan with Action create, modify or delete.
+type ChangeApplier struct {
+	ChangeFile string
+	// Source overrides ChangeFile.
+	Source            Source
+	LevelDBPath       string
+	OutputElementChan chan element.Element
+
+	PBFMasks *bitmask.PBFMasks
+	tx       *leveldb.Transaction
+	touched  changeSet
+	firstError
+}
+
+// Run .
+func (a *ChangeApplier) Run() error {
+	defer close(a.OutputElementChan)
+
+	db, err := leveldb.OpenFile(
+		a.LevelDBPath,
+		&opt.Options{DisableBlockCache: true, ErrorIfMissing: true},
+	)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	a.PBFMasks, err = loadMasks(db)
+	if err == leveldb.ErrNotFound {
+		return fmt.Errorf("%s is not an updatable cache", a.LevelDBPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	// All or nothing, a failed change leaves the cache as it was.
+	a.tx, err = db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	a.touched = changeSet{}
+	if err := a.apply(); err != nil {
+		a.tx.Discard()
+		return err
+	}
+	if err := a.tx.Commit(); err != nil {
+		return err
+	}
+	logrus.Infof("Applied %s, %d elements changed", a.source().Name(), len(a.touched))
+
+	a.touched.emit(elementCache{db: db}, a.isFeature, a.OutputElementChan)
+	return nil
+}
+
+// source returns Source, or ChangeFile if unset.
+func (a *ChangeApplier) source() Source {
+	if a.Source != nil {
+		return a.Source
+	}
+	return FileSource(a.ChangeFile)
+}
+
+// apply reads the change into the transaction.
+func (a *ChangeApplier) apply() error {
+	reader, err := a.source().Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := osmxml.NewDecoder(reader)
+	if _, err := decoder.Header(); err != nil {
+		return err
+	}
+	if !decoder.Change {
+		return fmt.Errorf("%s is not an osmChange file", a.source().Name())
+	}
+	if err := decoder.ParseChange(a); err != nil {
+		return err
+	}
+	if a.err != nil {
+		return a.err
+	}
+
+	// Parents are unchanged, they were features if they still are.
+	if err := a.touched.propagate(elementCache{db: a.tx}, a.isFeature); err != nil {
+		return err
+	}
+
+	masks, err := encodeMasks(a.PBFMasks)
+	if err != nil {
+		return err
+	}
+	return a.tx.Put(masksKey, masks, nil)
+}
+
+// ReadNodeChange .
+func (a *ChangeApplier) ReadNodeChange(action osmxml.Action, n gosmparse.Node) {
+	if a.err != nil {
+		return
+	}
+	touched := a.touch(changeKey{Type: gosmparse.NodeType, ID: n.ID})
+	touched.action = action
+	touched.deleted = action == osmxml.ActionDelete
+	if touched.deleted {
+		a.PBFMasks.Nodes.Remove(n.ID)
+		a.fail(a.tx.Delete(nodeKey(n.ID), nil))
+		return
+	}
+	touched.node = n
+	if len(n.Tags) > 0 {
+		a.PBFMasks.Nodes.Insert(n.ID)
+	} else {
+		a.PBFMasks.Nodes.Remove(n.ID)
+	}
+	id, val := nodeToBytes(n)
+	a.fail(a.tx.Put([]byte(id), val, nil))
+}
+
+// ReadWayChange .
+func (a *ChangeApplier) ReadWayChange(action osmxml.Action, w gosmparse.Way) {
+	if a.err != nil {
+		return
+	}
+	touched := a.touch(changeKey{Type: gosmparse.WayType, ID: w.ID})
+	touched.action = action
+	touched.deleted = action == osmxml.ActionDelete
+
+	old, err := elementCache{db: a.tx}.way(w.ID)
+	switch err {
+	case nil:
+		for _, nodeID := range old.Way.NodeIDs {
+			a.fail(a.tx.Delete(parentKey(gosmparse.NodeType, nodeID, gosmparse.WayType, w.ID), nil))
+		}
+	case leveldb.ErrNotFound:
+	default:
+		a.fail(err)
+		return
+	}
+
+	if touched.deleted {
+		a.PBFMasks.Ways.Remove(w.ID)
+		a.fail(a.tx.Delete(wayKey(w.ID), nil))
+		return
+	}
+	if len(w.Tags) > 0 {
+		a.PBFMasks.Ways.Insert(w.ID)
+		for _, nodeID := range w.NodeIDs {
+			a.PBFMasks.WayRefs.Insert(nodeID)
+		}
+	} else {
+		a.PBFMasks.Ways.Remove(w.ID)
+	}
+	for _, nodeID := range w.NodeIDs {
+		a.fail(a.tx.Put(parentKey(gosmparse.NodeType, nodeID, gosmparse.WayType, w.ID), nil, nil))
+	}
+	emt := element.Element{Type: "Way", Way: w}
+	val, err := emt.ToByte()
+	if a.fail(err) {
+		return
+	}
+	a.fail(a.tx.Put(wayKey(w.ID), val, nil))
+}
+
+// ReadRelationChange .
+func (a *ChangeApplier) ReadRelationChange(action osmxml.Action, r gosmparse.Relation) {
+	if a.err != nil {
+		return
+	}
+	touched := a.touch(changeKey{Type: gosmparse.RelationType, ID: r.ID})
+	touched.action = action
+	touched.deleted = action == osmxml.ActionDelete
+
+	old, err := elementCache{db: a.tx}.relation(r.ID)
+	switch err {
+	case nil:
+		for _, member := range old.Relation.Members {
+			a.fail(a.tx.Delete(parentKey(member.Type, member.ID, gosmparse.RelationType, r.ID), nil))
+		}
+	case leveldb.ErrNotFound:
+	default:
+		a.fail(err)
+		return
+	}
+
+	if touched.deleted {
+		a.PBFMasks.Relations.Remove(r.ID)
+		a.fail(a.tx.Delete(relationKey(r.ID), nil))
+		return
+	}
+	a.indexRelation(r)
+	for _, member := range r.Members {
+		a.fail(a.tx.Put(parentKey(member.Type, member.ID, gosmparse.RelationType, r.ID), nil, nil))
+	}
+	emt := element.Element{Type: "Relation", Relation: r}
+	val, err := emt.ToByte()
+	if a.fail(err) {
+		return
+	}
+	a.fail(a.tx.Put(relationKey(r.ID), val, nil))
+}
+
+// indexRelation follows the PBFIndexer rules.
+func (a *ChangeApplier) indexRelation(r gosmparse.Relation) {
+	hasWay := false
+	for _, member := range r.Members {
+		if member.Type == gosmparse.WayType {
+			hasWay = true
+		}
+	}
+	if len(r.Tags) == 0 || !hasWay {
+		a.PBFMasks.Relations.Remove(r.ID)
+		return
+	}
+	a.PBFMasks.Relations.Insert(r.ID)
+	for _, member := range r.Members {
+		switch member.Type {
+		case gosmparse.NodeType:
+			a.PBFMasks.RelNodes.Insert(member.ID)
+		case gosmparse.WayType:
+			a.PBFMasks.RelWays.Insert(member.ID)
+		case gosmparse.RelationType:
+			a.PBFMasks.RelRelation.Insert(member.ID)
+		}
+	}
+}
+
+// touch records an element, with its feature state before the change.
+func (a *ChangeApplier) touch(key changeKey) *touchedElement {
+	if touched, ok := a.touched[key]; ok {
+		return touched
+	}
+	touched := &touchedElement{wasFeature: a.isFeature(key)}
+	a.touched[key] = touched
+	return touched
+}
+
+func (a *ChangeApplier) isFeature(key changeKey) bool {
+	return isFeature(a.PBFMasks, key)
+}
@@ -0,0 +1,157 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const changeBase = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+ <node id="1" version="1" timestamp="2020-01-01T00:00:00Z" lat="0" lon="0"/>
+ <node id="2" version="1" timestamp="2020-01-01T00:00:00Z" lat="0" lon="1"/>
+ <node id="3" version="1" timestamp="2020-01-01T00:00:00Z" lat="1" lon="1"/>
+ <node id="4" version="1" timestamp="2020-01-01T00:00:00Z" lat="2" lon="2"><tag k="amenity" v="cafe"/></node>
+ <way id="10" version="1" timestamp="2020-01-01T00:00:00Z"><nd ref="1"/><nd ref="2"/><nd ref="3"/><tag k="highway" v="residential"/></way>
+ <way id="11" version="1" timestamp="2020-01-01T00:00:00Z"><nd ref="1"/><nd ref="3"/></way>
+ <relation id="20" version="1" timestamp="2020-01-01T00:00:00Z"><member type="way" ref="11" role=""/><tag k="type" v="route"/></relation>
+</osm>
+`
+
+const changeFile = `<?xml version="1.0" encoding="UTF-8"?>
+<osmChange version="0.6">
+ <modify>
+  <node id="2" version="2" lat="0.5" lon="1"/>
+  <way id="11" version="2"><nd ref="1"/><nd ref="3"/><tag k="building" v="yes"/></way>
+ </modify>
+ <create>
+  <node id="5" version="1" lat="3" lon="3"><tag k="shop" v="bakery"/></node>
+ </create>
+ <delete>
+  <node id="4" version="2"/>
+ </delete>
+</osmChange>
+`
+
+// newUpdatableCache parses changeBase into an updatable cache in dir.
+func newUpdatableCache(t *testing.T, dir string) string {
+	baseFile := filepath.Join(dir, "base.osm")
+	if err := ioutil.WriteFile(baseFile, []byte(changeBase), 0644); err != nil {
+		t.Fatal(err)
+	}
+	levelDBPath := filepath.Join(dir, "cache")
+	defaultParams := DefaultPBFParserParams{PBFFile: baseFile, PBFMasks: bitmask.NewPBFMasks()}
+	parserChan := make(chan element.Element)
+	parser := NewPBFParser(defaultParams, PBFParserParams{
+		LevelDBPath:              levelDBPath,
+		PBFIndexer:               NewPBFIndexer(defaultParams),
+		PBFRelationMemberIndexer: NewPBFRelationMemberIndexer(defaultParams),
+		BatchSize:                5000,
+		OutputElementChan:        parserChan,
+		UpdatableCache:           true,
+	})
+	go func() {
+		for range parserChan {
+		}
+	}()
+	if err := parser.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return levelDBPath
+}
+
+func TestChangeApplier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	levelDBPath := newUpdatableCache(t, dir)
+	oscFile := filepath.Join(dir, "change.osc")
+	if err := ioutil.WriteFile(oscFile, []byte(changeFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputChan := make(chan element.Element)
+	applier := NewChangeApplier(ChangeApplierParams{
+		ChangeFile:        oscFile,
+		LevelDBPath:       levelDBPath,
+		OutputElementChan: outputChan,
+	})
+	done := make(chan error, 1)
+	go func() { done <- applier.Run() }()
+	var changes []element.Element
+	for emt := range outputChan {
+		changes = append(changes, emt)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		Type   string
+		ID     int64
+		Action string
+	}{
+		{"Node", 4, "delete"},
+		{"Node", 5, "create"},
+		{"Way", 10, "modify"},
+		{"Way", 11, "create"},
+		{"Relation", 20, "modify"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for i, w := range want {
+		got := changes[i]
+		if got.Type != w.Type || got.GetID() != w.ID || got.Action != w.Action {
+			t.Errorf("change %d: got %s %d %s, want %s %d %s",
+				i, got.Type, got.GetID(), got.Action, w.Type, w.ID, w.Action)
+		}
+	}
+	if way := changes[2]; len(way.Elements) != 3 || way.Elements[1].Node.Lat != 0.5 {
+		t.Errorf("way 10 not moved: %+v", way.Elements)
+	}
+
+	// The cache is updated, applying it again modifies only.
+	outputChan = make(chan element.Element)
+	applier = NewChangeApplier(ChangeApplierParams{
+		ChangeFile:        oscFile,
+		LevelDBPath:       levelDBPath,
+		OutputElementChan: outputChan,
+	})
+	go func() { done <- applier.Run() }()
+	for emt := range outputChan {
+		if emt.Action == "create" {
+			t.Errorf("%s %d created twice", emt.Type, emt.GetID())
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangeApplierNotUpdatable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outputChan := make(chan element.Element)
+	applier := NewChangeApplier(ChangeApplierParams{
+		ChangeFile:        filepath.Join(dir, "change.osc"),
+		LevelDBPath:       filepath.Join(dir, "cache"),
+		OutputElementChan: outputChan,
+	})
+	go func() {
+		for range outputChan {
+		}
+	}()
+	if err := applier.Run(); err == nil {
+		t.Error("expected an error without a cache")
+	}
+}
@@ -0,0 +1,153 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/sirupsen/logrus"
+	"github.com/thomersch/gosmparse"
+	"sort"
+)
+
+type changeKey struct {
+	Type gosmparse.MemberType
+	ID   int64
+}
+
+// touchedElement is an element a change modified, directly or through
+// its members.
+type touchedElement struct {
+	wasFeature bool
+	deleted    bool
+	// action is the osmChange action of direct changes, ActionNone for
+	// parents of changed elements.
+	action osmxml.Action
+	// node keeps the tags, the cache only has the location.
+	node gosmparse.Node
+}
+
+// changeSet is the elements a change touched.
+type changeSet map[changeKey]*touchedElement
+
+// isFeature tells if PBFParser outputs the element.
+func isFeature(masks *bitmask.PBFMasks, key changeKey) bool {
+	switch key.Type {
+	case gosmparse.NodeType:
+		return masks.Nodes.Has(key.ID)
+	case gosmparse.WayType:
+		return masks.Ways.Has(key.ID)
+	}
+	return masks.Relations.Has(key.ID)
+}
+
+// sortedKeys returns the keys in type then id order.
+func (s changeSet) sortedKeys() []changeKey {
+	keys := make([]changeKey, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// propagate touches the ways and relations of touched elements, their
+// geometry changed with their members.
+func (s changeSet) propagate(cache elementCache, wasFeature func(changeKey) bool) error {
+	queue := make([]changeKey, 0, len(s))
+	for key := range s {
+		queue = append(queue, key)
+	}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		parents, err := cache.parents(key.Type, key.ID)
+		if err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			parentKey := changeKey{Type: parent.Type, ID: parent.ID}
+			if _, ok := s[parentKey]; ok {
+				continue
+			}
+			s[parentKey] = &touchedElement{wasFeature: wasFeature(parentKey)}
+			queue = append(queue, parentKey)
+		}
+	}
+	return nil
+}
+
+// emit sends the changed features to out in type then id order, with
+// Action set:
+//
+//	create  the element became a feature.
+//	modify  the feature or one of its members changed.
+//	delete  the element is no longer a feature, it has no geometry.
+func (s changeSet) emit(cache elementCache, isFeature func(changeKey) bool, out chan<- element.Element) {
+	for _, key := range s.sortedKeys() {
+		touched := s[key]
+		switch {
+		case !touched.deleted && isFeature(key):
+			emt, err := touched.feature(cache, key)
+			// skip features which fail to denormalize.
+			if err != nil {
+				logrus.Error(err)
+				continue
+			}
+			emt.Action = "modify"
+			if !touched.wasFeature {
+				emt.Action = "create"
+			}
+			out <- emt
+		case touched.wasFeature:
+			out <- deletedElement(key)
+		}
+	}
+}
+
+// feature denormalizes a changed feature from the cache.
+func (t *touchedElement) feature(cache elementCache, key changeKey) (element.Element, error) {
+	switch key.Type {
+	case gosmparse.NodeType:
+		return element.Element{Type: "Node", Node: t.node}, nil
+	case gosmparse.WayType:
+		emt, err := cache.way(key.ID)
+		if err != nil {
+			return emt, fmt.Errorf("way %d: %v", key.ID, err)
+		}
+		if emt.Elements, err = cache.wayElements(&emt.Way); err != nil {
+			return emt, fmt.Errorf("way %d: %v", key.ID, err)
+		}
+		return emt, nil
+	}
+	emt, err := cache.relation(key.ID)
+	if err != nil {
+		return emt, fmt.Errorf("relation %d: %v", key.ID, err)
+	}
+	if emt.Elements, err = cache.relationElements(&emt.Relation, []int64{}); err != nil {
+		return emt, fmt.Errorf("relation %d: %v", key.ID, err)
+	}
+	return emt, nil
+}
+
+func deletedElement(key changeKey) element.Element {
+	emt := element.Element{Action: "delete"}
+	id := gosmparse.Element{ID: key.ID}
+	switch key.Type {
+	case gosmparse.NodeType:
+		emt.Type = "Node"
+		emt.Node.Element = id
+	case gosmparse.WayType:
+		emt.Type = "Way"
+		emt.Way.Element = id
+	default:
+		emt.Type = "Relation"
+		emt.Relation.Element = id
+	}
+	return emt
+}
@@ -0,0 +1,138 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"time"
+)
+
+// HistorySource reads a full-history file as the snapshot at Time: the last
+// version of each element not newer than Time, unless that version is a
+// delete. Every id shows up once, so the passes and PBFMasks work as on a
+// plain file.
+// Versions must come in type then id order, like osmium writes them.
+type HistorySource struct {
+	Source
+	Time time.Time
+}
+
+// NewHistorySource .
+func NewHistorySource(source Source, t time.Time) *HistorySource {
+	return &HistorySource{Source: source, Time: t}
+}
+
+// Name .
+func (h *HistorySource) Name() string {
+	return h.Source.Name() + "@" + h.Time.UTC().Format(time.RFC3339)
+}
+
+func (h *HistorySource) openDecoder() (decoder, io.Closer, error) {
+	reader, err := h.Source.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &historyDecoder{decoder: newDecoder(reader, true), time: h.Time}, reader, nil
+}
+
+// historyDecoder filters the versions of a history file.
+type historyDecoder struct {
+	decoder
+	time time.Time
+}
+
+// Header drops HistoricalInformation, the snapshot has none.
+func (d *historyDecoder) Header() (*pbf.Header, error) {
+	header, err := d.decoder.Header()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *header
+	snapshot.RequiredFeatures = nil
+	for _, feature := range header.RequiredFeatures {
+		if feature != pbf.FeatureHistoricalInformation {
+			snapshot.RequiredFeatures = append(snapshot.RequiredFeatures, feature)
+		}
+	}
+	return &snapshot, nil
+}
+
+// Parse .
+func (d *historyDecoder) Parse(o gosmparse.OSMReader) error {
+	r := &snapshotReader{o: o, time: d.time}
+	if err := d.decoder.Parse(r); err != nil {
+		return err
+	}
+	r.flush()
+	return r.err
+}
+
+// snapshotReader keeps the current version of the current element until
+// the next element starts.
+type snapshotReader struct {
+	o    gosmparse.OSMReader
+	time time.Time
+
+	seen    bool
+	lastKey changeKey
+	pending func()
+	err     error
+}
+
+// version handles one version, read is called if it's the snapshot one.
+func (r *snapshotReader) version(key changeKey, info *gosmparse.Info, read func()) {
+	if r.err != nil {
+		return
+	}
+	if r.seen && key != r.lastKey {
+		if key.Type < r.lastKey.Type || (key.Type == r.lastKey.Type && key.ID < r.lastKey.ID) {
+			r.err = fmt.Errorf("history: %s %d after %s %d, versions must be sorted by type then id",
+				memberTypeNames[key.Type], key.ID, memberTypeNames[r.lastKey.Type], r.lastKey.ID)
+			return
+		}
+		r.flush()
+	}
+	r.seen = true
+	r.lastKey = key
+	if info == nil {
+		r.pending = read
+		return
+	}
+	if info.Timestamp.After(r.time) {
+		return
+	}
+	if info.Visible {
+		r.pending = read
+	} else {
+		r.pending = nil
+	}
+}
+
+func (r *snapshotReader) flush() {
+	if r.pending != nil {
+		r.pending()
+		r.pending = nil
+	}
+}
+
+func (r *snapshotReader) ReadNode(n gosmparse.Node) {
+	r.version(changeKey{Type: gosmparse.NodeType, ID: n.ID}, n.Info, func() { r.o.ReadNode(n) })
+}
+
+func (r *snapshotReader) ReadWay(w gosmparse.Way) {
+	r.version(changeKey{Type: gosmparse.WayType, ID: w.ID}, w.Info, func() { r.o.ReadWay(w) })
+}
+
+func (r *snapshotReader) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	located, ok := r.o.(pbf.WayLocationReader)
+	if !ok {
+		r.ReadWay(w)
+		return
+	}
+	r.version(changeKey{Type: gosmparse.WayType, ID: w.ID}, w.Info, func() { located.ReadWayWithLocations(w, nodes) })
+}
+
+func (r *snapshotReader) ReadRelation(rel gosmparse.Relation) {
+	r.version(changeKey{Type: gosmparse.RelationType, ID: rel.ID}, rel.Info, func() { r.o.ReadRelation(rel) })
+}
@@ -0,0 +1,79 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleHistory = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+ <node id="1" version="1" timestamp="2010-01-01T00:00:00Z" lat="0" lon="0"/>
+ <node id="2" version="1" timestamp="2010-01-01T00:00:00Z" lat="0" lon="1"/>
+ <node id="2" version="2" timestamp="2015-01-01T00:00:00Z" lat="1" lon="1"/>
+ <node id="3" version="1" timestamp="2012-01-01T00:00:00Z" lat="2" lon="2"/>
+ <node id="4" version="1" timestamp="2010-01-01T00:00:00Z" lat="3" lon="3"><tag k="amenity" v="cafe"/></node>
+ <node id="4" version="2" timestamp="2013-01-01T00:00:00Z" visible="false"/>
+ <way id="10" version="1" timestamp="2010-01-01T00:00:00Z"><nd ref="1"/><nd ref="2"/><tag k="highway" v="track"/></way>
+ <way id="10" version="2" timestamp="2012-01-01T00:00:00Z"><nd ref="1"/><nd ref="2"/><nd ref="3"/><tag k="highway" v="residential"/></way>
+</osm>
+`
+
+// snapshotFeatures runs PBFParser on the snapshot of sampleHistory at t.
+func snapshotFeatures(t *testing.T, dir string, at time.Time) map[string]element.Element {
+	source := NewHistorySource(NewReaderAtSource(strings.NewReader(sampleHistory), int64(len(sampleHistory)), "history.osm"), at)
+	defaultParams := DefaultPBFParserParams{Source: source, PBFMasks: bitmask.NewPBFMasks()}
+	features := map[string]element.Element{}
+	for _, emt := range parseElements(t, defaultParams, PBFParserParams{
+		LevelDBPath: filepath.Join(dir, at.Format("20060102")),
+		PBFIndexer:  NewPBFIndexer(defaultParams),
+	}) {
+		features[emt.Type+itoa(emt.GetID())] = emt
+	}
+	return features
+}
+
+func TestHistorySource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	features := snapshotFeatures(t, dir, time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(features) != 0 {
+		t.Errorf("2005: got %d features, want none", len(features))
+	}
+
+	features = snapshotFeatures(t, dir, time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC))
+	if _, ok := features["Node4"]; !ok || len(features) != 2 {
+		t.Errorf("2011: got %v, want Node4 and Way10", features)
+	}
+	if way := features["Way10"]; way.Way.Tags["highway"] != "track" || len(way.Elements) != 2 || way.Elements[1].Node.Lat != 0 {
+		t.Errorf("2011: way 10 %+v", way)
+	}
+
+	features = snapshotFeatures(t, dir, time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	if _, ok := features["Node4"]; ok {
+		t.Error("2016: deleted node 4 still there")
+	}
+	if way := features["Way10"]; way.Way.Tags["highway"] != "residential" || len(way.Elements) != 3 || way.Elements[1].Node.Lat != 1 {
+		t.Errorf("2016: way 10 %+v", way)
+	}
+}
+
+func TestHistorySourceUnsorted(t *testing.T) {
+	data := `<osm version="0.6">
+ <node id="2" version="1" timestamp="2010-01-01T00:00:00Z" lat="0" lon="0"/>
+ <node id="1" version="1" timestamp="2010-01-01T00:00:00Z" lat="0" lon="0"/>
+</osm>`
+	source := NewHistorySource(NewReaderAtSource(strings.NewReader(data), int64(len(data)), "unsorted.osm"), time.Now())
+	if err := decodeSource(source, &refCheck{nodes: map[int64]bool{}}); err == nil {
+		t.Error("expected an error for unsorted versions")
+	}
+}
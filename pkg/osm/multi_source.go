@@ -0,0 +1,304 @@
+package osm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// mergeBatchSize is the elements a merged input sends at once.
+const mergeBatchSize = 1024
+
+// MultiSource reads several inputs, ex neighbouring extracts, as one
+// dataset: elements are merged in type then id order and an id found in
+// several inputs is kept once, its highest version.
+// Every input must be sorted by type then id.
+type MultiSource struct {
+	Sources []Source
+}
+
+// NewMultiSource .
+func NewMultiSource(sources ...Source) *MultiSource {
+	return &MultiSource{Sources: sources}
+}
+
+// Open fails, the inputs are merged while decoding.
+func (m *MultiSource) Open() (io.ReadCloser, error) {
+	return nil, errors.New("merged sources have no single stream")
+}
+
+// Name .
+func (m *MultiSource) Name() string {
+	names := make([]string, len(m.Sources))
+	for i, source := range m.Sources {
+		names[i] = source.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (m *MultiSource) openDecoder() (decoder, io.Closer, error) {
+	d := &mergeDecoder{}
+	for _, source := range m.Sources {
+		reader, err := source.Open()
+		if err != nil {
+			d.Close()
+			return nil, nil, err
+		}
+		d.readers = append(d.readers, reader)
+		d.names = append(d.names, source.Name())
+		// Versions need metadata.
+		d.decoders = append(d.decoders, newDecoder(reader, true))
+	}
+	return d, d, nil
+}
+
+// mergeDecoder merges the elements of sorted decoders.
+type mergeDecoder struct {
+	decoders []decoder
+	readers  []io.ReadCloser
+	names    []string
+}
+
+// Close closes every input.
+func (d *mergeDecoder) Close() error {
+	var err error
+	for _, reader := range d.readers {
+		if cerr := reader.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Header merges the input headers: the union of the required features and
+// bounds, the optional features all inputs have.
+func (d *mergeDecoder) Header() (*pbf.Header, error) {
+	var merged *pbf.Header
+	for _, dec := range d.decoders {
+		header, err := dec.Header()
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			h := *header
+			h.RequiredFeatures = append([]string{}, header.RequiredFeatures...)
+			h.OptionalFeatures = append([]string{}, header.OptionalFeatures...)
+			if header.BBox != nil {
+				bbox := *header.BBox
+				h.BBox = &bbox
+			}
+			merged = &h
+			continue
+		}
+		for _, feature := range header.RequiredFeatures {
+			if !merged.HasRequiredFeature(feature) {
+				merged.RequiredFeatures = append(merged.RequiredFeatures, feature)
+			}
+		}
+		var optional []string
+		for _, feature := range merged.OptionalFeatures {
+			if header.HasOptionalFeature(feature) {
+				optional = append(optional, feature)
+			}
+		}
+		merged.OptionalFeatures = optional
+		if merged.BBox != nil && header.BBox != nil {
+			merged.BBox.Left = math.Min(merged.BBox.Left, header.BBox.Left)
+			merged.BBox.Right = math.Max(merged.BBox.Right, header.BBox.Right)
+			merged.BBox.Bottom = math.Min(merged.BBox.Bottom, header.BBox.Bottom)
+			merged.BBox.Top = math.Max(merged.BBox.Top, header.BBox.Top)
+		} else {
+			merged.BBox = nil
+		}
+	}
+	return merged, nil
+}
+
+// mergeItem is one element of an input.
+type mergeItem struct {
+	key      changeKey
+	version  int
+	node     gosmparse.Node
+	way      gosmparse.Way
+	nodes    []gosmparse.Node
+	relation gosmparse.Relation
+}
+
+// mergeInput decodes an input in the background, in batches.
+type mergeInput struct {
+	name    string
+	batches chan []mergeItem
+	quit    chan struct{}
+	batch   []mergeItem
+	err     error
+
+	pos     int
+	current []mergeItem
+	last    changeKey
+	seen    bool
+}
+
+func (in *mergeInput) add(item mergeItem) {
+	in.batch = append(in.batch, item)
+	if len(in.batch) == mergeBatchSize {
+		in.send()
+	}
+}
+
+func (in *mergeInput) send() {
+	if len(in.batch) == 0 {
+		return
+	}
+	select {
+	case in.batches <- in.batch:
+	case <-in.quit:
+	}
+	in.batch = make([]mergeItem, 0, mergeBatchSize)
+}
+
+func itemVersion(info *gosmparse.Info) int {
+	if info == nil {
+		return 0
+	}
+	return info.Version
+}
+
+func (in *mergeInput) ReadNode(n gosmparse.Node) {
+	in.add(mergeItem{key: changeKey{Type: gosmparse.NodeType, ID: n.ID}, version: itemVersion(n.Info), node: n})
+}
+
+func (in *mergeInput) ReadWay(w gosmparse.Way) {
+	in.add(mergeItem{key: changeKey{Type: gosmparse.WayType, ID: w.ID}, version: itemVersion(w.Info), way: w})
+}
+
+func (in *mergeInput) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	in.add(mergeItem{key: changeKey{Type: gosmparse.WayType, ID: w.ID}, version: itemVersion(w.Info), way: w, nodes: nodes})
+}
+
+func (in *mergeInput) ReadRelation(r gosmparse.Relation) {
+	in.add(mergeItem{key: changeKey{Type: gosmparse.RelationType, ID: r.ID}, version: itemVersion(r.Info), relation: r})
+}
+
+// head returns the next element, false at the end of the input.
+func (in *mergeInput) head() (*mergeItem, bool) {
+	if in.pos == len(in.current) {
+		batch, ok := <-in.batches
+		if !ok {
+			return nil, false
+		}
+		in.current, in.pos = batch, 0
+	}
+	return &in.current[in.pos], true
+}
+
+// next drops the head, checking the input order.
+func (in *mergeInput) next() error {
+	key := in.current[in.pos].key
+	in.pos++
+	if in.seen && keyLess(key, in.last) {
+		return fmt.Errorf("%s: %s %d after %s %d, inputs must be sorted by type then id",
+			in.name, memberTypeNames[key.Type], key.ID, memberTypeNames[in.last.Type], in.last.ID)
+	}
+	in.seen = true
+	in.last = key
+	return nil
+}
+
+func keyLess(a, b changeKey) bool {
+	return a.Type < b.Type || (a.Type == b.Type && a.ID < b.ID)
+}
+
+// Parse .
+func (d *mergeDecoder) Parse(o gosmparse.OSMReader) error {
+	if _, err := d.Header(); err != nil {
+		return err
+	}
+	quit := make(chan struct{})
+	wg := sync.WaitGroup{}
+	inputs := make([]*mergeInput, len(d.decoders))
+	for i, dec := range d.decoders {
+		in := &mergeInput{
+			name:    d.names[i],
+			batches: make(chan []mergeItem, 4),
+			quit:    quit,
+			batch:   make([]mergeItem, 0, mergeBatchSize),
+		}
+		inputs[i] = in
+		wg.Add(1)
+		go func(dec decoder) {
+			defer wg.Done()
+			defer close(in.batches)
+			in.err = dec.Parse(in)
+			in.send()
+		}(dec)
+	}
+
+	err := merge(inputs, o)
+	close(quit)
+	// Drain so the decoders exit.
+	for _, in := range inputs {
+		for range in.batches {
+		}
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	for _, in := range inputs {
+		if in.err != nil {
+			return fmt.Errorf("%s: %v", in.name, in.err)
+		}
+	}
+	return nil
+}
+
+// merge reads the smallest head of inputs, the highest version of it.
+func merge(inputs []*mergeInput, o gosmparse.OSMReader) error {
+	located, _ := o.(pbf.WayLocationReader)
+	for {
+		var best *mergeItem
+		for _, in := range inputs {
+			item, ok := in.head()
+			if !ok {
+				continue
+			}
+			if best == nil || keyLess(item.key, best.key) ||
+				(item.key == best.key && item.version > best.version) {
+				best = item
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		item := *best
+		for _, in := range inputs {
+			for {
+				head, ok := in.head()
+				if !ok || head.key != item.key {
+					break
+				}
+				if err := in.next(); err != nil {
+					return err
+				}
+			}
+		}
+
+		switch item.key.Type {
+		case gosmparse.NodeType:
+			o.ReadNode(item.node)
+		case gosmparse.WayType:
+			if located != nil && item.nodes != nil {
+				located.ReadWayWithLocations(item.way, item.nodes)
+			} else {
+				o.ReadWay(item.way)
+			}
+		case gosmparse.RelationType:
+			o.ReadRelation(item.relation)
+		}
+	}
+}
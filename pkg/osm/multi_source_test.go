@@ -0,0 +1,106 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Two extracts sharing node 3 and way 10, way 10 needs node 4 of east.
+const (
+	westExtract = `<osm version="0.6">
+ <node id="1" version="1" lat="0" lon="0"/>
+ <node id="2" version="1" lat="0" lon="1"/>
+ <node id="3" version="1" lat="0" lon="2"/>
+ <way id="10" version="1"><nd ref="2"/><nd ref="3"/><nd ref="4"/><tag k="highway" v="primary"/></way>
+</osm>`
+	eastExtract = `<osm version="0.6">
+ <node id="3" version="2" lat="0.5" lon="2"/>
+ <node id="4" version="1" lat="0" lon="3"/>
+ <way id="10" version="1"><nd ref="2"/><nd ref="3"/><nd ref="4"/><tag k="highway" v="primary"/></way>
+ <way id="11" version="1"><nd ref="3"/><nd ref="4"/><tag k="highway" v="service"/></way>
+</osm>`
+)
+
+func writeExtracts(t *testing.T, dir string, extracts ...string) []string {
+	var files []string
+	for i, data := range extracts {
+		file := filepath.Join(dir, "extract"+itoa(int64(i))+".osm")
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func TestMultiSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, westExtract, eastExtract)
+
+	defaultParams := DefaultPBFParserParams{PBFFiles: files, PBFMasks: bitmask.NewPBFMasks()}
+	info := NewPBFFileInfo(defaultParams)
+	if err := info.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if info.Info.Nodes != 4 || info.Info.Ways != 2 || !info.Info.Sorted {
+		t.Errorf("merged info %+v, want 4 nodes and 2 ways, sorted", info.Info)
+	}
+
+	outputChan := make(chan element.Element)
+	parser := NewPBFParser(defaultParams, PBFParserParams{
+		LevelDBPath:              filepath.Join(dir, "cache"),
+		PBFIndexer:               NewPBFIndexer(defaultParams),
+		PBFRelationMemberIndexer: NewPBFRelationMemberIndexer(defaultParams),
+		BatchSize:                5000,
+		OutputElementChan:        outputChan,
+	})
+	features := map[string]element.Element{}
+	collected := make(chan int)
+	go func() {
+		count := 0
+		for emt := range outputChan {
+			features[emt.Type+itoa(emt.GetID())] = emt
+			count++
+		}
+		collected <- count
+	}()
+	if err := parser.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if count := <-collected; count != 2 {
+		t.Errorf("got %d features, want way 10 and 11 once", count)
+	}
+	way := features["Way10"]
+	if len(way.Elements) != 3 {
+		t.Fatalf("way 10 has %d nodes, want 3", len(way.Elements))
+	}
+	// Node 4 comes from east, node 3 is its highest version.
+	if way.Elements[1].Node.Lat != 0.5 || way.Elements[2].Node.Lon != 3 {
+		t.Errorf("way 10 nodes %+v", way.Elements)
+	}
+}
+
+func TestMultiSourceUnsorted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, westExtract, `<osm version="0.6">
+ <node id="4" version="1" lat="0" lon="3"/>
+ <node id="3" version="2" lat="0.5" lon="2"/>
+</osm>`)
+
+	source := NewMultiSource(FileSource(files[0]), FileSource(files[1]))
+	if err := decodeSource(source, &refCheck{nodes: map[int64]bool{}}); err == nil {
+		t.Error("expected an error for an unsorted input")
+	}
+}
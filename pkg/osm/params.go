@@ -4,6 +4,7 @@ import (
 	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
 	"github.com/groundhog-technologies/osmparser/pkg/element"
 	"go.uber.org/dig"
+	"time"
 )
 
 // DefaultPBFParserParams .
@@ -11,6 +12,26 @@ type DefaultPBFParserParams struct {
 	dig.In
 	PBFFile  string            `name:"pbfFile"`
 	PBFMasks *bitmask.PBFMasks `name:"pbfMasks"`
+	// Source overrides PBFFile, ex to read stdin.
+	Source Source `name:"source" optional:"true"`
+	// PBFFiles overrides PBFFile with several inputs read as one, see
+	// MultiSource.
+	PBFFiles []string `name:"pbfFiles" optional:"true"`
+}
+
+// source returns Source, PBFFiles or PBFFile, the first set.
+func (p DefaultPBFParserParams) source() Source {
+	if p.Source != nil {
+		return p.Source
+	}
+	if len(p.PBFFiles) > 0 {
+		sources := make([]Source, len(p.PBFFiles))
+		for i, file := range p.PBFFiles {
+			sources[i] = FileSource(file)
+		}
+		return NewMultiSource(sources...)
+	}
+	return FileSource(p.PBFFile)
 }
 
 // PBFParserParams .
@@ -21,4 +42,91 @@ type PBFParserParams struct {
 	PBFRelationMemberIndexer PBFDataParser        `name:"pbfRelationMemberIndexer"`
 	BatchSize                int                  `name:"batchSize"`
 	OutputElementChan        chan element.Element `name:"outputElementChan"`
+	UpdatableCache           bool                 `name:"updatableCache" optional:"true"`
+}
+
+// PBFWriterParams .
+type PBFWriterParams struct {
+	dig.In
+	OutputFile  string `name:"outputFile"`
+	Compression string `name:"compression" optional:"true"`
+	BlockSize   int    `name:"blockSize" optional:"true"`
+}
+
+// PBFSorterParams .
+type PBFSorterParams struct {
+	dig.In
+	LevelDBPath   string `name:"levelDBPath"`
+	SortChunkSize int    `name:"sortChunkSize" optional:"true"`
+}
+
+// PBFRenumbererParams .
+type PBFRenumbererParams struct {
+	dig.In
+	MappingFile string `name:"mappingFile"`
+	LevelDBPath string `name:"levelDBPath"`
+	BatchSize   int    `name:"batchSize"`
+}
+
+// IDIndexerParams .
+type IDIndexerParams struct {
+	dig.In
+	ElementRefs   []ElementRef `name:"elementRefs"`
+	AddReferenced bool         `name:"addReferenced" optional:"true"`
+}
+
+// BoundaryIndexerParams .
+type BoundaryIndexerParams struct {
+	dig.In
+	BoundaryRelation int64  `name:"boundaryRelation"`
+	LevelDBPath      string `name:"levelDBPath"`
+	BatchSize        int    `name:"batchSize"`
+}
+
+// PBFLocationsOnWaysParams .
+type PBFLocationsOnWaysParams struct {
+	dig.In
+	LevelDBPath       string `name:"levelDBPath"`
+	BatchSize         int    `name:"batchSize"`
+	KeepUntaggedNodes bool   `name:"keepUntaggedNodes" optional:"true"`
+}
+
+// PBFExtractParams .
+type PBFExtractParams struct {
+	dig.In
+	PBFIndexer               PBFDataParser `name:"pbfIndexer"`
+	PBFRelationMemberIndexer PBFDataParser `name:"pbfRelationMemberIndexer"`
+	// LevelDBPath holds the sorted copy of unsorted input, default the
+	// system temp directory.
+	LevelDBPath string `name:"levelDBPath" optional:"true"`
+}
+
+// ChangeApplierParams .
+type ChangeApplierParams struct {
+	dig.In
+	ChangeFile        string               `name:"changeFile"`
+	ChangeSource      Source               `name:"changeSource" optional:"true"`
+	LevelDBPath       string               `name:"levelDBPath"`
+	OutputElementChan chan element.Element `name:"outputElementChan"`
+}
+
+// ReplicatorParams .
+type ReplicatorParams struct {
+	dig.In
+	ReplicationURL string          `name:"replicationURL"`
+	StateFile      string          `name:"stateFile"`
+	LevelDBPath    string          `name:"levelDBPath"`
+	Interval       time.Duration   `name:"interval" optional:"true"`
+	Sink           ReplicationSink `name:"replicationSink"`
+}
+
+// PBFDiffParams .
+type PBFDiffParams struct {
+	dig.In
+	OldSource         Source               `name:"oldSource"`
+	NewSource         Source               `name:"newSource"`
+	LevelDBPath       string               `name:"levelDBPath"`
+	BatchSize         int                  `name:"batchSize"`
+	OutputElementChan chan element.Element `name:"outputElementChan"`
+	OutputChangeFile  string               `name:"outputChangeFile" optional:"true"`
 }
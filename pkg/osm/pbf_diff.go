@@ -0,0 +1,403 @@
+package osm
+
+import (
+	"compress/gzip"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NewPBFDiff .
+func NewPBFDiff(params PBFDiffParams) *PBFDiff {
+	return &PBFDiff{
+		OldSource:         params.OldSource,
+		NewSource:         params.NewSource,
+		LevelDBPath:       params.LevelDBPath,
+		BatchSize:         params.BatchSize,
+		OutputElementChan: params.OutputElementChan,
+		OutputChangeFile:  params.OutputChangeFile,
+	}
+}
+
+// PBFDiff compares two snapshots by id and content, then sends the
+// features that changed to OutputElementChan like ChangeApplier: ways and
+// relations whose members moved are modified too.
+// The elements that differ are written to OutputChangeFile as osmChange
+// with their version and timestamp, gzipped if named .gz.
+// The old snapshot is cached in a temp leveldb under LevelDBPath, the new
+// one like an updatable PBFParser cache.
+type PBFDiff struct {
+	OldSource         Source
+	NewSource         Source
+	LevelDBPath       string
+	BatchSize         int
+	OutputElementChan chan element.Element
+	OutputChangeFile  string
+
+	DB       *leveldb.DB
+	Batch    *leveldb.Batch
+	oldMasks *bitmask.PBFMasks
+	newMasks *bitmask.PBFMasks
+	changes  changeSet
+	firstError
+}
+
+// oldKey is the key of an old snapshot element, ex "On12".
+func oldKey(t gosmparse.MemberType, id int64) []byte {
+	return []byte("O" + memberTypeKeys[t] + strconv.FormatInt(id, 10))
+}
+
+// Run .
+func (p *PBFDiff) Run() error {
+	defer close(p.OutputElementChan)
+	for _, source := range []Source{p.OldSource, p.NewSource} {
+		if _, err := checkPBFHeader(source); err != nil {
+			return err
+		}
+	}
+
+	// Index both, features are what PBFParser would output.
+	p.oldMasks = bitmask.NewPBFMasks()
+	p.newMasks = bitmask.NewPBFMasks()
+	if err := (&PBFIndexer{Source: p.OldSource, PBFMasks: p.oldMasks}).Run(); err != nil {
+		return err
+	}
+	if err := (&PBFIndexer{Source: p.NewSource, PBFMasks: p.newMasks}).Run(); err != nil {
+		return err
+	}
+	logrus.Info("Finish index")
+
+	if err := os.MkdirAll(p.LevelDBPath, 0755); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(p.LevelDBPath, "diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, &opt.Options{DisableBlockCache: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	p.DB = db
+	p.Batch = new(leveldb.Batch)
+	p.changes = changeSet{}
+
+	// Keep metadata, the change file has versions.
+	if err := decodeInfoSource(p.OldSource, &oldSnapshotCache{p}); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	logrus.Info("Finish old snapshot.")
+
+	if err := decodeInfoSource(p.NewSource, p); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+
+	// Old elements the new snapshot didn't have.
+	iter := db.NewIterator(util.BytesPrefix([]byte("O")), nil)
+	for iter.Next() {
+		key := iter.Key()
+		id, err := strconv.ParseInt(string(key[2:]), 10, 64)
+		if err != nil {
+			iter.Release()
+			return err
+		}
+		changeKey := changeKey{Type: gosmparse.MemberType(strings.IndexByte("nwr", key[1])), ID: id}
+		p.changes[changeKey] = &touchedElement{
+			wasFeature: isFeature(p.oldMasks, changeKey),
+			deleted:    true,
+			action:     osmxml.ActionDelete,
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Parents of changed elements are in both snapshots, unchanged.
+	cache := elementCache{db: db}
+	if err := p.changes.propagate(cache, p.isFeature); err != nil {
+		return err
+	}
+	logrus.Infof("Finish new snapshot, %d elements changed", len(p.changes))
+
+	if p.OutputChangeFile != "" {
+		if err := p.writeChangeFile(cache); err != nil {
+			return err
+		}
+		logrus.Infof("Wrote %s", p.OutputChangeFile)
+	}
+	p.changes.emit(cache, p.isFeature, p.OutputElementChan)
+	return nil
+}
+
+func (p *PBFDiff) isFeature(key changeKey) bool {
+	return isFeature(p.newMasks, key)
+}
+
+// ReadNode caches the new location and compares the node.
+func (p *PBFDiff) ReadNode(n gosmparse.Node) {
+	id, val := nodeToBytes(n)
+	p.put([]byte(id), val)
+	old, found := p.old(gosmparse.NodeType, n.ID)
+	if !found || old.Node.Lat != n.Lat || old.Node.Lon != n.Lon || !sameTags(old.Node.Tags, n.Tags) {
+		p.change(gosmparse.NodeType, n.ID, found).node = n
+	}
+}
+
+// ReadWay caches and compares the way.
+func (p *PBFDiff) ReadWay(w gosmparse.Way) {
+	p.ReadWayWithLocations(w, nil)
+}
+
+// ReadWayWithLocations caches the node locations too, they are compared
+// if both snapshots have them.
+func (p *PBFDiff) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	for i, nodeID := range w.NodeIDs {
+		p.put(parentKey(gosmparse.NodeType, nodeID, gosmparse.WayType, w.ID), nil)
+		if nodes != nil {
+			node := nodes[i]
+			node.ID = nodeID
+			id, val := nodeToBytes(node)
+			p.put([]byte(id), val)
+		}
+	}
+	p.putElement(wayKey(w.ID), element.Element{Type: "Way", Way: w})
+
+	old, found := p.old(gosmparse.WayType, w.ID)
+	same := found && sameTags(old.Way.Tags, w.Tags) && sameNodeIDs(old.Way.NodeIDs, w.NodeIDs)
+	if same && nodes != nil && len(old.Elements) == len(nodes) {
+		for i, n := range old.Elements {
+			if n.Node.Lat != nodes[i].Lat || n.Node.Lon != nodes[i].Lon {
+				same = false
+			}
+		}
+	}
+	if !same {
+		p.change(gosmparse.WayType, w.ID, found)
+	}
+}
+
+// ReadRelation caches and compares the relation.
+func (p *PBFDiff) ReadRelation(r gosmparse.Relation) {
+	for _, member := range r.Members {
+		p.put(parentKey(member.Type, member.ID, gosmparse.RelationType, r.ID), nil)
+	}
+	p.putElement(relationKey(r.ID), element.Element{Type: "Relation", Relation: r})
+
+	old, found := p.old(gosmparse.RelationType, r.ID)
+	if !found || !sameTags(old.Relation.Tags, r.Tags) || !sameMembers(old.Relation.Members, r.Members) {
+		p.change(gosmparse.RelationType, r.ID, found)
+	}
+}
+
+// old returns the old snapshot element, and marks it seen.
+func (p *PBFDiff) old(t gosmparse.MemberType, id int64) (element.Element, bool) {
+	key := oldKey(t, id)
+	data, err := p.DB.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return element.Element{}, false
+	}
+	if p.fail(err) {
+		return element.Element{}, false
+	}
+	emt, err := element.ByteToElement(data)
+	if p.fail(err) {
+		return element.Element{}, false
+	}
+	p.Batch.Delete(key)
+	return emt, true
+}
+
+// change records a created or modified element.
+func (p *PBFDiff) change(t gosmparse.MemberType, id int64, found bool) *touchedElement {
+	key := changeKey{Type: t, ID: id}
+	touched := &touchedElement{wasFeature: isFeature(p.oldMasks, key), action: osmxml.ActionModify}
+	if !found {
+		touched.action = osmxml.ActionCreate
+	}
+	p.changes[key] = touched
+	return touched
+}
+
+// writeChangeFile writes the created and modified elements from the new
+// snapshot, then the deleted ones from the old snapshot.
+func (p *PBFDiff) writeChangeFile(cache elementCache) error {
+	f, err := os.Create(p.OutputChangeFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(p.OutputChangeFile, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	encoder := osmxml.NewChangeEncoder(w, pbf.Header{})
+
+	keys := p.changes.sortedKeys()
+	for _, action := range []osmxml.Action{osmxml.ActionCreate, osmxml.ActionModify} {
+		for _, key := range keys {
+			touched := p.changes[key]
+			if touched.action != action {
+				continue
+			}
+			if err := encoder.SetAction(action); err != nil {
+				return err
+			}
+			if err := p.writeNewElement(encoder, cache, key, touched); err != nil {
+				return err
+			}
+		}
+	}
+	// Deleted relations and ways first, they may refer to deleted nodes.
+	for i := len(keys) - 1; i >= 0; i-- {
+		if p.changes[keys[i]].action != osmxml.ActionDelete {
+			continue
+		}
+		emt, err := cache.element(oldKey(keys[i].Type, keys[i].ID))
+		if err != nil {
+			return err
+		}
+		if err := encoder.SetAction(osmxml.ActionDelete); err != nil {
+			return err
+		}
+		if err := WriteElement(encoder, emt); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func (p *PBFDiff) writeNewElement(encoder *osmxml.Encoder, cache elementCache, key changeKey, touched *touchedElement) error {
+	switch key.Type {
+	case gosmparse.NodeType:
+		return encoder.WriteNode(touched.node)
+	case gosmparse.WayType:
+		emt, err := cache.way(key.ID)
+		if err != nil {
+			return err
+		}
+		return encoder.WriteWay(emt.Way)
+	}
+	emt, err := cache.relation(key.ID)
+	if err != nil {
+		return err
+	}
+	return encoder.WriteRelation(emt.Relation)
+}
+
+func (p *PBFDiff) put(key, value []byte) {
+	p.Batch.Put(key, value)
+	if p.Batch.Len() > p.BatchSize {
+		p.fail(p.flush())
+	}
+}
+
+func (p *PBFDiff) putElement(key []byte, emt element.Element) {
+	data, err := emt.ToByte()
+	if p.fail(err) {
+		return
+	}
+	p.put(key, data)
+}
+
+func (p *PBFDiff) flush() error {
+	if err := p.DB.Write(p.Batch, &opt.WriteOptions{NoWriteMerge: true}); err != nil {
+		return err
+	}
+	p.Batch.Reset()
+	return nil
+}
+
+// oldSnapshotCache stores every element of the old snapshot.
+type oldSnapshotCache struct {
+	p *PBFDiff
+}
+
+func (o *oldSnapshotCache) ReadNode(n gosmparse.Node) {
+	o.p.putElement(oldKey(gosmparse.NodeType, n.ID), element.Element{Type: "Node", Node: n})
+}
+
+func (o *oldSnapshotCache) ReadWay(w gosmparse.Way) {
+	o.p.putElement(oldKey(gosmparse.WayType, w.ID), element.Element{Type: "Way", Way: w})
+}
+
+func (o *oldSnapshotCache) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	emts := make([]element.Element, len(nodes))
+	for i, n := range nodes {
+		emts[i] = element.Element{Type: "Node", Node: n}
+	}
+	o.p.putElement(oldKey(gosmparse.WayType, w.ID), element.Element{Type: "Way", Way: w, Elements: emts})
+}
+
+func (o *oldSnapshotCache) ReadRelation(r gosmparse.Relation) {
+	o.p.putElement(oldKey(gosmparse.RelationType, r.ID), element.Element{Type: "Relation", Relation: r})
+}
+
+func sameTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func sameMembers(a, b []gosmparse.RelationMember) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameNodeIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
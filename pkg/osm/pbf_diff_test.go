@@ -0,0 +1,108 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// diffNew is changeBase after changeFile.
+const diffNew = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+ <node id="1" version="1" timestamp="2020-01-01T00:00:00Z" lat="0" lon="0"/>
+ <node id="2" version="2" timestamp="2020-02-01T00:00:00Z" lat="0.5" lon="1"/>
+ <node id="3" version="1" timestamp="2020-01-01T00:00:00Z" lat="1" lon="1"/>
+ <node id="5" version="1" timestamp="2020-02-01T00:00:00Z" lat="3" lon="3"><tag k="shop" v="bakery"/></node>
+ <way id="10" version="1" timestamp="2020-01-01T00:00:00Z"><nd ref="1"/><nd ref="2"/><nd ref="3"/><tag k="highway" v="residential"/></way>
+ <way id="11" version="2" timestamp="2020-02-01T00:00:00Z"><nd ref="1"/><nd ref="3"/><tag k="building" v="yes"/></way>
+ <relation id="20" version="1" timestamp="2020-01-01T00:00:00Z"><member type="way" ref="11" role=""/><tag k="type" v="route"/></relation>
+</osm>
+`
+
+// oscCollector collects the action, version and date of the elements of
+// an osmChange file, ex "modify 2 2020-02-01".
+type oscCollector map[string]string
+
+func (c oscCollector) add(key string, a osmxml.Action, e gosmparse.Element) {
+	c[key+itoa(e.ID)] = a.String() + " " + strconv.Itoa(e.Info.Version) + " " + e.Info.Timestamp.Format("2006-01-02")
+}
+
+func (c oscCollector) ReadNodeChange(a osmxml.Action, n gosmparse.Node) { c.add("n", a, n.Element) }
+func (c oscCollector) ReadWayChange(a osmxml.Action, w gosmparse.Way)   { c.add("w", a, w.Element) }
+func (c oscCollector) ReadRelationChange(a osmxml.Action, r gosmparse.Relation) {
+	c.add("r", a, r.Element)
+}
+
+func TestPBFDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldFile := filepath.Join(dir, "old.osm")
+	newFile := filepath.Join(dir, "new.osm")
+	oscFile := filepath.Join(dir, "diff.osc.gz")
+	for file, data := range map[string]string{oldFile: changeBase, newFile: diffNew} {
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputChan := make(chan element.Element)
+	diff := NewPBFDiff(PBFDiffParams{
+		OldSource:         FileSource(oldFile),
+		NewSource:         FileSource(newFile),
+		LevelDBPath:       filepath.Join(dir, "cache"),
+		BatchSize:         2,
+		OutputElementChan: outputChan,
+		OutputChangeFile:  oscFile,
+	})
+	done := make(chan error, 1)
+	go func() { done <- diff.Run() }()
+	got := map[string]string{}
+	for emt := range outputChan {
+		got[emt.Type+itoa(emt.GetID())] = emt.Action
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Node4":      "delete",
+		"Node5":      "create",
+		"Way10":      "modify",
+		"Way11":      "create",
+		"Relation20": "modify",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	reader, err := FileSource(oscFile).Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	osc := oscCollector{}
+	if err := osmxml.NewDecoderWithInfo(reader).ParseChange(osc); err != nil {
+		t.Fatal(err)
+	}
+	wantOSC := oscCollector{
+		"n2":  "modify 2 2020-02-01",
+		"n4":  "delete 1 2020-01-01",
+		"n5":  "create 1 2020-02-01",
+		"w11": "modify 2 2020-02-01",
+	}
+	if !reflect.DeepEqual(osc, wantOSC) {
+		t.Errorf("osc %v, want %v", osc, wantOSC)
+	}
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,193 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/sirupsen/logrus"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"os"
+)
+
+// NewPBFExtractWriter .
+func NewPBFExtractWriter(
+	defaultParams DefaultPBFParserParams,
+	writerParams PBFWriterParams,
+	params PBFExtractParams,
+) PBFDataParser {
+	return &PBFExtractWriter{
+		PBFFile:                  defaultParams.PBFFile,
+		Source:                   defaultParams.source(),
+		PBFMasks:                 defaultParams.PBFMasks,
+		PBFIndexer:               params.PBFIndexer,
+		PBFRelationMemberIndexer: params.PBFRelationMemberIndexer,
+		LevelDBPath:              params.LevelDBPath,
+		OutputFile:               writerParams.OutputFile,
+		Compression:              writerParams.Compression,
+		BlockSize:                writerParams.BlockSize,
+	}
+}
+
+// PBFExtractWriter writes the elements PBFParser would use to OutputFile:
+// the elements kept by the indexers and every member and node they need.
+// Custom indexers filling PBFMasks choose what survives. The output is
+// Sort.Type_then_ID, unsorted input is sorted under LevelDBPath first.
+type PBFExtractWriter struct {
+	PBFFile  string
+	Source   Source
+	PBFMasks *bitmask.PBFMasks
+	// Indexer
+	PBFIndexer               PBFDataParser
+	PBFRelationMemberIndexer PBFDataParser
+	LevelDBPath              string
+	// Output
+	OutputFile  string
+	Compression string
+	BlockSize   int
+
+	writer ElementWriter
+	err    error
+}
+
+// Run .
+func (p *PBFExtractWriter) Run() error {
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+
+	// Index .
+	if err := p.PBFIndexer.Run(); err != nil {
+		return err
+	}
+	if err := p.PBFRelationMemberIndexer.Run(); err != nil {
+		return err
+	}
+	logrus.Info("Finish index")
+
+	tempDir := p.LevelDBPath
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	source, removeSorted, err := sortedSource(p.Source, header, tempDir)
+	if err != nil {
+		return err
+	}
+	defer removeSorted()
+
+	// The header comes first, scan for its bbox.
+	scan := &extractScan{masks: p.PBFMasks}
+	if err := decodeSource(source, scan); err != nil {
+		return err
+	}
+	outHeader := *header
+	outHeader.WritingProgram = ""
+	outHeader.BBox = scan.bbox()
+	outHeader.OptionalFeatures = nil
+	for _, feature := range header.OptionalFeatures {
+		if feature != pbf.FeatureSortTypeThenID {
+			outHeader.OptionalFeatures = append(outHeader.OptionalFeatures, feature)
+		}
+	}
+	outHeader.OptionalFeatures = append(outHeader.OptionalFeatures, pbf.FeatureSortTypeThenID)
+
+	if p.writer, err = CreateElementWriter(p.OutputFile, outHeader, p.Compression, p.BlockSize); err != nil {
+		return err
+	}
+	if err := decodeSource(source, p); err != nil {
+		p.writer.Close()
+		return err
+	}
+	if p.err != nil {
+		p.writer.Close()
+		return p.err
+	}
+	if err := p.writer.Close(); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote %d nodes, %d ways, %d relations to %s", scan.nodes, scan.ways, scan.relations, p.OutputFile)
+	return nil
+}
+
+// ReadNode .
+func (p *PBFExtractWriter) ReadNode(n gosmparse.Node) {
+	if p.err == nil && keepNode(p.PBFMasks, n.ID) {
+		p.err = p.writer.WriteNode(n)
+	}
+}
+
+// ReadWay .
+func (p *PBFExtractWriter) ReadWay(w gosmparse.Way) {
+	if p.err == nil && keepWay(p.PBFMasks, w.ID) {
+		p.err = p.writer.WriteWay(w)
+	}
+}
+
+// ReadWayWithLocations .
+func (p *PBFExtractWriter) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if p.err == nil && keepWay(p.PBFMasks, w.ID) {
+		p.err = p.writer.WriteWayWithLocations(w, nodes)
+	}
+}
+
+// ReadRelation .
+func (p *PBFExtractWriter) ReadRelation(r gosmparse.Relation) {
+	if p.err == nil && keepRelation(p.PBFMasks, r.ID) {
+		p.err = p.writer.WriteRelation(r)
+	}
+}
+
+func keepNode(m *bitmask.PBFMasks, id int64) bool {
+	return m.Nodes.Has(id) || m.WayRefs.Has(id) || m.RelNodes.Has(id)
+}
+
+func keepWay(m *bitmask.PBFMasks, id int64) bool {
+	return m.Ways.Has(id) || m.RelWays.Has(id)
+}
+
+func keepRelation(m *bitmask.PBFMasks, id int64) bool {
+	return m.Relations.Has(id) || m.RelRelation.Has(id)
+}
+
+// extractScan counts the kept elements and their bbox.
+type extractScan struct {
+	masks     *bitmask.PBFMasks
+	nodes     int64
+	ways      int64
+	relations int64
+
+	minLat, maxLat, minLon, maxLon float64
+}
+
+func (s *extractScan) ReadNode(n gosmparse.Node) {
+	if !keepNode(s.masks, n.ID) {
+		return
+	}
+	if s.nodes == 0 {
+		s.minLat, s.maxLat, s.minLon, s.maxLon = n.Lat, n.Lat, n.Lon, n.Lon
+	}
+	s.minLat = math.Min(s.minLat, n.Lat)
+	s.maxLat = math.Max(s.maxLat, n.Lat)
+	s.minLon = math.Min(s.minLon, n.Lon)
+	s.maxLon = math.Max(s.maxLon, n.Lon)
+	s.nodes++
+}
+
+func (s *extractScan) ReadWay(w gosmparse.Way) {
+	if keepWay(s.masks, w.ID) {
+		s.ways++
+	}
+}
+
+func (s *extractScan) ReadRelation(r gosmparse.Relation) {
+	if keepRelation(s.masks, r.ID) {
+		s.relations++
+	}
+}
+
+func (s *extractScan) bbox() *pbf.BBox {
+	if s.nodes == 0 {
+		return nil
+	}
+	return &pbf.BBox{Left: s.minLon, Right: s.maxLon, Top: s.maxLat, Bottom: s.minLat}
+}
@@ -0,0 +1,155 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"go.uber.org/dig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// refCheck collects ids and the node ids ways refer to.
+type refCheck struct {
+	nodes   map[int64]bool
+	missing int
+}
+
+func (r *refCheck) ReadNode(n gosmparse.Node) { r.nodes[n.ID] = true }
+
+func (r *refCheck) ReadWay(w gosmparse.Way) {
+	for _, id := range w.NodeIDs {
+		if !r.nodes[id] {
+			r.missing++
+		}
+	}
+}
+
+func (r *refCheck) ReadRelation(rel gosmparse.Relation) {}
+
+// extractInput is unsorted. The shop node 7, way 10 and relation 20 are
+// kept with the nodes and member way 11 they need, the untagged way 12,
+// its node 4 and the untagged relation 21 are not.
+const extractInput = `<osm version="0.6">
+ <node id="7" version="1" lat="2" lon="2"><tag k="shop" v="bakery"/></node>
+ <node id="1" version="1" lat="0" lon="0"/>
+ <node id="2" version="1" lat="0" lon="1"/>
+ <node id="3" version="1" lat="1" lon="1"/>
+ <node id="4" version="1" lat="5" lon="5"/>
+ <node id="5" version="1" lat="-1" lon="1"/>
+ <node id="6" version="1" lat="0.5" lon="0.5"/>
+ <way id="12" version="1"><nd ref="4"/><nd ref="2"/></way>
+ <way id="11" version="1"><nd ref="5"/><nd ref="3"/></way>
+ <way id="10" version="1"><nd ref="1"/><nd ref="2"/><nd ref="3"/><tag k="highway" v="primary"/></way>
+ <relation id="21" version="1"><member type="way" ref="10" role=""/></relation>
+ <relation id="20" version="1">
+  <member type="way" ref="11" role=""/>
+  <member type="node" ref="6" role="stop"/>
+  <tag k="type" v="route"/>
+ </relation>
+</osm>`
+
+// extractRead collects the ids of a pass, in order, and the refs missing
+// from it.
+type extractRead struct {
+	nodes, ways, relations []int64
+	missing                int
+}
+
+func (r *extractRead) has(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *extractRead) ReadNode(n gosmparse.Node) { r.nodes = append(r.nodes, n.ID) }
+
+func (r *extractRead) ReadWay(w gosmparse.Way) {
+	r.ways = append(r.ways, w.ID)
+	for _, id := range w.NodeIDs {
+		if !r.has(r.nodes, id) {
+			r.missing++
+		}
+	}
+}
+
+func (r *extractRead) ReadRelation(rel gosmparse.Relation) {
+	r.relations = append(r.relations, rel.ID)
+	for _, m := range rel.Members {
+		if (m.Type == gosmparse.NodeType && !r.has(r.nodes, m.ID)) ||
+			(m.Type == gosmparse.WayType && !r.has(r.ways, m.ID)) {
+			r.missing++
+		}
+	}
+}
+
+func TestPBFExtractWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := writeExtracts(t, dir, extractInput)[0]
+	outputFile := filepath.Join(dir, "extract.osm.pbf")
+
+	c := dig.New()
+	for _, p := range []struct {
+		constructor interface{}
+		name        string
+	}{
+		{func() string { return input }, "pbfFile"},
+		{func() *bitmask.PBFMasks { return bitmask.NewPBFMasks() }, "pbfMasks"},
+		{NewPBFIndexer, "pbfIndexer"},
+		{NewPBFRelationMemberIndexer, "pbfRelationMemberIndexer"},
+		{func() string { return outputFile }, "outputFile"},
+		{func() string { return "zstd" }, "compression"},
+		{func() string { return filepath.Join(dir, "cache") }, "levelDBPath"},
+	} {
+		if err := c.Provide(p.constructor, dig.Name(p.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Provide(NewPBFExtractWriter); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Invoke(func(writer PBFDataParser) error {
+		return writer.Run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := NewPBFFileInfo(DefaultPBFParserParams{PBFFile: outputFile})
+	if err := info.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Info.Sorted || !info.Info.Header.HasOptionalFeature(pbf.FeatureSortTypeThenID) {
+		t.Error("extract of unsorted input is not sorted")
+	}
+	if want := (pbf.BBox{Left: 0, Right: 2, Top: 2, Bottom: -1}); info.Info.Header.BBox == nil || *info.Info.Header.BBox != want {
+		t.Errorf("header bbox %v, want %v", info.Info.Header.BBox, want)
+	}
+
+	read := &extractRead{}
+	if err := decodeSource(FileSource(outputFile), read); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3, 5, 6, 7}; !reflect.DeepEqual(read.nodes, want) {
+		t.Errorf("nodes %v, want %v", read.nodes, want)
+	}
+	if want := []int64{10, 11}; !reflect.DeepEqual(read.ways, want) {
+		t.Errorf("ways %v, want %v", read.ways, want)
+	}
+	if want := []int64{20}; !reflect.DeepEqual(read.relations, want) {
+		t.Errorf("relations %v, want %v", read.relations, want)
+	}
+	if read.missing > 0 {
+		t.Errorf("%d references missing", read.missing)
+	}
+}
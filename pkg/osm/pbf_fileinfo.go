@@ -0,0 +1,150 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"strings"
+)
+
+// supportedFeatures are the required header features PBFParser can read.
+var supportedFeatures = []string{
+	pbf.FeatureOsmSchema,
+	pbf.FeatureDenseNodes,
+}
+
+// ReadPBFHeader reads the header block of a pbf file.
+func ReadPBFHeader(pbfFile string) (*pbf.Header, error) {
+	return ReadSourceHeader(FileSource(pbfFile))
+}
+
+// ReadSourceHeader reads the header block of a source.
+func ReadSourceHeader(source Source) (*pbf.Header, error) {
+	decoder, reader, err := openDecoder(source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return decoder.Header()
+}
+
+// checkPBFHeader refuses files whose required features we can't handle.
+func checkPBFHeader(source Source) (*pbf.Header, error) {
+	header, err := ReadSourceHeader(source)
+	if err != nil {
+		return nil, err
+	}
+	if unsupported := header.UnsupportedFeatures(supportedFeatures...); len(unsupported) > 0 {
+		return nil, fmt.Errorf(
+			"%s requires unsupported features: %s",
+			source.Name(), strings.Join(unsupported, ", "),
+		)
+	}
+	return header, nil
+}
+
+// IDRange .
+type IDRange struct {
+	Min int64
+	Max int64
+}
+
+// FileInfo is the summary of a pbf file.
+type FileInfo struct {
+	Header      *pbf.Header
+	Nodes       int64
+	Ways        int64
+	Relations   int64
+	NodeIDs     IDRange
+	WayIDs      IDRange
+	RelationIDs IDRange
+	// Sorted is true if the data follows Sort.Type_then_ID.
+	Sorted bool
+}
+
+// NewPBFFileInfo .
+func NewPBFFileInfo(params DefaultPBFParserParams) *PBFFileInfo {
+	return &PBFFileInfo{
+		PBFFile: params.PBFFile,
+		Source:  params.source(),
+	}
+}
+
+// PBFFileInfo scans all blobs of a pbf file to build a FileInfo.
+type PBFFileInfo struct {
+	PBFFile string
+	Source  Source
+	Info    FileInfo
+
+	order sortCheck
+}
+
+// Run .
+func (p *PBFFileInfo) Run() error {
+	decoder, reader, err := openDecoder(p.Source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header, err := decoder.Header()
+	if err != nil {
+		return err
+	}
+	p.Info = FileInfo{Header: header}
+	p.order = sortCheck{}
+	if err := decoder.Parse(p); err != nil {
+		return err
+	}
+	p.Info.Sorted = p.order.sorted()
+	return nil
+}
+
+// ReadNode .
+func (p *PBFFileInfo) ReadNode(n gosmparse.Node) {
+	p.observe(gosmparse.NodeType, n.ID, &p.Info.Nodes, &p.Info.NodeIDs)
+}
+
+// ReadWay .
+func (p *PBFFileInfo) ReadWay(w gosmparse.Way) {
+	p.observe(gosmparse.WayType, w.ID, &p.Info.Ways, &p.Info.WayIDs)
+}
+
+// ReadRelation .
+func (p *PBFFileInfo) ReadRelation(r gosmparse.Relation) {
+	p.observe(gosmparse.RelationType, r.ID, &p.Info.Relations, &p.Info.RelationIDs)
+}
+
+// observe updates count, id range and sort order with one element.
+func (p *PBFFileInfo) observe(t gosmparse.MemberType, id int64, count *int64, ids *IDRange) {
+	if *count == 0 || id < ids.Min {
+		ids.Min = id
+	}
+	if *count == 0 || id > ids.Max {
+		ids.Max = id
+	}
+	*count++
+	p.order.observe(t, id)
+}
+
+// sortCheck tells if elements come in Sort.Type_then_ID order.
+type sortCheck struct {
+	seen     bool
+	unsorted bool
+	lastType gosmparse.MemberType
+	lastID   int64
+}
+
+func (s *sortCheck) observe(t gosmparse.MemberType, id int64) {
+	if s.seen && (t < s.lastType || (t == s.lastType && id <= s.lastID)) {
+		s.unsorted = true
+	}
+	s.seen = true
+	s.lastType = t
+	s.lastID = id
+}
+
+// sorted is false once an element came out of order.
+func (s *sortCheck) sorted() bool {
+	return !s.unsorted
+}
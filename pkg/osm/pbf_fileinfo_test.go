@@ -0,0 +1,96 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeTestPBF writes nodes, then ways, then relations of the ids given
+// to a pbf with header.
+func writeTestPBF(t *testing.T, file string, header pbf.Header, nodes, ways, relations []int64) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	encoder := pbf.NewEncoder(f, header)
+	for _, id := range nodes {
+		if err := encoder.WriteNode(gosmparse.Node{Element: gosmparse.Element{ID: id}, Lat: 25, Lon: 121}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range ways {
+		if err := encoder.WriteWay(gosmparse.Way{Element: gosmparse.Element{ID: id}, NodeIDs: nodes}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range relations {
+		r := gosmparse.Relation{Element: gosmparse.Element{ID: id}, Members: []gosmparse.RelationMember{
+			{ID: ways[0], Type: gosmparse.WayType, Role: "outer"},
+		}}
+		if err := encoder.WriteRelation(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPBFFileInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-fileinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	header := pbf.Header{
+		BBox:                      &pbf.BBox{Left: 120, Right: 122, Top: 25.5, Bottom: 21.5},
+		RequiredFeatures:          []string{pbf.FeatureOsmSchema, pbf.FeatureDenseNodes},
+		OptionalFeatures:          []string{pbf.FeatureSortTypeThenID},
+		WritingProgram:            "osmium/1.14.0",
+		Source:                    "test",
+		ReplicationTimestamp:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		ReplicationSequenceNumber: 3245,
+		ReplicationBaseURL:        "https://download.geofabrik.de/asia/taiwan-updates",
+	}
+	sortedFile := filepath.Join(dir, "sorted.osm.pbf")
+	writeTestPBF(t, sortedFile, header, []int64{1, 2, 7}, []int64{10, 12}, []int64{20})
+
+	parser := NewPBFFileInfo(DefaultPBFParserParams{PBFFile: sortedFile})
+	if err := parser.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parser.Info.Header, &header) {
+		t.Errorf("header %+v, want %+v", parser.Info.Header, header)
+	}
+	want := FileInfo{
+		Header:      parser.Info.Header,
+		Nodes:       3,
+		Ways:        2,
+		Relations:   1,
+		NodeIDs:     IDRange{Min: 1, Max: 7},
+		WayIDs:      IDRange{Min: 10, Max: 12},
+		RelationIDs: IDRange{Min: 20, Max: 20},
+		Sorted:      true,
+	}
+	if parser.Info != want {
+		t.Errorf("info %+v, want %+v", parser.Info, want)
+	}
+
+	unsortedFile := filepath.Join(dir, "unsorted.osm.pbf")
+	writeTestPBF(t, unsortedFile, pbf.Header{}, []int64{7, 1}, []int64{10}, nil)
+	parser = NewPBFFileInfo(DefaultPBFParserParams{PBFFile: unsortedFile})
+	if err := parser.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if parser.Info.Sorted || parser.Info.Nodes != 2 || parser.Info.NodeIDs != (IDRange{Min: 1, Max: 7}) {
+		t.Errorf("unsorted info %+v", parser.Info)
+	}
+}
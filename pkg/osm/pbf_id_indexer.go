@@ -0,0 +1,168 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/sirupsen/logrus"
+	"github.com/thomersch/gosmparse"
+	"strconv"
+	"strings"
+)
+
+// ElementRef is a typed element id.
+type ElementRef struct {
+	Type gosmparse.MemberType
+	ID   int64
+}
+
+// ParseElementRef parses an id like osmium getid, ex "n789", "w456",
+// "r123" or "n-5". A bare id is a node.
+func ParseElementRef(s string) (ElementRef, error) {
+	ref := ElementRef{Type: gosmparse.NodeType}
+	text := s
+	if text != "" {
+		if t := strings.IndexByte("nwr", text[0]); t >= 0 {
+			ref.Type = gosmparse.MemberType(t)
+			text = text[1:]
+		}
+	}
+	id, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return ref, fmt.Errorf("invalid element id %q, want ex n789, w456 or r123", s)
+	}
+	ref.ID = id
+	return ref, nil
+}
+
+// String .
+func (r ElementRef) String() string {
+	return memberTypeKeys[r.Type] + strconv.FormatInt(r.ID, 10)
+}
+
+// NewIDIndexer .
+func NewIDIndexer(defaultParams DefaultPBFParserParams, params IDIndexerParams) PBFDataParser {
+	return &IDIndexer{
+		PBFFile:       defaultParams.PBFFile,
+		Source:        defaultParams.source(),
+		PBFMasks:      defaultParams.PBFMasks,
+		Refs:          params.ElementRefs,
+		AddReferenced: params.AddReferenced,
+	}
+}
+
+// IDIndexer is a PBFIndexer keeping the elements of Refs, tagged or not.
+// With AddReferenced it also marks what they need, recursively: relation
+// members go to the Rel masks and way nodes to WayRefs or RelNodes, like
+// PBFIndexer and PBFRelationMemberIndexer mark them for tagged elements.
+// Relations of relations take a pass per level.
+type IDIndexer struct {
+	PBFFile       string
+	Source        Source
+	PBFMasks      *bitmask.PBFMasks
+	Refs          []ElementRef
+	AddReferenced bool
+
+	expanded map[int64]bool
+	added    bool
+	found    map[ElementRef]bool
+}
+
+// Run .
+func (p *IDIndexer) Run() error {
+	for _, ref := range p.Refs {
+		switch ref.Type {
+		case gosmparse.NodeType:
+			p.PBFMasks.Nodes.Insert(ref.ID)
+		case gosmparse.WayType:
+			p.PBFMasks.Ways.Insert(ref.ID)
+		case gosmparse.RelationType:
+			p.PBFMasks.Relations.Insert(ref.ID)
+		}
+	}
+	p.expanded = map[int64]bool{}
+	p.found = map[ElementRef]bool{}
+	for _, ref := range p.Refs {
+		p.found[ref] = false
+	}
+	for {
+		p.added = false
+		if err := decodeSource(p.Source, p); err != nil {
+			return err
+		}
+		// Members of the relations expanded in this pass need another one.
+		if !p.AddReferenced || !p.added {
+			break
+		}
+	}
+	for _, ref := range p.Refs {
+		if !p.found[ref] {
+			logrus.Warningf("%s not found in %s", ref, p.Source.Name())
+		}
+	}
+	return nil
+}
+
+func (p *IDIndexer) see(t gosmparse.MemberType, id int64) {
+	ref := ElementRef{Type: t, ID: id}
+	if _, requested := p.found[ref]; requested {
+		p.found[ref] = true
+	}
+}
+
+// ReadNode .
+func (p *IDIndexer) ReadNode(n gosmparse.Node) {
+	if p.PBFMasks.Nodes.Has(n.ID) {
+		p.see(gosmparse.NodeType, n.ID)
+	}
+}
+
+// ReadWay .
+func (p *IDIndexer) ReadWay(w gosmparse.Way) {
+	requested := p.PBFMasks.Ways.Has(w.ID)
+	if requested {
+		p.see(gosmparse.WayType, w.ID)
+	}
+	if !p.AddReferenced {
+		return
+	}
+	switch {
+	case requested:
+		for _, nodeID := range w.NodeIDs {
+			p.PBFMasks.WayRefs.Insert(nodeID)
+		}
+	case p.PBFMasks.RelWays.Has(w.ID):
+		for _, nodeID := range w.NodeIDs {
+			p.PBFMasks.RelNodes.Insert(nodeID)
+		}
+	}
+}
+
+// ReadWayWithLocations marks no nodes, located ways carry them.
+func (p *IDIndexer) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if p.PBFMasks.Ways.Has(w.ID) {
+		p.see(gosmparse.WayType, w.ID)
+	}
+}
+
+// ReadRelation .
+func (p *IDIndexer) ReadRelation(r gosmparse.Relation) {
+	requested := p.PBFMasks.Relations.Has(r.ID)
+	if requested {
+		p.see(gosmparse.RelationType, r.ID)
+	}
+	if !p.AddReferenced || p.expanded[r.ID] || !(requested || p.PBFMasks.RelRelation.Has(r.ID)) {
+		return
+	}
+	p.expanded[r.ID] = true
+	p.added = true
+	for _, member := range r.Members {
+		switch member.Type {
+		case gosmparse.NodeType:
+			p.PBFMasks.RelNodes.Insert(member.ID)
+		case gosmparse.WayType:
+			p.PBFMasks.RelWays.Insert(member.ID)
+		case gosmparse.RelationType:
+			p.PBFMasks.RelRelation.Insert(member.ID)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Relation 31 has sub relation 30, a boundary of ways 10 and 11.
+const boundaryExtract = `<osm version="0.6">
+ <node id="1" lat="0" lon="0"/>
+ <node id="2" lat="0" lon="1"/>
+ <node id="3" lat="1" lon="1"/>
+ <node id="4" lat="5" lon="5"><tag k="place" v="town"/></node>
+ <node id="5" lat="6" lon="6"/>
+ <way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/></way>
+ <way id="11"><nd ref="3"/><nd ref="1"/></way>
+ <way id="12"><nd ref="4"/><nd ref="5"/><tag k="highway" v="track"/></way>
+ <relation id="30"><member type="way" ref="10" role="outer"/><member type="way" ref="11" role="outer"/><member type="node" ref="4" role="label"/><tag k="type" v="boundary"/></relation>
+ <relation id="31"><member type="relation" ref="30" role="subarea"/><tag k="type" v="collection"/></relation>
+</osm>`
+
+func TestParseElementRef(t *testing.T) {
+	for s, want := range map[string]ElementRef{
+		"r123": {Type: 2, ID: 123},
+		"w456": {Type: 1, ID: 456},
+		"n-5":  {Type: 0, ID: -5},
+		"789":  {Type: 0, ID: 789},
+	} {
+		if ref, err := ParseElementRef(s); err != nil || ref != want {
+			t.Errorf("%s: got %v %v, want %v", s, ref, err, want)
+		}
+		if ref, _ := ParseElementRef(s); s != "789" && ref.String() != s {
+			t.Errorf("%s: string %s", s, ref)
+		}
+	}
+	for _, s := range []string{"", "x1", "w", "r1a"} {
+		if _, err := ParseElementRef(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestIDIndexerExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-getid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, boundaryExtract)
+
+	for _, tc := range []struct {
+		addReferenced     bool
+		nodes, ways, rels int
+	}{
+		{false, 0, 0, 1},
+		{true, 4, 2, 2},
+	} {
+		outputFile := filepath.Join(dir, "getid.osm")
+		defaultParams := DefaultPBFParserParams{PBFFile: files[0], PBFMasks: bitmask.NewPBFMasks()}
+		writer := NewPBFExtractWriter(defaultParams, PBFWriterParams{OutputFile: outputFile}, PBFExtractParams{
+			PBFIndexer: NewIDIndexer(defaultParams, IDIndexerParams{
+				ElementRefs:   []ElementRef{{Type: 2, ID: 31}},
+				AddReferenced: tc.addReferenced,
+			}),
+			PBFRelationMemberIndexer: NewPBFRelationMemberIndexer(defaultParams),
+		})
+		if err := writer.Run(); err != nil {
+			t.Fatal(err)
+		}
+		c := &elementCollector{}
+		if err := decodeSource(FileSource(outputFile), c); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.nodes) != tc.nodes || len(c.ways) != tc.ways || len(c.relations) != tc.rels {
+			t.Errorf("add referenced %v: got %d nodes, %d ways, %d relations, want %d, %d, %d",
+				tc.addReferenced, len(c.nodes), len(c.ways), len(c.relations), tc.nodes, tc.ways, tc.rels)
+		}
+	}
+}
+
+func TestIDIndexerGeoJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-getid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, boundaryExtract)
+
+	defaultParams := DefaultPBFParserParams{PBFFile: files[0], PBFMasks: bitmask.NewPBFMasks()}
+	features := parseElements(t, defaultParams, PBFParserParams{
+		LevelDBPath: filepath.Join(dir, "cache"),
+		PBFIndexer: NewIDIndexer(defaultParams, IDIndexerParams{
+			// Untagged way 11 too, node 99 is missing.
+			ElementRefs:   []ElementRef{{Type: 2, ID: 31}, {Type: 1, ID: 11}, {Type: 0, ID: 99}},
+			AddReferenced: true,
+		}),
+	})
+	if len(features) != 2 {
+		t.Fatalf("got %d features, want way 11 and relation 31", len(features))
+	}
+	if way := features[0]; way.Type != "Way" || way.Way.ID != 11 || len(way.Elements) != 2 {
+		t.Errorf("way %+v", way)
+	}
+	rel := features[1]
+	if rel.Type != "Relation" || rel.Relation.ID != 31 || len(rel.Elements) != 1 || len(rel.Elements[0].Elements) != 3 {
+		t.Errorf("relation %+v", rel)
+	}
+}
@@ -3,7 +3,6 @@ package osm
 import (
 	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
 	"github.com/thomersch/gosmparse"
-	"os"
 	"sync"
 )
 
@@ -11,6 +10,7 @@ import (
 func NewPBFIndexer(params DefaultPBFParserParams) PBFDataParser {
 	return &PBFIndexer{
 		PBFFile:  params.PBFFile,
+		Source:   params.source(),
 		PBFMasks: params.PBFMasks,
 	}
 }
@@ -18,19 +18,19 @@ func NewPBFIndexer(params DefaultPBFParserParams) PBFDataParser {
 // PBFIndexer .
 type PBFIndexer struct {
 	PBFFile  string
+	Source   Source
 	PBFMasks *bitmask.PBFMasks
 	MapLock  sync.RWMutex
 }
 
 // Run .
 func (p *PBFIndexer) Run() error {
-	reader, err := os.Open(p.PBFFile)
+	decoder, reader, err := openDecoder(p.Source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	decoder := gosmparse.NewDecoder(reader)
 	if err := decoder.Parse(p); err != nil {
 		return err
 	}
@@ -54,6 +54,13 @@ func (p *PBFIndexer) ReadWay(w gosmparse.Way) {
 	}
 }
 
+// ReadWayWithLocations indexes a located way, its nodes need no caching.
+func (p *PBFIndexer) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if len(w.Tags) > 0 {
+		p.PBFMasks.Ways.Insert(w.ID)
+	}
+}
+
 // ReadRelation .
 func (p *PBFIndexer) ReadRelation(r gosmparse.Relation) {
 	if len(r.Tags) > 0 {
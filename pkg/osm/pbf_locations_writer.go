@@ -0,0 +1,191 @@
+package osm
+
+import (
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+)
+
+// NewPBFLocationsOnWaysWriter .
+func NewPBFLocationsOnWaysWriter(
+	defaultParams DefaultPBFParserParams,
+	writerParams PBFWriterParams,
+	params PBFLocationsOnWaysParams,
+) PBFDataParser {
+	return &PBFLocationsOnWaysWriter{
+		PBFFile:           defaultParams.PBFFile,
+		Source:            defaultParams.source(),
+		PBFMasks:          defaultParams.PBFMasks,
+		OutputFile:        writerParams.OutputFile,
+		Compression:       writerParams.Compression,
+		BlockSize:         writerParams.BlockSize,
+		LevelDBPath:       params.LevelDBPath,
+		BatchSize:         params.BatchSize,
+		KeepUntaggedNodes: params.KeepUntaggedNodes,
+	}
+}
+
+// PBFLocationsOnWaysWriter copies a pbf file, adding the location of every
+// way node to the way itself (LocationsOnWays).
+// Untagged nodes are dropped unless they are relation members. Node
+// locations are cached in a temp leveldb under LevelDBPath.
+type PBFLocationsOnWaysWriter struct {
+	PBFFile           string
+	Source            Source
+	PBFMasks          *bitmask.PBFMasks
+	OutputFile        string
+	Compression       string
+	BlockSize         int
+	KeepUntaggedNodes bool
+	// DB
+	DB          *leveldb.DB
+	LevelDBPath string
+	Batch       *leveldb.Batch
+	BatchSize   int
+
+	writer ElementWriter
+	firstError
+}
+
+// Run .
+func (p *PBFLocationsOnWaysWriter) Run() error {
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+
+	// A temp cache, node locations of other files must not resolve.
+	if err := os.MkdirAll(p.LevelDBPath, 0755); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(p.LevelDBPath, "locations")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, &opt.Options{DisableBlockCache: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	p.DB = db
+	p.Batch = new(leveldb.Batch)
+
+	if !p.KeepUntaggedNodes {
+		if err := decodeSource(p.Source, &relationNodeIndexer{PBFMasks: p.PBFMasks}); err != nil {
+			return err
+		}
+	}
+
+	outHeader := *header
+	if !outHeader.HasOptionalFeature(pbf.FeatureLocationsOnWays) {
+		outHeader.OptionalFeatures = append(
+			append([]string{}, header.OptionalFeatures...),
+			pbf.FeatureLocationsOnWays,
+		)
+	}
+	outHeader.WritingProgram = ""
+	if p.writer, err = CreateElementWriter(p.OutputFile, outHeader, p.Compression, p.BlockSize); err != nil {
+		return err
+	}
+
+	if err := decodeSource(p.Source, p); err != nil {
+		p.writer.Close()
+		return err
+	}
+	if p.err != nil {
+		p.writer.Close()
+		return p.err
+	}
+	if err := p.writer.Close(); err != nil {
+		return err
+	}
+	logrus.Infof("Wrote %s", p.OutputFile)
+	return nil
+}
+
+// ReadNode caches the node location and keeps the node if needed.
+func (p *PBFLocationsOnWaysWriter) ReadNode(n gosmparse.Node) {
+	if p.err != nil {
+		return
+	}
+	id, val := nodeToBytes(n)
+	p.Batch.Put([]byte(id), val)
+	if p.Batch.Len() > p.BatchSize {
+		p.fail(p.cacheFlush())
+	}
+	if len(n.Tags) > 0 || p.KeepUntaggedNodes || p.PBFMasks.RelNodes.Has(n.ID) {
+		p.fail(p.writer.WriteNode(n))
+	}
+}
+
+// ReadWay looks up its node locations.
+func (p *PBFLocationsOnWaysWriter) ReadWay(w gosmparse.Way) {
+	if p.err != nil {
+		return
+	}
+	// Pending node locations must be readable.
+	if p.Batch.Len() > 0 {
+		if p.fail(p.cacheFlush()) {
+			return
+		}
+	}
+	nodes := make([]gosmparse.Node, len(w.NodeIDs))
+	for i, nodeID := range w.NodeIDs {
+		data, err := p.DB.Get(nodeKey(nodeID), nil)
+		if err != nil {
+			p.fail(fmt.Errorf("way %d: node %d: %v", w.ID, nodeID, err))
+			return
+		}
+		nodes[i] = bytesToNodeElement(data).Node
+		nodes[i].ID = nodeID
+	}
+	p.fail(p.writer.WriteWayWithLocations(w, nodes))
+}
+
+// ReadWayWithLocations keeps locations the input already has.
+func (p *PBFLocationsOnWaysWriter) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if p.err != nil {
+		return
+	}
+	p.fail(p.writer.WriteWayWithLocations(w, nodes))
+}
+
+// ReadRelation .
+func (p *PBFLocationsOnWaysWriter) ReadRelation(r gosmparse.Relation) {
+	if p.err != nil {
+		return
+	}
+	p.fail(p.writer.WriteRelation(r))
+}
+
+func (p *PBFLocationsOnWaysWriter) cacheFlush() error {
+	if err := p.DB.Write(p.Batch, &opt.WriteOptions{NoWriteMerge: true}); err != nil {
+		return err
+	}
+	p.Batch.Reset()
+	return nil
+}
+
+// relationNodeIndexer marks every node that is a relation member.
+type relationNodeIndexer struct {
+	PBFMasks *bitmask.PBFMasks
+}
+
+func (r *relationNodeIndexer) ReadNode(n gosmparse.Node) {}
+
+func (r *relationNodeIndexer) ReadWay(w gosmparse.Way) {}
+
+func (r *relationNodeIndexer) ReadRelation(rel gosmparse.Relation) {
+	for _, member := range rel.Members {
+		if member.Type == gosmparse.NodeType {
+			r.PBFMasks.RelNodes.Insert(member.ID)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// locationsInput has way 10 on nodes 1, 2 and 3.
+const locationsInput = `<osm version="0.6">
+ <node id="1" lat="0" lon="0"/>
+ <node id="2" lat="0" lon="1"/>
+ <node id="3" lat="1" lon="1"/>
+ <way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><tag k="highway" v="primary"/></way>
+</osm>`
+
+// locationsCheck collects the way node locations.
+type locationsCheck map[int64][]gosmparse.Node
+
+func (l locationsCheck) ReadNode(n gosmparse.Node)       {}
+func (l locationsCheck) ReadWay(w gosmparse.Way)         {}
+func (l locationsCheck) ReadRelation(gosmparse.Relation) {}
+
+func (l locationsCheck) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	l[w.ID] = nodes
+}
+
+func TestPBFLocationsOnWaysWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-locations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Without node 3.
+	missing := strings.Replace(locationsInput, ` <node id="3" lat="1" lon="1"/>`+"\n", "", 1)
+	files := writeExtracts(t, dir, locationsInput, missing)
+	cache := filepath.Join(dir, "cache")
+
+	run := func(input, output string) error {
+		return NewPBFLocationsOnWaysWriter(
+			DefaultPBFParserParams{PBFFile: input, PBFMasks: bitmask.NewPBFMasks()},
+			PBFWriterParams{OutputFile: output},
+			PBFLocationsOnWaysParams{LevelDBPath: cache, BatchSize: 1},
+		).Run()
+	}
+
+	output := filepath.Join(dir, "locations.osm.pbf")
+	if err := run(files[0], output); err != nil {
+		t.Fatal(err)
+	}
+	locations := locationsCheck{}
+	if err := decodeSource(FileSource(output), locations); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := locations[10]; len(nodes) != 3 || nodes[2].ID != 3 || nodes[2].Lat != 1 || nodes[2].Lon != 1 {
+		t.Errorf("way 10 nodes %+v", nodes)
+	}
+	if cached, _ := filepath.Glob(filepath.Join(cache, "*")); len(cached) != 0 {
+		t.Errorf("cache left %v", cached)
+	}
+
+	// Node 3 of the previous run doesn't resolve.
+	err = run(files[1], filepath.Join(dir, "missing.osm.pbf"))
+	if err == nil || !strings.Contains(err.Error(), "way 10: node 3") {
+		t.Errorf("missing node error %v", err)
+	}
+}
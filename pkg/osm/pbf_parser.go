@@ -1,20 +1,15 @@
 package osm
 
 import (
-	"bytes"
-	"encoding/binary"
 	// "fmt"
 	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
 	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
 	"github.com/sirupsen/logrus"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/thomersch/gosmparse"
 	"go.uber.org/dig"
-	"io"
-	"math"
-	"os"
-	"strconv"
 	"sync"
 )
 
@@ -25,12 +20,14 @@ func NewPBFParser(
 ) PBFDataParser {
 	return &PBFParser{
 		PBFFile:                  defaultParams.PBFFile,
+		Source:                   defaultParams.source(),
 		PBFMasks:                 defaultParams.PBFMasks,
 		PBFIndexer:               params.PBFIndexer,
 		LevelDBPath:              params.LevelDBPath,
 		PBFRelationMemberIndexer: params.PBFRelationMemberIndexer,
 		BatchSize:                params.BatchSize,
 		OutputElementChan:        params.OutputElementChan,
+		UpdatableCache:           params.UpdatableCache,
 	}
 }
 
@@ -38,6 +35,7 @@ func NewPBFParser(
 type PBFParser struct {
 	dig.In
 	PBFFile  string
+	Source   Source
 	PBFMasks *bitmask.PBFMasks
 	// Indexer
 	PBFIndexer               PBFDataParser
@@ -47,6 +45,9 @@ type PBFParser struct {
 	LevelDBPath string
 	Batch       *leveldb.Batch
 	BatchSize   int
+	// UpdatableCache caches every element, their parents and the masks, so
+	// ChangeApplier can update the cache.
+	UpdatableCache bool
 
 	// Chan
 	ElementChan       chan element.Element
@@ -58,8 +59,25 @@ func (p *PBFParser) GetMap() *bitmask.PBFMasks {
 	return p.PBFMasks
 }
 
-// Run .
+// Run closes OutputElementChan on return, also on errors.
 func (p *PBFParser) Run() error {
+	defer close(p.OutputElementChan)
+	// Refuse files we would silently misread, ex history files.
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+	if header.HasOptionalFeature(pbf.FeatureLocationsOnWays) {
+		// Way nodes come with the ways, only relation member nodes are cached.
+		logrus.Info("Using locations on ways")
+	}
+	// The rounds read ways after their nodes and relations last.
+	source, removeSorted, err := sortedSource(p.Source, header, p.LevelDBPath)
+	if err != nil {
+		return err
+	}
+	defer removeSorted()
+
 	// Prepare
 	db, err := leveldb.OpenFile(
 		p.LevelDBPath,
@@ -81,12 +99,6 @@ func (p *PBFParser) Run() error {
 	}
 	logrus.Info("Finish index")
 
-	reader, err := os.Open(p.PBFFile)
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
 	// First round.
 	// Put way refs, relation member in to db.
 
@@ -104,8 +116,8 @@ func (p *PBFParser) Run() error {
 			switch element.Type {
 			case "Node":
 				// Write way refs and relation member nodes to db.
-				if p.PBFMasks.WayRefs.Has(element.Node.ID) || p.PBFMasks.RelNodes.Has(element.Node.ID) {
-					id, val := p.nodeToBytes(element.Node)
+				if p.UpdatableCache || p.PBFMasks.WayRefs.Has(element.Node.ID) || p.PBFMasks.RelNodes.Has(element.Node.ID) {
+					id, val := nodeToBytes(element.Node)
 					// CacheQueue
 					p.Batch.Put(
 						[]byte(id),
@@ -114,29 +126,37 @@ func (p *PBFParser) Run() error {
 					p.checkBatch()
 				}
 			case "Way":
+				if p.UpdatableCache {
+					p.cacheWayMembers(&element)
+				}
 				// Write relation member way to db.
-				if p.PBFMasks.RelWays.Has(element.Way.ID) {
+				if p.UpdatableCache || p.PBFMasks.RelWays.Has(element.Way.ID) {
 					elementByte, err := element.ToByte()
 					if err != nil {
 						logrus.Error(err)
 						continue
 					}
 					p.Batch.Put(
-						[]byte("W"+strconv.FormatInt(element.Way.ID, 10)),
+						wayKey(element.Way.ID),
 						elementByte,
 					)
 					p.checkBatch()
 				}
 			case "Relation":
+				if p.UpdatableCache {
+					for _, member := range element.Relation.Members {
+						p.Batch.Put(parentKey(member.Type, member.ID, gosmparse.RelationType, element.Relation.ID), nil)
+					}
+				}
 				// Write relation Member into db.
-				if p.PBFMasks.RelRelation.Has(element.Relation.ID) {
+				if p.UpdatableCache || p.PBFMasks.RelRelation.Has(element.Relation.ID) {
 					elementByte, err := element.ToByte()
 					if err != nil {
 						logrus.Error(err)
 						continue
 					}
 					p.Batch.Put(
-						[]byte("R"+strconv.FormatInt(element.Relation.ID, 10)),
+						relationKey(element.Relation.ID),
 						elementByte,
 					)
 					p.checkBatch()
@@ -144,15 +164,22 @@ func (p *PBFParser) Run() error {
 			}
 		}
 	}()
-	firstRoundDecoder := gosmparse.NewDecoder(reader)
-	if err := firstRoundDecoder.Parse(p); err != nil {
-		return err
-	}
+	// The round ends before returning, also on errors.
+	err = decodeSource(source, p)
 	close(p.ElementChan)
 	firstRoundWg.Wait()
+	if err != nil {
+		return err
+	}
+	if p.UpdatableCache {
+		masks, err := encodeMasks(p.PBFMasks)
+		if err != nil {
+			return err
+		}
+		p.Batch.Put(masksKey, masks)
+	}
 	p.cacheFlush(true)
 	logrus.Info("Finish first round.")
-	reader.Seek(io.SeekStart, 0) // rewind file.
 
 	// Final round.
 	// Real process for parse pbf file.
@@ -167,7 +194,6 @@ func (p *PBFParser) Run() error {
 
 	go func() {
 		defer wg.Done()
-		defer close(p.OutputElementChan)
 		for emt := range p.ElementChan {
 			switch emt.Type {
 			case "Node":
@@ -177,17 +203,20 @@ func (p *PBFParser) Run() error {
 				}
 			case "Way":
 				if p.PBFMasks.Ways.Has(emt.Way.ID) {
-					emts, err := p.cacheLookupWayElements(&emt.Way)
-					// skip ways which fail to denormalize.
-					if err != nil {
-						continue
+					// Ways from LocationsOnWays files are already located.
+					if len(emt.Elements) == 0 {
+						emts, err := p.cache().wayElements(&emt.Way)
+						// skip ways which fail to denormalize.
+						if err != nil {
+							continue
+						}
+						emt.Elements = emts
 					}
-					emt.Elements = emts
 					p.OutputElementChan <- emt
 				}
 			case "Relation":
 				if p.PBFMasks.Relations.Has(emt.Relation.ID) {
-					emts, err := p.cacheLookupRelationElements(&emt.Relation, []int64{})
+					emts, err := p.cache().relationElements(&emt.Relation, []int64{})
 					// skip ways which fail to denormalize.
 					if err != nil {
 						continue
@@ -199,13 +228,10 @@ func (p *PBFParser) Run() error {
 		}
 	}()
 
-	decoder := gosmparse.NewDecoder(reader)
-	if err := decoder.Parse(p); err != nil {
-		return err
-	}
+	err = decodeSource(source, p)
 	close(p.ElementChan)
 	wg.Wait()
-	return nil
+	return err
 }
 
 // ReadNode .
@@ -224,6 +250,19 @@ func (p *PBFParser) ReadWay(w gosmparse.Way) {
 	}
 }
 
+// ReadWayWithLocations .
+func (p *PBFParser) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	emts := make([]element.Element, len(nodes))
+	for i, n := range nodes {
+		emts[i] = element.Element{Type: "Node", Node: n}
+	}
+	p.ElementChan <- element.Element{
+		Type:     "Way",
+		Way:      w,
+		Elements: emts,
+	}
+}
+
 // ReadRelation .
 func (p *PBFParser) ReadRelation(r gosmparse.Relation) {
 	p.ElementChan <- element.Element{
@@ -232,6 +271,21 @@ func (p *PBFParser) ReadRelation(r gosmparse.Relation) {
 	}
 }
 
+// cacheWayMembers puts the way parent of its nodes, and the node locations
+// of located ways, which are cached without them.
+func (p *PBFParser) cacheWayMembers(emt *element.Element) {
+	for i, nodeID := range emt.Way.NodeIDs {
+		p.Batch.Put(parentKey(gosmparse.NodeType, nodeID, gosmparse.WayType, emt.Way.ID), nil)
+		if len(emt.Elements) == len(emt.Way.NodeIDs) {
+			node := emt.Elements[i].Node
+			node.ID = nodeID
+			id, val := nodeToBytes(node)
+			p.Batch.Put([]byte(id), val)
+		}
+	}
+	emt.Elements = nil
+}
+
 // checkBatch check if need flush batch.
 func (p *PBFParser) checkBatch() {
 	if p.Batch.Len() > p.BatchSize {
@@ -255,139 +309,6 @@ func (p *PBFParser) cacheFlush(sync bool) error {
 	return nil
 }
 
-// nodeToBytes transfrom node to bytes.
-func (p *PBFParser) nodeToBytes(n gosmparse.Node) (string, []byte) {
-	var buf bytes.Buffer
-
-	// Encoding lat as 64 bit float64 packed into 8 bytes.
-	var latBytes = make([]byte, 8)
-	binary.BigEndian.PutUint64(latBytes, math.Float64bits(n.Lat))
-	buf.Write(latBytes)
-
-	// Encoding lng as 64 bit float64 packed into 8 bytes.
-	var lonBytes = make([]byte, 8)
-	binary.BigEndian.PutUint64(lonBytes, math.Float64bits(n.Lon))
-	buf.Write(lonBytes)
-
-	return strconv.FormatInt(n.ID, 10), buf.Bytes()
-}
-
-// bytesToNodeElement transfrom node from bytes to element.
-func (p *PBFParser) bytesToNodeElement(data []byte) element.Element {
-
-	node := gosmparse.Node{}
-	// bytes to LatLon .
-	var latBytes = append([]byte{}, data[0:8]...)
-	var lat = math.Float64frombits(binary.BigEndian.Uint64(latBytes))
-	node.Lat = lat
-
-	var lonBytes = append([]byte{}, data[8:16]...)
-	var lon = math.Float64frombits(binary.BigEndian.Uint64(lonBytes))
-	node.Lon = lon
-	return element.Element{
-		Type: "Node",
-		Node: node,
-	}
-}
-
-// cacheLookupWayElements get refs node from db.
-func (p *PBFParser) cacheLookupWayElements(way *gosmparse.Way) ([]element.Element, error) {
-	var emts []element.Element
-	for _, nodeID := range way.NodeIDs {
-		strID := strconv.FormatInt(nodeID, 10)
-		data, err := p.DB.Get(
-			[]byte(strID),
-			nil,
-		)
-		if err != nil {
-			return []element.Element{}, err
-		}
-		e := p.bytesToNodeElement(data)
-		emts = append(emts, e)
-	}
-	return emts, nil
-}
-
-func (p *PBFParser) cacheLookupRelationElements(relation *gosmparse.Relation, blacklist []int64) ([]element.Element, error) {
-	var emts []element.Element
-
-	// blacklist to avoid recursive relation member.
-	blacklist = append(blacklist, relation.ID)
-	for _, member := range relation.Members {
-		strID := strconv.FormatInt(member.ID, 10)
-		switch member.Type {
-		case 0: // Node
-			nodeBytes, err := p.DB.Get(
-				[]byte(strID),
-				nil,
-			)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			emt := p.bytesToNodeElement(nodeBytes)
-			emts = append(emts, emt)
-		case 1: // Way
-			// Get element from db.
-			elementByte, err := p.DB.Get(
-				[]byte("W"+strID),
-				nil,
-			)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			emt, err := element.ByteToElement(elementByte)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			// Get ref nodes from db.
-			nodeElements, err := p.cacheLookupWayElements(&emt.Way)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			emt.Elements = nodeElements
-			emt.Role = member.Role
-			emts = append(emts, emt)
-		case 2: // Relation
-			// Skip if relation recursive. A -> B -> A
-			var recursive bool
-			for _, blackID := range blacklist {
-				if member.ID == blackID {
-					recursive = true
-				}
-			}
-			if recursive {
-				continue
-			}
-
-			// Get element from db.
-			elementByte, err := p.DB.Get(
-				[]byte("R"+strID),
-				nil,
-			)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			emt, err := element.ByteToElement(elementByte)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-
-			// Get relation member emts.
-			newElements, err := p.cacheLookupRelationElements(&emt.Relation, blacklist)
-			if err != nil {
-				logrus.Error(err)
-				return []element.Element{}, err
-			}
-			emt.Elements = newElements
-			emt.Role = member.Role
-			emts = append(emts, emt)
-		}
-	}
-	return emts, nil
+func (p *PBFParser) cache() elementCache {
+	return elementCache{db: p.DB}
 }
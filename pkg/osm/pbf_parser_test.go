@@ -6,8 +6,13 @@ import (
 	"github.com/onrik/logrus/filename"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/dig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -78,3 +83,129 @@ func TestPBFParser(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// parseElements runs a PBFParser with params, the relation member
+// indexer and batch size defaulted, and returns the elements it sends.
+func parseElements(t *testing.T, defaultParams DefaultPBFParserParams, params PBFParserParams) []element.Element {
+	if params.PBFRelationMemberIndexer == nil {
+		params.PBFRelationMemberIndexer = NewPBFRelationMemberIndexer(defaultParams)
+	}
+	if params.BatchSize == 0 {
+		params.BatchSize = 5000
+	}
+	params.OutputElementChan = make(chan element.Element)
+	parser := NewPBFParser(defaultParams, params)
+	var emts []element.Element
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for emt := range params.OutputElementChan {
+			emts = append(emts, emt)
+		}
+	}()
+	err := parser.Run()
+	<-collected
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emts
+}
+
+// Unsaved JOSM edits, node -1 and node 1 are different nodes.
+const unsavedEdits = `<osm version="0.6" upload="false">
+ <node id="-3" lat="0" lon="0"><tag k="amenity" v="bench"/></node>
+ <node id="-2" lat="0" lon="1"/>
+ <node id="-1" lat="1" lon="1"/>
+ <node id="1" lat="5" lon="5"/>
+ <way id="-7"><nd ref="-3"/><nd ref="-2"/><nd ref="-1"/><nd ref="-3"/></way>
+ <way id="-6"><nd ref="-2"/><nd ref="1"/><tag k="highway" v="footway"/></way>
+ <relation id="-9"><member type="way" ref="-7" role="outer"/><tag k="type" v="multipolygon"/><tag k="leisure" v="park"/></relation>
+</osm>`
+
+func TestPBFParserNegativeIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-negative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, unsavedEdits)
+
+	defaultParams := DefaultPBFParserParams{PBFFile: files[0], PBFMasks: bitmask.NewPBFMasks()}
+	features := map[string]element.Element{}
+	for _, emt := range parseElements(t, defaultParams, PBFParserParams{
+		LevelDBPath:    filepath.Join(dir, "cache"),
+		PBFIndexer:     NewPBFIndexer(defaultParams),
+		UpdatableCache: true,
+	}) {
+		features[element.OSMID(strings.ToLower(emt.Type), emt.GetID())] = emt
+	}
+	for _, osmID := range []string{"node/-3", "way/-6", "relation/-9"} {
+		if _, ok := features[osmID]; !ok {
+			t.Errorf("missing %s in %v", osmID, features)
+		}
+	}
+	if len(features) != 3 {
+		t.Errorf("got %d features, want 3", len(features))
+	}
+	if way := features["way/-6"]; len(way.Elements) != 2 || way.Elements[0].Node.Lon != 1 || way.Elements[1].Node.Lat != 5 {
+		t.Errorf("way -6 nodes %+v", way.Elements)
+	}
+	if rel := features["relation/-9"]; len(rel.Elements) != 1 || len(rel.Elements[0].Elements) != 4 {
+		t.Errorf("relation -9 members %+v", rel.Elements)
+	}
+
+	// Moving node -2 modifies both ways through the updatable cache.
+	oscFile := filepath.Join(dir, "change.osc")
+	if err := ioutil.WriteFile(oscFile, []byte(`<osmChange version="0.6">
+ <modify><node id="-2" lat="0.5" lon="1"/></modify>
+</osmChange>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changeChan := make(chan element.Element)
+	applier := NewChangeApplier(ChangeApplierParams{
+		ChangeFile:        oscFile,
+		LevelDBPath:       filepath.Join(dir, "cache"),
+		OutputElementChan: changeChan,
+	})
+	done := make(chan error, 1)
+	go func() { done <- applier.Run() }()
+	var changed []string
+	for emt := range changeChan {
+		changed = append(changed, element.OSMID(strings.ToLower(emt.Type), emt.GetID()))
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changed, " ") != "way/-6 relation/-9" {
+		t.Errorf("changed %v, want way/-6 relation/-9", changed)
+	}
+}
+
+func TestPBFParserClosesOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-closes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaultParams := DefaultPBFParserParams{PBFFile: filepath.Join(dir, "missing.osm.pbf"), PBFMasks: bitmask.NewPBFMasks()}
+	outputChan := make(chan element.Element)
+	parser := NewPBFParser(defaultParams, PBFParserParams{
+		LevelDBPath:              filepath.Join(dir, "cache"),
+		PBFIndexer:               NewPBFIndexer(defaultParams),
+		PBFRelationMemberIndexer: NewPBFRelationMemberIndexer(defaultParams),
+		BatchSize:                5000,
+		OutputElementChan:        outputChan,
+	})
+	if err := parser.Run(); err == nil {
+		t.Fatal("missing file parsed")
+	}
+	select {
+	case _, ok := <-outputChan:
+		if ok {
+			t.Error("element sent")
+		}
+	case <-time.After(time.Second):
+		t.Error("output channel left open")
+	}
+}
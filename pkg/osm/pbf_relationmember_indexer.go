@@ -3,7 +3,6 @@ package osm
 import (
 	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
 	"github.com/thomersch/gosmparse"
-	"os"
 	"sync"
 )
 
@@ -11,6 +10,7 @@ import (
 func NewPBFRelationMemberIndexer(params DefaultPBFParserParams) PBFDataParser {
 	return &PBFRelationMemberIndexer{
 		PBFFile:  params.PBFFile,
+		Source:   params.source(),
 		PBFMasks: params.PBFMasks,
 	}
 }
@@ -18,19 +18,19 @@ func NewPBFRelationMemberIndexer(params DefaultPBFParserParams) PBFDataParser {
 // PBFRelationMemberIndexer .
 type PBFRelationMemberIndexer struct {
 	PBFFile  string
+	Source   Source
 	PBFMasks *bitmask.PBFMasks
 	MapLock  sync.RWMutex
 }
 
 // Run .
 func (p *PBFRelationMemberIndexer) Run() error {
-	reader, err := os.Open(p.PBFFile)
+	decoder, reader, err := openDecoder(p.Source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	decoder := gosmparse.NewDecoder(reader)
 	if err := decoder.Parse(p); err != nil {
 		return err
 	}
@@ -49,5 +49,8 @@ func (p *PBFRelationMemberIndexer) ReadWay(w gosmparse.Way) {
 	}
 }
 
+// ReadWayWithLocations skips located ways, they are cached with their nodes.
+func (p *PBFRelationMemberIndexer) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {}
+
 // ReadRelation .
 func (p *PBFRelationMemberIndexer) ReadRelation(r gosmparse.Relation) {}
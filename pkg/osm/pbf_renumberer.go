@@ -0,0 +1,247 @@
+package osm
+
+import (
+	"bufio"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// NewPBFRenumberer .
+func NewPBFRenumberer(defaultParams DefaultPBFParserParams, writerParams PBFWriterParams, params PBFRenumbererParams) PBFDataParser {
+	return &PBFRenumberer{
+		Source:      defaultParams.source(),
+		OutputFile:  writerParams.OutputFile,
+		Compression: writerParams.Compression,
+		BlockSize:   writerParams.BlockSize,
+		MappingFile: params.MappingFile,
+		LevelDBPath: params.LevelDBPath,
+		BatchSize:   params.BatchSize,
+	}
+}
+
+// PBFRenumberer copies the input to OutputFile with the ids of each type
+// renumbered from 1 in the order elements come, references included, so
+// bitmasks and cache keys stay dense.
+// MappingFile gets a "type,old_id,new_id" csv line per id. Referenced ids
+// missing from the input are numbered after the others.
+// The mapping is cached in a temp leveldb under LevelDBPath. Ids must be
+// unique per type.
+type PBFRenumberer struct {
+	Source      Source
+	OutputFile  string
+	Compression string
+	BlockSize   int
+	MappingFile string
+	LevelDBPath string
+	BatchSize   int
+
+	DB      *leveldb.DB
+	Batch   *leveldb.Batch
+	writer  ElementWriter
+	mapping *bufio.Writer
+	nextID  [3]int64
+	missing int
+	firstError
+}
+
+// renumberKey is the key of an old id, ex "n-12".
+func renumberKey(t gosmparse.MemberType, id int64) []byte {
+	return []byte(memberTypeKeys[t] + strconv.FormatInt(id, 10))
+}
+
+// Run .
+func (p *PBFRenumberer) Run() error {
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.LevelDBPath, 0755); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(p.LevelDBPath, "renumber")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	db, err := leveldb.OpenFile(dir, &opt.Options{DisableBlockCache: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	p.DB = db
+	p.Batch = new(leveldb.Batch)
+	p.nextID = [3]int64{}
+	p.missing = 0
+	p.err = nil
+
+	f, err := os.Create(p.MappingFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p.mapping = bufio.NewWriter(f)
+	p.mapping.WriteString("type,old_id,new_id\n")
+
+	// Number the elements, then rewrite them and their references.
+	if err := decodeSource(p.Source, &renumberAssigner{p}); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+	logrus.Info("Finish numbering.")
+
+	outHeader := *header
+	outHeader.WritingProgram = ""
+	if p.writer, err = CreateElementWriter(p.OutputFile, outHeader, p.Compression, p.BlockSize); err != nil {
+		return err
+	}
+	// Keep metadata.
+	dec, reader, err := openInfoDecoder(p.Source)
+	if err != nil {
+		p.writer.Close()
+		return err
+	}
+	err = dec.Parse(p)
+	reader.Close()
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		p.writer.Close()
+		return err
+	}
+	if err := p.writer.Close(); err != nil {
+		return err
+	}
+	if p.missing > 0 {
+		logrus.Warningf("%d referenced ids missing from %s", p.missing, p.Source.Name())
+	}
+	if err := p.mapping.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// assign numbers an old id and writes its mapping line.
+func (p *PBFRenumberer) assign(t gosmparse.MemberType, id int64) int64 {
+	p.nextID[t]++
+	newID := p.nextID[t]
+	p.mapping.WriteString(memberTypeNames[t] + "," + strconv.FormatInt(id, 10) + "," + strconv.FormatInt(newID, 10) + "\n")
+	return newID
+}
+
+// lookup returns the new id of an old one, numbering missing ones.
+func (p *PBFRenumberer) lookup(t gosmparse.MemberType, id int64) int64 {
+	key := renumberKey(t, id)
+	val, err := p.DB.Get(key, nil)
+	if err == nil {
+		newID, err := strconv.ParseInt(string(val), 10, 64)
+		p.fail(err)
+		return newID
+	}
+	if err != leveldb.ErrNotFound {
+		p.fail(err)
+		return 0
+	}
+	p.missing++
+	newID := p.assign(t, id)
+	p.fail(p.DB.Put(key, []byte(strconv.FormatInt(newID, 10)), nil))
+	return newID
+}
+
+// ReadNode .
+func (p *PBFRenumberer) ReadNode(n gosmparse.Node) {
+	if p.err != nil {
+		return
+	}
+	n.ID = p.lookup(gosmparse.NodeType, n.ID)
+	p.fail(p.writer.WriteNode(n))
+}
+
+// ReadWay .
+func (p *PBFRenumberer) ReadWay(w gosmparse.Way) {
+	p.ReadWayWithLocations(w, nil)
+}
+
+// ReadWayWithLocations .
+func (p *PBFRenumberer) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if p.err != nil {
+		return
+	}
+	w.ID = p.lookup(gosmparse.WayType, w.ID)
+	nodeIDs := make([]int64, len(w.NodeIDs))
+	for i, id := range w.NodeIDs {
+		nodeIDs[i] = p.lookup(gosmparse.NodeType, id)
+	}
+	w.NodeIDs = nodeIDs
+	if nodes == nil {
+		p.fail(p.writer.WriteWay(w))
+		return
+	}
+	located := make([]gosmparse.Node, len(nodes))
+	for i, n := range nodes {
+		n.ID = nodeIDs[i]
+		located[i] = n
+	}
+	p.fail(p.writer.WriteWayWithLocations(w, located))
+}
+
+// ReadRelation .
+func (p *PBFRenumberer) ReadRelation(r gosmparse.Relation) {
+	if p.err != nil {
+		return
+	}
+	r.ID = p.lookup(gosmparse.RelationType, r.ID)
+	members := make([]gosmparse.RelationMember, len(r.Members))
+	for i, m := range r.Members {
+		m.ID = p.lookup(m.Type, m.ID)
+		members[i] = m
+	}
+	r.Members = members
+	p.fail(p.writer.WriteRelation(r))
+}
+
+func (p *PBFRenumberer) flush() error {
+	if err := p.DB.Write(p.Batch, &opt.WriteOptions{NoWriteMerge: true}); err != nil {
+		return err
+	}
+	p.Batch.Reset()
+	return nil
+}
+
+// renumberAssigner numbers the elements of the first pass.
+type renumberAssigner struct {
+	p *PBFRenumberer
+}
+
+func (a *renumberAssigner) put(t gosmparse.MemberType, id int64) {
+	p := a.p
+	if p.err != nil {
+		return
+	}
+	p.Batch.Put(renumberKey(t, id), []byte(strconv.FormatInt(p.assign(t, id), 10)))
+	if p.Batch.Len() >= p.BatchSize {
+		p.fail(p.flush())
+	}
+}
+
+func (a *renumberAssigner) ReadNode(n gosmparse.Node) {
+	a.put(gosmparse.NodeType, n.ID)
+}
+
+func (a *renumberAssigner) ReadWay(w gosmparse.Way) {
+	a.put(gosmparse.WayType, w.ID)
+}
+
+func (a *renumberAssigner) ReadRelation(r gosmparse.Relation) {
+	a.put(gosmparse.RelationType, r.ID)
+}
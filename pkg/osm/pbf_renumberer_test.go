@@ -0,0 +1,90 @@
+package osm
+
+import (
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// JOSM style ids, way -5 references node 99 which isn't there.
+const scatteredExtract = `<osm version="0.6">
+ <node id="-1" lat="0" lon="0"/>
+ <node id="9000000000" lat="0" lon="1"><tag k="name" v="far"/></node>
+ <node id="7" lat="1" lon="1"/>
+ <way id="-5"><nd ref="-1"/><nd ref="9000000000"/><nd ref="99"/><tag k="highway" v="path"/></way>
+ <relation id="123456"><member type="way" ref="-5" role=""/><member type="node" ref="7" role="label"/><tag k="type" v="route"/></relation>
+</osm>`
+
+type elementCollector struct {
+	nodes     []gosmparse.Node
+	ways      []gosmparse.Way
+	relations []gosmparse.Relation
+}
+
+func (c *elementCollector) ReadNode(n gosmparse.Node)         { c.nodes = append(c.nodes, n) }
+func (c *elementCollector) ReadWay(w gosmparse.Way)           { c.ways = append(c.ways, w) }
+func (c *elementCollector) ReadRelation(r gosmparse.Relation) { c.relations = append(c.relations, r) }
+
+func TestPBFRenumberer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-renumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, scatteredExtract)
+	outputFile := filepath.Join(dir, "renumbered.osm.pbf")
+	mappingFile := filepath.Join(dir, "mapping.csv")
+
+	renumberer := NewPBFRenumberer(
+		DefaultPBFParserParams{PBFFile: files[0]},
+		PBFWriterParams{OutputFile: outputFile},
+		PBFRenumbererParams{MappingFile: mappingFile, LevelDBPath: filepath.Join(dir, "cache"), BatchSize: 2},
+	)
+	if err := renumberer.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &elementCollector{}
+	if err := decodeSource(FileSource(outputFile), c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.nodes) != 3 || len(c.ways) != 1 || len(c.relations) != 1 {
+		t.Fatalf("got %d nodes, %d ways, %d relations", len(c.nodes), len(c.ways), len(c.relations))
+	}
+	for i, n := range c.nodes {
+		if n.ID != int64(i+1) {
+			t.Errorf("node %d has id %d", i, n.ID)
+		}
+	}
+	if c.nodes[1].Tags["name"] != "far" {
+		t.Errorf("node 2 tags %v", c.nodes[1].Tags)
+	}
+	// The missing node comes after the others.
+	if ids := c.ways[0].NodeIDs; c.ways[0].ID != 1 || len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 4 {
+		t.Errorf("way %d nodes %v, want 1 with 1 2 4", c.ways[0].ID, ids)
+	}
+	rel := c.relations[0]
+	if rel.ID != 1 || rel.Members[0].ID != 1 || rel.Members[1].ID != 3 || rel.Members[1].Role != "label" {
+		t.Errorf("relation %+v", rel)
+	}
+
+	mapping, err := ioutil.ReadFile(mappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"type,old_id,new_id",
+		"node,-1,1",
+		"node,9000000000,2",
+		"node,7,3",
+		"way,-5,1",
+		"relation,123456,1",
+		"node,99,4",
+	}
+	if got := strings.Split(strings.TrimSpace(string(mapping)), "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("mapping %q, want %q", got, want)
+	}
+}
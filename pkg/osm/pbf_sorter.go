@@ -0,0 +1,279 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/sirupsen/logrus"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// DefaultSortChunkSize is the elements PBFSorter sorts in memory at once.
+const DefaultSortChunkSize = 1000000
+
+// NewPBFSorter .
+func NewPBFSorter(defaultParams DefaultPBFParserParams, writerParams PBFWriterParams, params PBFSorterParams) PBFDataParser {
+	chunkSize := params.SortChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultSortChunkSize
+	}
+	return &PBFSorter{
+		Source:      defaultParams.source(),
+		OutputFile:  writerParams.OutputFile,
+		Compression: writerParams.Compression,
+		BlockSize:   writerParams.BlockSize,
+		TempDir:     params.LevelDBPath,
+		ChunkSize:   chunkSize,
+	}
+}
+
+// PBFSorter writes the input to OutputFile in Sort.Type_then_ID order with
+// bounded memory: runs of ChunkSize elements are sorted in memory and
+// spooled to temp pbf files under TempDir, then merged.
+// An id found several times is kept once, its highest version.
+type PBFSorter struct {
+	Source      Source
+	OutputFile  string
+	Compression string
+	BlockSize   int
+	TempDir     string
+	ChunkSize   int
+
+	header pbf.Header
+	dir    string
+	items  []mergeItem
+	runs   []Source
+	err    error
+}
+
+// Run .
+func (p *PBFSorter) Run() error {
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.TempDir, 0755); err != nil {
+		return err
+	}
+	if p.dir, err = ioutil.TempDir(p.TempDir, "sort"); err != nil {
+		return err
+	}
+	defer os.RemoveAll(p.dir)
+	p.header = *header
+	p.items, p.runs, p.err = nil, nil, nil
+
+	// Versions need metadata.
+	dec, reader, err := openInfoDecoder(p.Source)
+	if err != nil {
+		return err
+	}
+	err = dec.Parse(p)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+
+	outHeader := *header
+	outHeader.WritingProgram = ""
+	if !outHeader.HasOptionalFeature(pbf.FeatureSortTypeThenID) {
+		outHeader.OptionalFeatures = append(
+			append([]string{}, header.OptionalFeatures...), pbf.FeatureSortTypeThenID,
+		)
+	}
+	writer, err := CreateElementWriter(p.OutputFile, outHeader, p.Compression, p.BlockSize)
+	if err != nil {
+		return err
+	}
+	if len(p.runs) == 0 {
+		// Everything fit in memory.
+		err = writeItems(writer, p.sortedItems())
+	} else if err = p.spill(); err == nil {
+		logrus.Infof("Merging %d sorted runs", len(p.runs))
+		out := &elementWriterReader{writer: writer}
+		if err = decodeSource(NewMultiSource(p.runs...), out); err == nil {
+			err = out.err
+		}
+	}
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// ReadNode .
+func (p *PBFSorter) ReadNode(n gosmparse.Node) {
+	p.add(mergeItem{key: changeKey{Type: gosmparse.NodeType, ID: n.ID}, version: itemVersion(n.Info), node: n})
+}
+
+// ReadWay .
+func (p *PBFSorter) ReadWay(w gosmparse.Way) {
+	p.add(mergeItem{key: changeKey{Type: gosmparse.WayType, ID: w.ID}, version: itemVersion(w.Info), way: w})
+}
+
+// ReadWayWithLocations .
+func (p *PBFSorter) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	p.add(mergeItem{key: changeKey{Type: gosmparse.WayType, ID: w.ID}, version: itemVersion(w.Info), way: w, nodes: nodes})
+}
+
+// ReadRelation .
+func (p *PBFSorter) ReadRelation(r gosmparse.Relation) {
+	p.add(mergeItem{key: changeKey{Type: gosmparse.RelationType, ID: r.ID}, version: itemVersion(r.Info), relation: r})
+}
+
+func (p *PBFSorter) add(item mergeItem) {
+	if p.err != nil {
+		return
+	}
+	p.items = append(p.items, item)
+	if len(p.items) >= p.ChunkSize {
+		p.err = p.spill()
+	}
+}
+
+// spill writes the buffered elements as a sorted run.
+func (p *PBFSorter) spill() error {
+	file := filepath.Join(p.dir, "run"+strconv.Itoa(len(p.runs))+".osm.pbf")
+	// Runs are read once, skip compression.
+	writer, err := CreateElementWriter(file, p.header, "none", 0)
+	if err != nil {
+		return err
+	}
+	if err := writeItems(writer, p.sortedItems()); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	logrus.Debugf("Sorted run %d", len(p.runs))
+	p.runs = append(p.runs, FileSource(file))
+	p.items = p.items[:0]
+	return nil
+}
+
+// sortedItems sorts the buffered elements, keeping the highest version of
+// an id.
+func (p *PBFSorter) sortedItems() []mergeItem {
+	items := p.items
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].key == items[j].key {
+			return items[i].version > items[j].version
+		}
+		return keyLess(items[i].key, items[j].key)
+	})
+	kept := items[:0]
+	for i, item := range items {
+		if i > 0 && item.key == items[i-1].key {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+func writeItems(w ElementWriter, items []mergeItem) error {
+	for _, item := range items {
+		var err error
+		switch item.key.Type {
+		case gosmparse.NodeType:
+			err = w.WriteNode(item.node)
+		case gosmparse.WayType:
+			if item.nodes != nil {
+				err = w.WriteWayWithLocations(item.way, item.nodes)
+			} else {
+				err = w.WriteWay(item.way)
+			}
+		case gosmparse.RelationType:
+			err = w.WriteRelation(item.relation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openInfoDecoder is openDecoder keeping element metadata.
+func openInfoDecoder(source Source) (decoder, io.Closer, error) {
+	if s, ok := source.(decoderSource); ok {
+		return s.openDecoder()
+	}
+	reader, err := source.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return newDecoder(reader, true), reader, nil
+}
+
+// decodeInfoSource is decodeSource keeping element metadata.
+func decodeInfoSource(source Source, o gosmparse.OSMReader) error {
+	decoder, reader, err := openInfoDecoder(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return decoder.Parse(o)
+}
+
+// sortedSource returns source, or a sorted copy under tempDir if it isn't
+// in Sort.Type_then_ID order. Call remove once done.
+func sortedSource(source Source, header *pbf.Header, tempDir string) (sorted Source, remove func(), err error) {
+	remove = func() {}
+	if header.HasOptionalFeature(pbf.FeatureSortTypeThenID) {
+		return source, remove, nil
+	}
+	check := &sortCheckReader{}
+	if err := decodeSource(source, check); err != nil {
+		return nil, nil, err
+	}
+	if check.sorted() {
+		return source, remove, nil
+	}
+
+	logrus.Warningf("%s is not sorted by type then id, sorting it first", source.Name())
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, nil, err
+	}
+	dir, err := ioutil.TempDir(tempDir, "sorted")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove = func() { os.RemoveAll(dir) }
+	sorter := &PBFSorter{
+		Source:      source,
+		OutputFile:  filepath.Join(dir, "sorted.osm.pbf"),
+		Compression: "none",
+		TempDir:     dir,
+		ChunkSize:   DefaultSortChunkSize,
+	}
+	if err := sorter.Run(); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return FileSource(sorter.OutputFile), remove, nil
+}
+
+// sortCheckReader runs a sortCheck over a pass.
+type sortCheckReader struct {
+	sortCheck
+}
+
+func (r *sortCheckReader) ReadNode(n gosmparse.Node) {
+	r.observe(gosmparse.NodeType, n.ID)
+}
+
+func (r *sortCheckReader) ReadWay(w gosmparse.Way) {
+	r.observe(gosmparse.WayType, w.ID)
+}
+
+func (r *sortCheckReader) ReadRelation(rel gosmparse.Relation) {
+	r.observe(gosmparse.RelationType, rel.ID)
+}
@@ -0,0 +1,81 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/bitmask"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Relations and ways before their nodes, node 2 twice.
+const unsortedExtract = `<osm version="0.6">
+ <relation id="20" version="1"><member type="way" ref="10" role="outer"/><tag k="type" v="multipolygon"/><tag k="landuse" v="forest"/></relation>
+ <way id="10" version="1"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="1"/></way>
+ <node id="3" version="1" lat="1" lon="0"/>
+ <node id="2" version="1" lat="0" lon="1"/>
+ <way id="11" version="1"><nd ref="2"/><nd ref="3"/><tag k="highway" v="service"/></way>
+ <node id="1" version="1" lat="0" lon="0"/>
+ <node id="2" version="2" lat="0.5" lon="1"/>
+</osm>`
+
+func TestPBFSorter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, unsortedExtract)
+	outputFile := filepath.Join(dir, "sorted.osm.pbf")
+
+	for _, chunkSize := range []int{2, 0} {
+		sorter := NewPBFSorter(
+			DefaultPBFParserParams{PBFFile: files[0]},
+			PBFWriterParams{OutputFile: outputFile},
+			PBFSorterParams{LevelDBPath: filepath.Join(dir, "cache"), SortChunkSize: chunkSize},
+		)
+		if err := sorter.Run(); err != nil {
+			t.Fatal(err)
+		}
+		info := NewPBFFileInfo(DefaultPBFParserParams{PBFFile: outputFile})
+		if err := info.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if !info.Info.Sorted || !info.Info.Header.HasOptionalFeature(pbf.FeatureSortTypeThenID) {
+			t.Errorf("chunk size %d: output not sorted, %+v", chunkSize, info.Info)
+		}
+		if info.Info.Nodes != 3 || info.Info.Ways != 2 || info.Info.Relations != 1 {
+			t.Errorf("chunk size %d: got %+v, want 3 nodes, 2 ways and 1 relation", chunkSize, info.Info)
+		}
+	}
+	if runs, _ := filepath.Glob(filepath.Join(dir, "cache", "*")); len(runs) != 0 {
+		t.Errorf("temp runs left: %v", runs)
+	}
+}
+
+func TestPBFParserSortsInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := writeExtracts(t, dir, unsortedExtract)
+
+	defaultParams := DefaultPBFParserParams{PBFFile: files[0], PBFMasks: bitmask.NewPBFMasks()}
+	features := map[string]element.Element{}
+	for _, emt := range parseElements(t, defaultParams, PBFParserParams{
+		LevelDBPath: filepath.Join(dir, "cache"),
+		PBFIndexer:  NewPBFIndexer(defaultParams),
+	}) {
+		features[emt.Type+itoa(emt.GetID())] = emt
+	}
+	way, ok := features["Way11"]
+	if !ok || len(way.Elements) != 2 || way.Elements[0].Node.Lat != 0.5 {
+		t.Errorf("way 11 %+v, want nodes 2 version 2 and 3", way)
+	}
+	if rel, ok := features["Relation20"]; !ok || len(rel.Elements) != 1 {
+		t.Errorf("relation 20 %+v, want its outer way", rel)
+	}
+}
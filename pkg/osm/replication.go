@@ -0,0 +1,268 @@
+package osm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplicationState is a replication state.txt.
+type ReplicationState struct {
+	SequenceNumber int64
+	Timestamp      time.Time
+}
+
+// ReadReplicationState parses a state.txt, a java properties file:
+//
+//	#Sat Jan 01 00:00:02 UTC 2022
+//	sequenceNumber=4856432
+//	timestamp=2022-01-01T00\:00\:00Z
+func ReadReplicationState(r io.Reader) (ReplicationState, error) {
+	var state ReplicationState
+	seen := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Replace(strings.TrimSpace(kv[1]), `\:`, ":", -1)
+		var err error
+		switch strings.TrimSpace(kv[0]) {
+		case "sequenceNumber":
+			state.SequenceNumber, err = strconv.ParseInt(value, 10, 64)
+			seen = true
+		case "timestamp":
+			state.Timestamp, err = time.Parse(time.RFC3339, value)
+		}
+		if err != nil {
+			return state, fmt.Errorf("replication state: %v", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return state, err
+	}
+	if !seen {
+		return state, fmt.Errorf("replication state: missing sequenceNumber")
+	}
+	return state, nil
+}
+
+// WriteTo writes the state.txt form of s.
+func (s ReplicationState) WriteTo(w io.Writer) (int64, error) {
+	text := "sequenceNumber=" + strconv.FormatInt(s.SequenceNumber, 10) + "\n"
+	if !s.Timestamp.IsZero() {
+		text += "timestamp=" + strings.Replace(s.Timestamp.UTC().Format(time.RFC3339), ":", `\:`, -1) + "\n"
+	}
+	n, err := io.WriteString(w, text)
+	return int64(n), err
+}
+
+// ReplicationPath is the path of a sequence in a replication directory
+// without extension, ex 4856432 is "004/856/432".
+func ReplicationPath(sequence int64) string {
+	return fmt.Sprintf("%03d/%03d/%03d", sequence/1000000, sequence/1000%1000, sequence%1000)
+}
+
+// ReplicationSource is a replication directory, a local path or an http
+// url, ex https://planet.openstreetmap.org/replication/minute.
+type ReplicationSource string
+
+// File returns the file at the slash separated name.
+func (r ReplicationSource) File(name string) Source {
+	base := string(r)
+	if strings.HasPrefix(base, "http://") || strings.HasPrefix(base, "https://") {
+		return httpSource(strings.TrimSuffix(base, "/") + "/" + name)
+	}
+	return FileSource(filepath.Join(base, filepath.FromSlash(name)))
+}
+
+// State reads state.txt, or the state of a sequence if not 0.
+func (r ReplicationSource) State(sequence int64) (ReplicationState, error) {
+	name := "state.txt"
+	if sequence != 0 {
+		name = ReplicationPath(sequence) + ".state.txt"
+	}
+	reader, err := r.File(name).Open()
+	if err != nil {
+		return ReplicationState{}, err
+	}
+	defer reader.Close()
+	return ReadReplicationState(reader)
+}
+
+// replicationClient gives up on stalled servers, including while reading
+// the body, large enough for daily diffs.
+var replicationClient = &http.Client{Timeout: 10 * time.Minute}
+
+// httpSource downloads an url, missing files are os.IsNotExist errors.
+type httpSource string
+
+func (s httpSource) Open() (io.ReadCloser, error) {
+	resp, err := replicationClient.Get(string(s))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, &os.PathError{Op: "get", Path: string(s), Err: os.ErrNotExist}
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s: %s", s, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (s httpSource) Name() string {
+	return string(s)
+}
+
+// ReplicationSink receives the changed features of a sequence, it must
+// drain emts.
+type ReplicationSink func(sequence int64, emts <-chan element.Element) error
+
+// NewReplicator .
+func NewReplicator(params ReplicatorParams) *Replicator {
+	return &Replicator{
+		Source:      ReplicationSource(params.ReplicationURL),
+		StateFile:   params.StateFile,
+		LevelDBPath: params.LevelDBPath,
+		Interval:    params.Interval,
+		Sink:        params.Sink,
+	}
+}
+
+// Replicator keeps an updatable cache current: it applies the diffs of
+// Source after the sequence of StateFile in order, checkpointing StateFile
+// after each one.
+// Without StateFile it starts from the current state of Source.
+type Replicator struct {
+	Source      ReplicationSource
+	StateFile   string
+	LevelDBPath string
+	// Interval between polls of Source, 0 returns once up to date.
+	Interval time.Duration
+	Sink     ReplicationSink
+}
+
+// Run . With an Interval, errors, ex network ones or a diff not published
+// yet, are logged and retried from the last checkpoint after Interval.
+func (r *Replicator) Run() error {
+	var state *ReplicationState
+	for {
+		err := r.poll(&state)
+		if r.Interval == 0 {
+			return err
+		}
+		if err != nil {
+			logrus.Errorf("Replication: %v, retrying in %v", err, r.Interval)
+		}
+		time.Sleep(r.Interval)
+	}
+}
+
+// poll applies the diffs up to the current state of Source. state is the
+// last checkpoint, read from StateFile when nil.
+func (r *Replicator) poll(state **ReplicationState) error {
+	if *state == nil {
+		local, err := r.localState()
+		if err != nil {
+			return err
+		}
+		*state = &local
+	}
+	remote, err := r.Source.State(0)
+	if err != nil {
+		return err
+	}
+	for (*state).SequenceNumber < remote.SequenceNumber {
+		next, err := r.apply((*state).SequenceNumber + 1)
+		if err != nil {
+			return err
+		}
+		*state = &next
+	}
+	return nil
+}
+
+// localState reads StateFile, or creates it from the state of Source.
+func (r *Replicator) localState() (ReplicationState, error) {
+	f, err := os.Open(r.StateFile)
+	if os.IsNotExist(err) {
+		state, err := r.Source.State(0)
+		if err != nil {
+			return state, err
+		}
+		logrus.Warningf("No %s, starting from sequence %d", r.StateFile, state.SequenceNumber)
+		return state, r.checkpoint(state)
+	}
+	if err != nil {
+		return ReplicationState{}, err
+	}
+	defer f.Close()
+	return ReadReplicationState(f)
+}
+
+// apply applies one diff and checkpoints its state. A diff applied again
+// after a crash before the checkpoint leaves the cache as it was.
+func (r *Replicator) apply(sequence int64) (ReplicationState, error) {
+	emts := make(chan element.Element)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Sink(sequence, emts)
+	}()
+	applier := &ChangeApplier{
+		Source:            r.Source.File(ReplicationPath(sequence) + ".osc.gz"),
+		LevelDBPath:       r.LevelDBPath,
+		OutputElementChan: emts,
+	}
+	if err := applier.Run(); err != nil {
+		<-done
+		return ReplicationState{}, err
+	}
+	if err := <-done; err != nil {
+		return ReplicationState{}, err
+	}
+
+	state, err := r.Source.State(sequence)
+	if os.IsNotExist(err) {
+		state, err = ReplicationState{SequenceNumber: sequence}, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	logrus.Infof("Replicated sequence %d", sequence)
+	return state, r.checkpoint(state)
+}
+
+// checkpoint replaces StateFile.
+func (r *Replicator) checkpoint(state ReplicationState) error {
+	f, err := ioutil.TempFile(filepath.Dir(r.StateFile), ".state")
+	if err != nil {
+		return err
+	}
+	if _, err := state.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), r.StateFile)
+}
@@ -0,0 +1,156 @@
+package osm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicationState(t *testing.T) {
+	state, err := ReadReplicationState(strings.NewReader(
+		"#Sat Jan 01 00:00:02 UTC 2022\nsequenceNumber=4856432\ntimestamp=2022-01-01T00\\:00\\:00Z\n",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReplicationState{
+		SequenceNumber: 4856432,
+		Timestamp:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if state.SequenceNumber != want.SequenceNumber || !state.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("got %+v, want %+v", state, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := state.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadReplicationState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.SequenceNumber != state.SequenceNumber || !again.Timestamp.Equal(state.Timestamp) {
+		t.Errorf("round trip: got %+v, want %+v", again, state)
+	}
+
+	if _, err := ReadReplicationState(strings.NewReader("timestamp=2022-01-01T00\\:00\\:00Z\n")); err == nil {
+		t.Error("expected an error without sequenceNumber")
+	}
+}
+
+func TestReplicationPath(t *testing.T) {
+	for sequence, want := range map[int64]string{
+		1:       "000/000/001",
+		4856432: "004/856/432",
+	} {
+		if got := ReplicationPath(sequence); got != want {
+			t.Errorf("ReplicationPath(%d) = %s, want %s", sequence, got, want)
+		}
+	}
+}
+
+func TestReplicator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-replicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	levelDBPath := newUpdatableCache(t, dir)
+
+	// A replication directory with two minutely diffs.
+	replicationDir := filepath.Join(dir, "minute")
+	writeFile := func(name string, data []byte) {
+		path := filepath.Join(replicationDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return buf.Bytes()
+	}
+	writeFile("000/000/001.osc.gz", gzipped(changeFile))
+	writeFile("000/000/001.state.txt", []byte("sequenceNumber=1\ntimestamp=2022-01-01T00\\:01\\:00Z\n"))
+	writeFile("000/000/002.osc.gz", gzipped(`<osmChange version="0.6"><modify>
+ <node id="5" version="2" lat="3" lon="3"><tag k="shop" v="bakery"/><tag k="name" v="Bread"/></node>
+</modify></osmChange>`))
+	writeFile("state.txt", []byte("sequenceNumber=2\ntimestamp=2022-01-01T00\\:02\\:00Z\n"))
+
+	stateFile := filepath.Join(dir, "state.txt")
+	if err := ioutil.WriteFile(stateFile, []byte("sequenceNumber=0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes := map[int64]int{}
+	replicator := NewReplicator(ReplicatorParams{
+		ReplicationURL: replicationDir,
+		StateFile:      stateFile,
+		LevelDBPath:    levelDBPath,
+		Sink: func(sequence int64, emts <-chan element.Element) error {
+			for range emts {
+				changes[sequence]++
+			}
+			return nil
+		},
+	})
+	if err := replicator.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if changes[1] != 5 || changes[2] != 1 {
+		t.Errorf("got changes %v, want 5 for 1 and 1 for 2", changes)
+	}
+
+	f, err := os.Open(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	state, err := ReadReplicationState(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 002.state.txt is missing, the checkpoint has no timestamp.
+	if state.SequenceNumber != 2 || !state.Timestamp.IsZero() {
+		t.Errorf("checkpoint %+v, want sequence 2", state)
+	}
+
+	// Up to date, nothing to apply.
+	changes = map[int64]int{}
+	if err := replicator.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("applied %v again", changes)
+	}
+
+	// A diff not published yet fails the poll, the next one retries it
+	// from the checkpoint.
+	writeFile("state.txt", []byte("sequenceNumber=3\n"))
+	var polled *ReplicationState
+	if err := replicator.poll(&polled); err == nil {
+		t.Fatal("polled a missing diff")
+	}
+	if polled == nil || polled.SequenceNumber != 2 {
+		t.Fatalf("state %+v after a failed poll, want sequence 2", polled)
+	}
+	writeFile("000/000/003.osc.gz", gzipped(`<osmChange version="0.6"><delete>
+ <node id="5" version="3" lat="3" lon="3"/>
+</delete></osmChange>`))
+	if err := replicator.poll(&polled); err != nil {
+		t.Fatal(err)
+	}
+	if polled.SequenceNumber != 3 || changes[3] != 1 {
+		t.Errorf("state %+v, changes %v, want sequence 3 applied", polled, changes)
+	}
+}
@@ -0,0 +1,196 @@
+package osm
+
+import (
+	"bufio"
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/o5m"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Source is pbf data the passes can read several times.
+type Source interface {
+	// Open returns a reader positioned at the start of the data.
+	Open() (io.ReadCloser, error)
+	// Name is used in logs and errors.
+	Name() string
+}
+
+// FileSource reads a file from disk.
+type FileSource string
+
+// Open .
+func (s FileSource) Open() (io.ReadCloser, error) {
+	return os.Open(string(s))
+}
+
+// Name .
+func (s FileSource) Name() string {
+	return string(s)
+}
+
+// decoder is a pbf.Decoder, an osmxml.Decoder or an o5m.Decoder.
+type decoder interface {
+	Header() (*pbf.Header, error)
+	Parse(o gosmparse.OSMReader) error
+}
+
+// newDecoder detects OSM XML, maybe compressed, and o5m, else reads pbf.
+func newDecoder(r io.Reader, withInfo bool) decoder {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(16)
+	switch {
+	case osmxml.IsXML(head) && withInfo:
+		return osmxml.NewDecoderWithInfo(br)
+	case osmxml.IsXML(head):
+		return osmxml.NewDecoder(br)
+	case o5m.IsO5M(head) && withInfo:
+		return o5m.NewDecoderWithInfo(br)
+	case o5m.IsO5M(head):
+		return o5m.NewDecoder(br)
+	case withInfo:
+		return pbf.NewDecoderWithInfo(br)
+	}
+	return pbf.NewDecoder(br)
+}
+
+// decoderSource is a source that filters or merges while decoding, ex
+// HistorySource or MultiSource.
+type decoderSource interface {
+	openDecoder() (decoder, io.Closer, error)
+}
+
+// openDecoder opens a source, close the reader once done.
+func openDecoder(source Source) (decoder, io.Closer, error) {
+	if s, ok := source.(decoderSource); ok {
+		return s.openDecoder()
+	}
+	reader, err := source.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return newDecoder(reader, false), reader, nil
+}
+
+// decodeSource runs one decoding pass over a source.
+func decodeSource(source Source, o gosmparse.OSMReader) error {
+	decoder, reader, err := openDecoder(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return decoder.Parse(o)
+}
+
+// firstError keeps the first error of gosmparse.OSMReader callbacks,
+// which can't return one. Embed it, then check err after the parse.
+type firstError struct {
+	err error
+}
+
+// fail keeps err if it's the first, and reports whether err isn't nil.
+func (f *firstError) fail(err error) bool {
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return err != nil
+}
+
+// NewReaderAtSource returns a source reading size bytes of r.
+func NewReaderAtSource(r io.ReaderAt, size int64, name string) Source {
+	return &readerAtSource{r: r, size: size, name: name}
+}
+
+type readerAtSource struct {
+	r    io.ReaderAt
+	size int64
+	name string
+}
+
+func (s *readerAtSource) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.NewSectionReader(s.r, 0, s.size)), nil
+}
+
+func (s *readerAtSource) Name() string {
+	return s.name
+}
+
+// NewSpooledSource returns a source for a one-shot reader, ex stdin or a
+// http response body.
+// The first pass reads r blob by blob while copying it to a temp file in
+// dir (os.TempDir if empty), later passes read the temp file.
+// Close removes the temp file.
+func NewSpooledSource(r io.Reader, dir string, name string) (*SpooledSource, error) {
+	spool, err := ioutil.TempFile(dir, "osmparser-spool-")
+	if err != nil {
+		return nil, err
+	}
+	return &SpooledSource{r: r, spool: spool, name: name}, nil
+}
+
+// SpooledSource .
+type SpooledSource struct {
+	r     io.Reader
+	spool *os.File
+	name  string
+
+	mu      sync.Mutex
+	reading bool
+	done    bool
+	err     error
+}
+
+// Open returns the teeing reader the first time, then the spooled file.
+func (s *SpooledSource) Open() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.err != nil:
+		return nil, s.err
+	case s.reading:
+		return nil, errors.New(s.name + ": already being read")
+	case s.done:
+		return os.Open(s.spool.Name())
+	}
+	s.reading = true
+	return &spoolReader{
+		Reader: io.TeeReader(s.r, s.spool),
+		source: s,
+	}, nil
+}
+
+// Name .
+func (s *SpooledSource) Name() string {
+	return s.name
+}
+
+// Close removes the temp file.
+func (s *SpooledSource) Close() error {
+	s.spool.Close()
+	return os.Remove(s.spool.Name())
+}
+
+// spoolReader finishes spooling when closed early, ex after the header.
+type spoolReader struct {
+	io.Reader
+	source *SpooledSource
+}
+
+func (r *spoolReader) Close() error {
+	s := r.source
+	_, err := io.Copy(ioutil.Discard, r.Reader)
+	if err == nil {
+		err = s.spool.Sync()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reading = false
+	s.done = err == nil
+	s.err = err
+	return err
+}
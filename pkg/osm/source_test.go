@@ -0,0 +1,70 @@
+package osm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpooledSource(t *testing.T) {
+	data := bytes.Repeat([]byte("osm"), 100000)
+	source, err := NewSpooledSource(bytes.NewReader(data), "", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	// Stop early, ex reading the header only.
+	reader, err := source.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Open(); err == nil {
+		t.Error("concurrent open of the one-shot reader should fail")
+	}
+	head := make([]byte, 10)
+	if _, err := reader.Read(head); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		reader, err := source.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("pass %d: read %d bytes, want %d", i, len(got), len(data))
+		}
+	}
+
+	if err := source.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(source.spool.Name()); !os.IsNotExist(err) {
+		t.Error("spool file not removed")
+	}
+}
+
+func TestReaderAtSource(t *testing.T) {
+	data := []byte("0123456789")
+	source := NewReaderAtSource(bytes.NewReader(data), 5, "test")
+	for i := 0; i < 2; i++ {
+		reader, err := source.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(reader)
+		if string(got) != "01234" {
+			t.Errorf("got %q", got)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package osm
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osmxml"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"os"
+	"strings"
+)
+
+// ElementWriter is a pbf.Encoder or an osmxml.Encoder.
+type ElementWriter interface {
+	WriteNode(n gosmparse.Node) error
+	WriteWay(w gosmparse.Way) error
+	WriteWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) error
+	WriteRelation(r gosmparse.Relation) error
+	Close() error
+}
+
+// WriteElement writes an element of a PBFParser output stream.
+// Located way nodes are written as way locations, relation members are
+// written as references only.
+func WriteElement(w ElementWriter, e element.Element) error {
+	switch e.Type {
+	case "Node":
+		return w.WriteNode(e.Node)
+	case "Way":
+		if len(e.Elements) == len(e.Way.NodeIDs) && len(e.Elements) > 0 {
+			nodes := make([]gosmparse.Node, len(e.Elements))
+			for i, emt := range e.Elements {
+				nodes[i] = emt.Node
+				nodes[i].ID = e.Way.NodeIDs[i]
+			}
+			return w.WriteWayWithLocations(e.Way, nodes)
+		}
+		return w.WriteWay(e.Way)
+	case "Relation":
+		return w.WriteRelation(e.Relation)
+	}
+	return nil
+}
+
+// CreateElementWriter creates outputFile, written as OSM XML if named .osm
+// or .osm.gz, as pbf if named .pbf or .osm.pbf. Other names are an error.
+// compression and blockSize only apply to pbf. Close also closes the file.
+func CreateElementWriter(outputFile string, header pbf.Header, compression string, blockSize int) (ElementWriter, error) {
+	var format string
+	for _, suffix := range []string{".osm", ".osm.gz", ".pbf"} {
+		if strings.HasSuffix(outputFile, suffix) {
+			format = suffix
+		}
+	}
+	if format == "" {
+		return nil, fmt.Errorf("%s: unknown output format, name it .osm.pbf, .pbf, .osm or .osm.gz", outputFile)
+	}
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	fw := &fileWriter{closers: []io.Closer{f}}
+	switch format {
+	case ".osm":
+		fw.ElementWriter = osmxml.NewEncoder(f, header)
+	case ".osm.gz":
+		gz := gzip.NewWriter(f)
+		fw.closers = append([]io.Closer{gz}, fw.closers...)
+		fw.ElementWriter = osmxml.NewEncoder(gz, header)
+	case ".pbf":
+		if fw.ElementWriter, err = newPBFEncoder(f, header, compression, blockSize); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return fw, nil
+}
+
+// fileWriter closes the encoder, then the writers below it.
+type fileWriter struct {
+	ElementWriter
+	closers []io.Closer
+}
+
+func (w *fileWriter) Close() error {
+	err := w.ElementWriter.Close()
+	for _, c := range w.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// newPBFEncoder returns an encoder, compression defaults to zlib.
+func newPBFEncoder(w io.Writer, header pbf.Header, compression string, blockSize int) (*pbf.Encoder, error) {
+	encoder := pbf.NewEncoder(w, header)
+	if compression != "" {
+		c, err := pbf.ParseCompression(compression)
+		if err != nil {
+			return nil, err
+		}
+		encoder.Compression = c
+	}
+	if blockSize > 0 {
+		encoder.BlockSize = blockSize
+	}
+	return encoder, nil
+}
+
+// NewCatWriter .
+func NewCatWriter(defaultParams DefaultPBFParserParams, writerParams PBFWriterParams) PBFDataParser {
+	return &CatWriter{
+		Source:      defaultParams.source(),
+		OutputFile:  writerParams.OutputFile,
+		Compression: writerParams.Compression,
+		BlockSize:   writerParams.BlockSize,
+	}
+}
+
+// CatWriter copies the input to OutputFile, converting between pbf and
+// OSM XML.
+type CatWriter struct {
+	Source      Source
+	OutputFile  string
+	Compression string
+	BlockSize   int
+
+	elementWriterReader
+}
+
+// Run .
+func (p *CatWriter) Run() error {
+	header, err := checkPBFHeader(p.Source)
+	if err != nil {
+		return err
+	}
+	outHeader := *header
+	outHeader.WritingProgram = ""
+	if p.writer, err = CreateElementWriter(p.OutputFile, outHeader, p.Compression, p.BlockSize); err != nil {
+		return err
+	}
+	if err := decodeSource(p.Source, p); err != nil {
+		p.writer.Close()
+		return err
+	}
+	if p.err != nil {
+		p.writer.Close()
+		return p.err
+	}
+	return p.writer.Close()
+}
+
+// elementWriterReader writes the elements it reads to writer, err is the
+// first write error.
+type elementWriterReader struct {
+	writer ElementWriter
+	err    error
+}
+
+// ReadNode .
+func (p *elementWriterReader) ReadNode(n gosmparse.Node) {
+	if p.err == nil {
+		p.err = p.writer.WriteNode(n)
+	}
+}
+
+// ReadWay .
+func (p *elementWriterReader) ReadWay(w gosmparse.Way) {
+	if p.err == nil {
+		p.err = p.writer.WriteWay(w)
+	}
+}
+
+// ReadWayWithLocations .
+func (p *elementWriterReader) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	if p.err == nil {
+		p.err = p.writer.WriteWayWithLocations(w, nodes)
+	}
+}
+
+// ReadRelation .
+func (p *elementWriterReader) ReadRelation(r gosmparse.Relation) {
+	if p.err == nil {
+		p.err = p.writer.WriteRelation(r)
+	}
+}
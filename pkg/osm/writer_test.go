@@ -0,0 +1,46 @@
+package osm
+
+import (
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateElementWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmparser-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"out.osm.pbf", "out.pbf", "out.osm", "out.osm.gz"} {
+		file := filepath.Join(dir, name)
+		w, err := CreateElementWriter(file, pbf.Header{}, "", 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := w.WriteNode(gosmparse.Node{Element: gosmparse.Element{ID: 1}, Lat: 25, Lon: 121}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		refs := &refCheck{nodes: map[int64]bool{}}
+		if err := decodeSource(FileSource(file), refs); err != nil || !refs.nodes[1] {
+			t.Errorf("%s: read %v, %v", name, refs.nodes, err)
+		}
+	}
+
+	for _, name := range []string{"out.osm.bz2", "out.osm.xml", "out"} {
+		file := filepath.Join(dir, name)
+		if _, err := CreateElementWriter(file, pbf.Header{}, "", 0); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s created", name)
+		}
+	}
+}
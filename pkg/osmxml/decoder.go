@@ -0,0 +1,454 @@
+package osmxml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+)
+
+// IsXML tells OSM XML, plain, gzip or bzip2 compressed, from the first
+// bytes of a stream. PBF files start with a small blob header length.
+func IsXML(head []byte) bool {
+	if bytes.HasPrefix(head, gzipMagic) || bytes.HasPrefix(head, bzip2Magic) {
+		return true
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+	return len(head) > 0 && head[0] == '<'
+}
+
+// decompress detects gzip and bzip2 streams.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(bzip2Magic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, bzip2Magic):
+		return bzip2.NewReader(br), nil
+	}
+	return br, nil
+}
+
+// Action is the osmChange block of an element.
+type Action int
+
+// Actions.
+const (
+	ActionNone Action = iota
+	ActionCreate
+	ActionModify
+	ActionDelete
+)
+
+var actionNames = []string{"", "create", "modify", "delete"}
+
+// String .
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// ChangeReader receives the elements of an osmChange file with their action.
+type ChangeReader interface {
+	ReadNodeChange(a Action, n gosmparse.Node)
+	ReadWayChange(a Action, w gosmparse.Way)
+	ReadRelationChange(a Action, r gosmparse.Relation)
+}
+
+// Decoder reads OSM XML and streams elements into a gosmparse.OSMReader,
+// like pbf.Decoder.
+// osmChange files are read too, deleted elements always have Info with
+// Visible false.
+type Decoder struct {
+	// Change is true for osmChange files, known after Header.
+	Change bool
+
+	r        io.Reader
+	xml      *xml.Decoder
+	withInfo bool
+	header   *pbf.Header
+	action   Action
+	// pending is the first element, read with the header.
+	pending *xml.StartElement
+}
+
+// NewDecoder returns a decoder that ignores element metadata.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// NewDecoderWithInfo returns a decoder that populates Element.Info.
+func NewDecoderWithInfo(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.withInfo = true
+	return d
+}
+
+// Header returns the <osm> generator and <bounds> as a pbf header.
+func (d *Decoder) Header() (*pbf.Header, error) {
+	if d.header != nil {
+		return d.header, nil
+	}
+	r, err := decompress(d.r)
+	if err != nil {
+		return nil, err
+	}
+	d.xml = xml.NewDecoder(r)
+
+	header := &pbf.Header{RequiredFeatures: []string{pbf.FeatureOsmSchema}}
+	root := false
+	for {
+		token, err := d.xml.RawToken()
+		if err == io.EOF && root {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !root {
+			switch start.Name.Local {
+			case "osm":
+			case "osmChange":
+				d.Change = true
+			default:
+				return nil, fmt.Errorf("osmxml: unexpected root element <%s>", start.Name.Local)
+			}
+			root = true
+			header.WritingProgram = attr(start, "generator")
+			continue
+		}
+		if d.startAction(start) {
+			continue
+		}
+		switch start.Name.Local {
+		case "bounds":
+			if header.BBox, err = decodeBounds(start); err != nil {
+				return nil, err
+			}
+		case "node", "way", "relation":
+			d.pending = &start
+		}
+		if d.pending != nil {
+			break
+		}
+		// <note>, <meta> ...
+		if err := d.skip(); err != nil {
+			return nil, err
+		}
+	}
+	d.header = header
+	return header, nil
+}
+
+// ParseChange reads an osmChange stream into o.
+func (d *Decoder) ParseChange(o ChangeReader) error {
+	return d.Parse(&changeReader{d: d, o: o})
+}
+
+// Parse reads the whole stream into o.
+func (d *Decoder) Parse(o gosmparse.OSMReader) error {
+	if _, err := d.Header(); err != nil {
+		return err
+	}
+	locations, _ := o.(pbf.WayLocationReader)
+	for {
+		var start xml.StartElement
+		if d.pending != nil {
+			start, d.pending = *d.pending, nil
+		} else {
+			token, err := d.xml.RawToken()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var ok bool
+			if start, ok = token.(xml.StartElement); !ok {
+				continue
+			}
+		}
+		if d.startAction(start) {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "node":
+			n, err := d.decodeNode(start)
+			if err != nil {
+				return err
+			}
+			o.ReadNode(n)
+		case "way":
+			w, nodes, err := d.decodeWay(start)
+			if err != nil {
+				return err
+			}
+			if locations != nil && nodes != nil {
+				locations.ReadWayWithLocations(w, nodes)
+			} else {
+				o.ReadWay(w)
+			}
+		case "relation":
+			r, err := d.decodeRelation(start)
+			if err != nil {
+				return err
+			}
+			o.ReadRelation(r)
+		default:
+			// Unknown elements, ex overpass <note> or <meta>.
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// startAction enters the <create>, <modify> and <delete> blocks of
+// osmChange files.
+func (d *Decoder) startAction(start xml.StartElement) bool {
+	if !d.Change {
+		return false
+	}
+	for a, name := range actionNames {
+		if a != int(ActionNone) && start.Name.Local == name {
+			d.action = Action(a)
+			return true
+		}
+	}
+	return false
+}
+
+// changeReader passes the current action along.
+type changeReader struct {
+	d *Decoder
+	o ChangeReader
+}
+
+func (r *changeReader) ReadNode(n gosmparse.Node)           { r.o.ReadNodeChange(r.d.action, n) }
+func (r *changeReader) ReadWay(w gosmparse.Way)             { r.o.ReadWayChange(r.d.action, w) }
+func (r *changeReader) ReadRelation(rel gosmparse.Relation) { r.o.ReadRelationChange(r.d.action, rel) }
+
+// element decodes the shared attributes and reads the children of start,
+// calling child for each one but <tag>.
+func (d *Decoder) element(start xml.StartElement, child func(xml.StartElement) error) (gosmparse.Element, error) {
+	e := gosmparse.Element{Tags: map[string]string{}}
+	var err error
+	if e.ID, err = strconv.ParseInt(attr(start, "id"), 10, 64); err != nil {
+		return e, fmt.Errorf("osmxml: <%s> id: %v", start.Name.Local, err)
+	}
+	if d.withInfo || d.action == ActionDelete {
+		if e.Info, err = decodeInfo(start); err != nil {
+			return e, fmt.Errorf("osmxml: <%s id=%d>: %v", start.Name.Local, e.ID, err)
+		}
+		if d.action == ActionDelete {
+			e.Info.Visible = false
+		}
+	}
+
+	for {
+		token, err := d.xml.RawToken()
+		if err != nil {
+			return e, unexpectedEOF(err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "tag" {
+				e.Tags[attr(t, "k")] = attr(t, "v")
+			} else if err := child(t); err != nil {
+				return e, fmt.Errorf("osmxml: <%s id=%d>: %v", start.Name.Local, e.ID, err)
+			}
+			if err := d.skip(); err != nil {
+				return e, err
+			}
+		case xml.EndElement:
+			return e, nil
+		}
+	}
+}
+
+func (d *Decoder) decodeNode(start xml.StartElement) (gosmparse.Node, error) {
+	n := gosmparse.Node{}
+	var err error
+	if n.Element, err = d.element(start, ignoreChild); err != nil {
+		return n, err
+	}
+	// Deleted nodes, ex in history files, may come without location.
+	deleted := d.action == ActionDelete || attr(start, "visible") == "false"
+	if deleted && attr(start, "lat") == "" {
+		return n, nil
+	}
+	if n.Lat, n.Lon, err = decodeLocation(start); err != nil {
+		return n, fmt.Errorf("osmxml: <node id=%d>: %v", n.ID, err)
+	}
+	return n, nil
+}
+
+// decodeWay also returns the <nd> locations if every one has them.
+func (d *Decoder) decodeWay(start xml.StartElement) (gosmparse.Way, []gosmparse.Node, error) {
+	w := gosmparse.Way{}
+	var nodes []gosmparse.Node
+	located := true
+	var err error
+	w.Element, err = d.element(start, func(child xml.StartElement) error {
+		if child.Name.Local != "nd" {
+			return nil
+		}
+		ref, err := strconv.ParseInt(attr(child, "ref"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("nd ref: %v", err)
+		}
+		w.NodeIDs = append(w.NodeIDs, ref)
+		if located = located && attr(child, "lat") != ""; located {
+			n := gosmparse.Node{Element: gosmparse.Element{ID: ref}}
+			if n.Lat, n.Lon, err = decodeLocation(child); err != nil {
+				return err
+			}
+			nodes = append(nodes, n)
+		}
+		return nil
+	})
+	if err != nil {
+		return w, nil, err
+	}
+	if !located || len(nodes) == 0 {
+		nodes = nil
+	}
+	return w, nodes, nil
+}
+
+func (d *Decoder) decodeRelation(start xml.StartElement) (gosmparse.Relation, error) {
+	r := gosmparse.Relation{}
+	var err error
+	r.Element, err = d.element(start, func(child xml.StartElement) error {
+		if child.Name.Local != "member" {
+			return nil
+		}
+		m := gosmparse.RelationMember{Role: attr(child, "role")}
+		switch t := attr(child, "type"); t {
+		case "node":
+			m.Type = gosmparse.NodeType
+		case "way":
+			m.Type = gosmparse.WayType
+		case "relation":
+			m.Type = gosmparse.RelationType
+		default:
+			return fmt.Errorf("unknown member type %q", t)
+		}
+		var err error
+		if m.ID, err = strconv.ParseInt(attr(child, "ref"), 10, 64); err != nil {
+			return fmt.Errorf("member ref: %v", err)
+		}
+		r.Members = append(r.Members, m)
+		return nil
+	})
+	return r, err
+}
+
+// decodeInfo defaults like the pbf decoder, version -1 and visible.
+func decodeInfo(start xml.StartElement) (*gosmparse.Info, error) {
+	info := &gosmparse.Info{Version: -1, Visible: true, User: attr(start, "user")}
+	var err error
+	if v := attr(start, "version"); v != "" {
+		if info.Version, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := attr(start, "timestamp"); v != "" {
+		if info.Timestamp, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, err
+		}
+	}
+	if v := attr(start, "changeset"); v != "" {
+		if info.Changeset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if v := attr(start, "uid"); v != "" {
+		if info.UID, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := attr(start, "visible"); v != "" {
+		info.Visible = v != "false"
+	}
+	return info, nil
+}
+
+func decodeLocation(start xml.StartElement) (lat, lon float64, err error) {
+	if lat, err = strconv.ParseFloat(attr(start, "lat"), 64); err != nil {
+		return 0, 0, fmt.Errorf("lat: %v", err)
+	}
+	if lon, err = strconv.ParseFloat(attr(start, "lon"), 64); err != nil {
+		return 0, 0, fmt.Errorf("lon: %v", err)
+	}
+	return lat, lon, nil
+}
+
+func decodeBounds(start xml.StartElement) (*pbf.BBox, error) {
+	var v [4]float64
+	for i, name := range []string{"minlon", "maxlon", "maxlat", "minlat"} {
+		var err error
+		if v[i], err = strconv.ParseFloat(attr(start, name), 64); err != nil {
+			return nil, fmt.Errorf("osmxml: bounds %s: %v", name, err)
+		}
+	}
+	return &pbf.BBox{Left: v[0], Right: v[1], Top: v[2], Bottom: v[3]}, nil
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// skip reads up to the end of the current element.
+// xml.Decoder.Skip can't be mixed with RawToken.
+func (d *Decoder) skip() error {
+	for depth := 0; ; {
+		token, err := d.xml.RawToken()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+func ignoreChild(xml.StartElement) error {
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
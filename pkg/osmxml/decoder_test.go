@@ -0,0 +1,233 @@
+package osmxml
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/thomersch/gosmparse"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6" generator="JOSM">
+ <note>The data included in this document is from www.openstreetmap.org.</note>
+ <bounds minlat="24.9" minlon="121.4" maxlat="25.1" maxlon="121.6"/>
+ <node id="1" version="3" timestamp="2019-01-02T03:04:05Z" changeset="42" uid="7" user="mapper" lat="25.0" lon="121.5">
+  <tag k="amenity" v="cafe"/>
+  <tag k="name" v="Tom &amp; Jerry&apos;s"/>
+ </node>
+ <node id="-2" lat="25.01" lon="121.51"/>
+ <way id="10">
+  <nd ref="1"/>
+  <nd ref="-2"/>
+  <tag k="highway" v="path"/>
+ </way>
+ <way id="11">
+  <nd ref="1" lat="25.0" lon="121.5"/>
+  <nd ref="-2" lat="25.01" lon="121.51"/>
+ </way>
+ <relation id="100" visible="false">
+  <member type="way" ref="10" role="outer"/>
+  <member type="node" ref="1" role=""/>
+  <tag k="type" v="route"/>
+ </relation>
+</osm>
+`
+
+type collector struct {
+	nodes     []gosmparse.Node
+	ways      []gosmparse.Way
+	relations []gosmparse.Relation
+}
+
+func (c *collector) ReadNode(n gosmparse.Node)         { c.nodes = append(c.nodes, n) }
+func (c *collector) ReadWay(w gosmparse.Way)           { c.ways = append(c.ways, w) }
+func (c *collector) ReadRelation(r gosmparse.Relation) { c.relations = append(c.relations, r) }
+
+type locatedCollector struct {
+	collector
+	located map[int64][]gosmparse.Node
+}
+
+func (c *locatedCollector) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	c.ways = append(c.ways, w)
+	c.located[w.ID] = nodes
+}
+
+func TestDecoder(t *testing.T) {
+	decoder := NewDecoderWithInfo(strings.NewReader(sampleXML))
+	header, err := decoder.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.WritingProgram != "JOSM" || header.BBox == nil || header.BBox.Left != 121.4 || header.BBox.Top != 25.1 {
+		t.Errorf("unexpected header %+v %+v", header, header.BBox)
+	}
+
+	got := &locatedCollector{located: map[int64][]gosmparse.Node{}}
+	if err := decoder.Parse(got); err != nil {
+		t.Fatal(err)
+	}
+
+	wantNodes := []gosmparse.Node{
+		{
+			Element: gosmparse.Element{
+				ID:   1,
+				Tags: map[string]string{"amenity": "cafe", "name": "Tom & Jerry's"},
+				Info: &gosmparse.Info{
+					Version:   3,
+					Timestamp: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+					Changeset: 42,
+					UID:       7,
+					User:      "mapper",
+					Visible:   true,
+				},
+			},
+			Lat: 25.0,
+			Lon: 121.5,
+		},
+		{
+			Element: gosmparse.Element{ID: -2, Tags: map[string]string{}, Info: &gosmparse.Info{Version: -1, Visible: true}},
+			Lat:     25.01,
+			Lon:     121.51,
+		},
+	}
+	if !reflect.DeepEqual(got.nodes, wantNodes) {
+		t.Errorf("nodes %+v, want %+v", got.nodes, wantNodes)
+	}
+
+	if len(got.ways) != 2 || !reflect.DeepEqual(got.ways[0].NodeIDs, []int64{1, -2}) || got.ways[0].Tags["highway"] != "path" {
+		t.Errorf("unexpected ways %+v", got.ways)
+	}
+	if _, ok := got.located[10]; ok {
+		t.Error("way 10 has no locations")
+	}
+	if nodes := got.located[11]; len(nodes) != 2 || nodes[1].ID != -2 || nodes[1].Lat != 25.01 {
+		t.Errorf("way 11 locations %+v", nodes)
+	}
+
+	wantMembers := []gosmparse.RelationMember{
+		{ID: 10, Type: gosmparse.WayType, Role: "outer"},
+		{ID: 1, Type: gosmparse.NodeType},
+	}
+	if len(got.relations) != 1 || !reflect.DeepEqual(got.relations[0].Members, wantMembers) {
+		t.Errorf("unexpected relations %+v", got.relations)
+	} else if got.relations[0].Info.Visible {
+		t.Error("relation 100 is deleted")
+	}
+}
+
+func TestDecoderWithoutLocations(t *testing.T) {
+	got := &collector{}
+	if err := NewDecoder(strings.NewReader(sampleXML)).Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.nodes) != 2 || len(got.ways) != 2 || len(got.relations) != 1 {
+		t.Errorf("got %d nodes, %d ways, %d relations", len(got.nodes), len(got.ways), len(got.relations))
+	}
+	if got.nodes[0].Info != nil {
+		t.Error("info without NewDecoderWithInfo")
+	}
+}
+
+func TestDecoderGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(sampleXML))
+	gz.Close()
+	if !IsXML(buf.Bytes()) {
+		t.Error("gzip data not detected")
+	}
+	got := &collector{}
+	if err := NewDecoder(&buf).Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.nodes) != 2 {
+		t.Errorf("got %d nodes", len(got.nodes))
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, data := range []string{
+		`<gpx version="1.1"></gpx>`,
+		`<osm><node id="x" lat="1" lon="1"/></osm>`,
+		`<osm><node id="1" lat="1"/></osm>`,
+		`<osm><relation id="1"><member type="area" ref="1"/></relation></osm>`,
+		`<osm><way id="1"><nd ref="1"/>`,
+	} {
+		if err := NewDecoder(strings.NewReader(data)).Parse(&collector{}); err == nil {
+			t.Errorf("no error for %s", data)
+		}
+	}
+}
+
+const sampleChange = `<?xml version="1.0" encoding="UTF-8"?>
+<osmChange version="0.6" generator="osmosis">
+ <create>
+  <node id="5" version="1" lat="25.0" lon="121.5"><tag k="amenity" v="cafe"/></node>
+ </create>
+ <modify>
+  <way id="10" version="2"><nd ref="1"/><nd ref="5"/></way>
+  <node id="1" version="4" lat="25.1" lon="121.6"/>
+ </modify>
+ <delete>
+  <node id="2" version="3"/>
+  <relation id="100" version="7"/>
+ </delete>
+</osmChange>
+`
+
+type change struct {
+	action Action
+	kind   string
+	id     int64
+}
+
+type changeCollector struct {
+	changes []change
+	deleted map[int64]bool
+}
+
+func (c *changeCollector) ReadNodeChange(a Action, n gosmparse.Node) {
+	c.changes = append(c.changes, change{a, "node", n.ID})
+	if n.Info != nil && !n.Info.Visible {
+		c.deleted[n.ID] = true
+	}
+}
+
+func (c *changeCollector) ReadWayChange(a Action, w gosmparse.Way) {
+	c.changes = append(c.changes, change{a, "way", w.ID})
+}
+
+func (c *changeCollector) ReadRelationChange(a Action, r gosmparse.Relation) {
+	c.changes = append(c.changes, change{a, "relation", r.ID})
+	if r.Info != nil && !r.Info.Visible {
+		c.deleted[r.ID] = true
+	}
+}
+
+func TestDecoderChange(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(sampleChange))
+	got := &changeCollector{deleted: map[int64]bool{}}
+	if err := decoder.ParseChange(got); err != nil {
+		t.Fatal(err)
+	}
+	if !decoder.Change {
+		t.Error("osmChange not detected")
+	}
+	want := []change{
+		{ActionCreate, "node", 5},
+		{ActionModify, "way", 10},
+		{ActionModify, "node", 1},
+		{ActionDelete, "node", 2},
+		{ActionDelete, "relation", 100},
+	}
+	if !reflect.DeepEqual(got.changes, want) {
+		t.Errorf("changes %v, want %v", got.changes, want)
+	}
+	if !reflect.DeepEqual(got.deleted, map[int64]bool{2: true, 100: true}) {
+		t.Errorf("deleted %v", got.deleted)
+	}
+}
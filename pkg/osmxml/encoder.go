@@ -0,0 +1,264 @@
+package osmxml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	errEncoderClosed = errors.New("osmxml: write to closed encoder")
+	errNoAction      = errors.New("osmxml: osmChange element outside a create, modify or delete block")
+)
+
+var memberTypes = map[gosmparse.MemberType]string{
+	gosmparse.NodeType:     "node",
+	gosmparse.WayType:      "way",
+	gosmparse.RelationType: "relation",
+}
+
+// Encoder writes OSM XML, it has the same methods as pbf.Encoder.
+// Element.Info is written when present.
+type Encoder struct {
+	w             *bufio.Writer
+	header        pbf.Header
+	headerWritten bool
+	change        bool
+	action        Action
+	closed        bool
+	err           error
+}
+
+// NewEncoder returns an encoder writing to w, the header gives the
+// generator and bounds.
+func NewEncoder(w io.Writer, header pbf.Header) *Encoder {
+	if header.WritingProgram == "" {
+		header.WritingProgram = pbf.DefaultWritingProgram
+	}
+	return &Encoder{w: bufio.NewWriter(w), header: header}
+}
+
+// NewChangeEncoder returns an encoder writing an osmChange file, SetAction
+// starts the blocks elements are written to.
+func NewChangeEncoder(w io.Writer, header pbf.Header) *Encoder {
+	e := NewEncoder(w, header)
+	e.change = true
+	return e
+}
+
+// SetAction ends the current osmChange block and starts an a block, unless
+// a is the current one.
+func (e *Encoder) SetAction(a Action) error {
+	if !e.start() {
+		return e.err
+	}
+	if !e.change {
+		return errors.New("osmxml: action in an osm file")
+	}
+	if a == e.action {
+		return nil
+	}
+	e.endAction()
+	if a != ActionNone {
+		e.write(" <" + a.String() + ">\n")
+	}
+	e.action = a
+	return e.err
+}
+
+// WriteNode .
+func (e *Encoder) WriteNode(n gosmparse.Node) error {
+	if !e.startElement() {
+		return e.err
+	}
+	e.open("node", n.Element)
+	e.attr("lat", formatCoord(n.Lat))
+	e.attr("lon", formatCoord(n.Lon))
+	e.children(n.Element, "node", nil)
+	return e.err
+}
+
+// WriteWay .
+func (e *Encoder) WriteWay(w gosmparse.Way) error {
+	return e.WriteWayWithLocations(w, nil)
+}
+
+// WriteWayWithLocations writes the node locations as <nd> lat and lon.
+func (e *Encoder) WriteWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) error {
+	if !e.startElement() {
+		return e.err
+	}
+	if nodes != nil && len(nodes) != len(w.NodeIDs) {
+		return errors.New("osmxml: way node locations don't match node ids")
+	}
+	e.open("way", w.Element)
+	e.children(w.Element, "way", func() {
+		for i, id := range w.NodeIDs {
+			e.write("  <nd")
+			e.attr("ref", strconv.FormatInt(id, 10))
+			if nodes != nil {
+				e.attr("lat", formatCoord(nodes[i].Lat))
+				e.attr("lon", formatCoord(nodes[i].Lon))
+			}
+			e.write("/>\n")
+		}
+	})
+	return e.err
+}
+
+// WriteRelation .
+func (e *Encoder) WriteRelation(r gosmparse.Relation) error {
+	if !e.startElement() {
+		return e.err
+	}
+	e.open("relation", r.Element)
+	e.children(r.Element, "relation", func() {
+		for _, m := range r.Members {
+			e.write("  <member")
+			e.attr("type", memberTypes[m.Type])
+			e.attr("ref", strconv.FormatInt(m.ID, 10))
+			e.attr("role", m.Role)
+			e.write("/>\n")
+		}
+	})
+	return e.err
+}
+
+// Close ends the document and flushes, the underlying writer stays open.
+func (e *Encoder) Close() error {
+	if !e.start() {
+		return e.err
+	}
+	if e.change {
+		e.endAction()
+		e.write("</osmChange>\n")
+	} else {
+		e.write("</osm>\n")
+	}
+	e.closed = true
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
+
+// start writes the header once, false if the encoder can't be written.
+func (e *Encoder) start() bool {
+	if e.closed {
+		e.err = errEncoderClosed
+	}
+	if e.err != nil {
+		return false
+	}
+	if !e.headerWritten {
+		e.headerWritten = true
+		e.write("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		if e.change {
+			e.write("<osmChange")
+		} else {
+			e.write("<osm")
+		}
+		e.attr("version", "0.6")
+		e.attr("generator", e.header.WritingProgram)
+		e.write(">\n")
+		if b := e.header.BBox; b != nil && !e.change {
+			e.write(" <bounds")
+			e.attr("minlat", formatCoord(b.Bottom))
+			e.attr("minlon", formatCoord(b.Left))
+			e.attr("maxlat", formatCoord(b.Top))
+			e.attr("maxlon", formatCoord(b.Right))
+			e.write("/>\n")
+		}
+	}
+	return e.err == nil
+}
+
+// startElement is start, osmChange elements also need an action.
+func (e *Encoder) startElement() bool {
+	if !e.start() {
+		return false
+	}
+	if e.change && e.action == ActionNone {
+		e.err = errNoAction
+	}
+	return e.err == nil
+}
+
+func (e *Encoder) endAction() {
+	if e.action != ActionNone {
+		e.write(" </" + e.action.String() + ">\n")
+		e.action = ActionNone
+	}
+}
+
+func (e *Encoder) open(name string, el gosmparse.Element) {
+	e.write(" <" + name)
+	e.attr("id", strconv.FormatInt(el.ID, 10))
+	if info := el.Info; info != nil {
+		if info.Version >= 0 {
+			e.attr("version", strconv.Itoa(info.Version))
+		}
+		if !info.Timestamp.IsZero() {
+			e.attr("timestamp", info.Timestamp.UTC().Format(time.RFC3339))
+		}
+		if info.Changeset != 0 {
+			e.attr("changeset", strconv.FormatInt(info.Changeset, 10))
+		}
+		if info.UID != 0 {
+			e.attr("uid", strconv.Itoa(info.UID))
+			e.attr("user", info.User)
+		}
+		if !info.Visible {
+			e.attr("visible", "false")
+		}
+	}
+}
+
+// children writes the tags after members, or closes an empty element.
+func (e *Encoder) children(el gosmparse.Element, name string, members func()) {
+	if len(el.Tags) == 0 && members == nil {
+		e.write("/>\n")
+		return
+	}
+	e.write(">\n")
+	if members != nil {
+		members()
+	}
+	keys := make([]string, 0, len(el.Tags))
+	for k := range el.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.write("  <tag")
+		e.attr("k", k)
+		e.attr("v", el.Tags[k])
+		e.write("/>\n")
+	}
+	e.write(" </" + name + ">\n")
+}
+
+func (e *Encoder) attr(name, value string) {
+	e.write(" " + name + "=\"")
+	if e.err == nil {
+		e.err = xml.EscapeText(e.w, []byte(value))
+	}
+	e.write("\"")
+}
+
+func (e *Encoder) write(s string) {
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+// formatCoord rounds to 100 nanodegrees, the OSM precision.
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 7, 64)
+}
@@ -0,0 +1,114 @@
+package osmxml
+
+import (
+	"bytes"
+	"github.com/groundhog-technologies/osmparser/pkg/pbf"
+	"github.com/thomersch/gosmparse"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncoderRoundTrip(t *testing.T) {
+	decoder := NewDecoderWithInfo(strings.NewReader(sampleXML))
+	header, err := decoder.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &locatedCollector{located: map[int64][]gosmparse.Node{}}
+	if err := decoder.Parse(want); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf, *header)
+	for _, n := range want.nodes {
+		if err := encoder.WriteNode(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, w := range want.ways {
+		if err := encoder.WriteWayWithLocations(w, want.located[w.ID]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range want.relations {
+		if err := encoder.WriteRelation(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.WriteNode(want.nodes[0]); err != errEncoderClosed {
+		t.Errorf("write after close: %v", err)
+	}
+
+	decoder = NewDecoderWithInfo(&buf)
+	gotHeader, err := decoder.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotHeader, header) {
+		t.Errorf("header %+v, want %+v", gotHeader, header)
+	}
+	got := &locatedCollector{located: map[int64][]gosmparse.Node{}}
+	if err := decoder.Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestChangeEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewChangeEncoder(&buf, pbf.Header{})
+	node := gosmparse.Node{Element: gosmparse.Element{ID: 5, Tags: map[string]string{"shop": "bakery"}}, Lat: 1, Lon: 2}
+	if err := encoder.WriteNode(node); err != errNoAction {
+		t.Errorf("write outside a block: %v", err)
+	}
+
+	encoder = NewChangeEncoder(&buf, pbf.Header{})
+	for _, step := range []struct {
+		action Action
+		write  func() error
+	}{
+		{ActionCreate, func() error { return encoder.WriteNode(node) }},
+		{ActionCreate, func() error {
+			return encoder.WriteWay(gosmparse.Way{Element: gosmparse.Element{ID: 10}, NodeIDs: []int64{1, 5}})
+		}},
+		{ActionModify, func() error { return encoder.WriteNode(gosmparse.Node{Element: gosmparse.Element{ID: 1}}) }},
+		{ActionDelete, func() error {
+			return encoder.WriteRelation(gosmparse.Relation{Element: gosmparse.Element{ID: 100}})
+		}},
+	} {
+		if err := encoder.SetAction(step.action); err != nil {
+			t.Fatal(err)
+		}
+		if err := step.write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<create>"); n != 1 {
+		t.Errorf("%d create blocks, want 1", n)
+	}
+
+	decoder := NewDecoder(&buf)
+	got := &changeCollector{deleted: map[int64]bool{}}
+	if err := decoder.ParseChange(got); err != nil {
+		t.Fatal(err)
+	}
+	want := []change{
+		{ActionCreate, "node", 5},
+		{ActionCreate, "way", 10},
+		{ActionModify, "node", 1},
+		{ActionDelete, "relation", 100},
+	}
+	if !reflect.DeepEqual(got.changes, want) {
+		t.Errorf("changes %v, want %v", got.changes, want)
+	}
+}
@@ -0,0 +1,350 @@
+package pbf
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz/lzma"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Compression is the encoding of the data stored in a blob.
+type Compression int
+
+// Blob compressions from fileformat.proto.
+const (
+	CompressionNone Compression = iota
+	CompressionZlib
+	CompressionLZMA
+	CompressionBzip2
+	CompressionLZ4
+	CompressionZstd
+)
+
+// Block types.
+const (
+	HeaderType = "OSMHeader"
+	DataType   = "OSMData"
+)
+
+const (
+	// Limits from the PBF spec.
+	maxBlobHeaderSize = 64 * 1024
+	maxBlobSize       = 32 * 1024 * 1024
+)
+
+// Blob fields.
+const (
+	blobRaw      = 1
+	blobRawSize  = 2
+	blobZlib     = 3
+	blobLZMA     = 4
+	blobBzip2    = 5
+	blobLZ4      = 6
+	blobZstd     = 7
+	headerType   = 1
+	headerLength = 3
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone:  "none",
+	CompressionZlib:  "zlib",
+	CompressionLZMA:  "lzma",
+	CompressionBzip2: "bzip2",
+	CompressionLZ4:   "lz4",
+	CompressionZstd:  "zstd",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// ParseCompression returns the compression by name, ex "zstd".
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if strings.EqualFold(n, name) {
+			return c, nil
+		}
+	}
+	if name == "" || strings.EqualFold(name, "raw") {
+		return CompressionNone, nil
+	}
+	return CompressionNone, fmt.Errorf("pbf: unknown compression %q", name)
+}
+
+// Block is one file block: a blob header type and the uncompressed blob data.
+type Block struct {
+	Type string
+	Data []byte
+}
+
+// rawBlock is a file block whose blob has not been decompressed yet.
+type rawBlock struct {
+	Type string
+	Blob []byte
+}
+
+// readRawBlock reads the next file block without decompressing it.
+func readRawBlock(r io.Reader) (rawBlock, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return rawBlock{}, err
+	}
+	headerSize := binary.BigEndian.Uint32(sizeBuf[:])
+	if headerSize > maxBlobHeaderSize {
+		return rawBlock{}, fmt.Errorf("pbf: blob header size %d exceeds limit", headerSize)
+	}
+	headerBuf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, headerBuf); err != nil {
+		return rawBlock{}, unexpectedEOF(err)
+	}
+
+	var (
+		block    rawBlock
+		dataSize uint64
+	)
+	pr := newProtoReader(headerBuf)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return rawBlock{}, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case headerType:
+			b, err := pr.bytes()
+			if err != nil {
+				return rawBlock{}, err
+			}
+			block.Type = string(b)
+		case headerLength:
+			if dataSize, err = pr.varint(); err != nil {
+				return rawBlock{}, err
+			}
+		default:
+			if err := pr.skip(wire); err != nil {
+				return rawBlock{}, err
+			}
+		}
+	}
+	if dataSize > maxBlobSize {
+		return rawBlock{}, fmt.Errorf("pbf: blob size %d exceeds limit", dataSize)
+	}
+	block.Blob = make([]byte, dataSize)
+	if _, err := io.ReadFull(r, block.Blob); err != nil {
+		return rawBlock{}, unexpectedEOF(err)
+	}
+	return block, nil
+}
+
+// ReadBlock reads and decompresses the next file block.
+func ReadBlock(r io.Reader) (Block, error) {
+	raw, err := readRawBlock(r)
+	if err != nil {
+		return Block{}, err
+	}
+	data, _, err := decodeBlob(raw.Blob)
+	if err != nil {
+		return Block{}, err
+	}
+	return Block{Type: raw.Type, Data: data}, nil
+}
+
+// WriteBlock compresses data and writes it as one file block.
+func WriteBlock(w io.Writer, blockType string, data []byte, c Compression) error {
+	blob, err := encodeBlob(data, c)
+	if err != nil {
+		return err
+	}
+
+	var header protoWriter
+	header.string(headerType, blockType)
+	header.varint(headerLength, uint64(len(blob)))
+
+	var sizeBuf [4]byte
+	binary.BigEndian.PutUint32(sizeBuf[:], uint32(len(header.buf)))
+	if _, err := w.Write(sizeBuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(header.buf); err != nil {
+		return err
+	}
+	_, err = w.Write(blob)
+	return err
+}
+
+// decodeBlob returns the uncompressed blob content and its compression.
+func decodeBlob(blob []byte) ([]byte, Compression, error) {
+	var (
+		rawSize uint64
+		data    []byte
+		c       Compression
+		found   bool
+	)
+	pr := newProtoReader(blob)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, c, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case blobRawSize:
+			if rawSize, err = pr.varint(); err != nil {
+				return nil, c, err
+			}
+		case blobRaw, blobZlib, blobLZMA, blobBzip2, blobLZ4, blobZstd:
+			if data, err = pr.bytes(); err != nil {
+				return nil, c, err
+			}
+			c = blobCompression[field]
+			found = true
+		default:
+			if err := pr.skip(wire); err != nil {
+				return nil, c, err
+			}
+		}
+	}
+	if !found {
+		return nil, c, fmt.Errorf("pbf: found block with unknown data")
+	}
+	if c == CompressionNone {
+		return data, c, nil
+	}
+	if rawSize > maxBlobSize {
+		return nil, c, fmt.Errorf("pbf: raw blob size %d exceeds limit", rawSize)
+	}
+	out, err := decompress(data, c, int(rawSize))
+	if err != nil {
+		return nil, c, fmt.Errorf("pbf: %v blob: %v", c, err)
+	}
+	if len(out) != int(rawSize) {
+		return nil, c, fmt.Errorf("pbf: expected %v bytes, read %v", rawSize, len(out))
+	}
+	return out, c, nil
+}
+
+var blobCompression = map[int]Compression{
+	blobRaw:   CompressionNone,
+	blobZlib:  CompressionZlib,
+	blobLZMA:  CompressionLZMA,
+	blobBzip2: CompressionBzip2,
+	blobLZ4:   CompressionLZ4,
+	blobZstd:  CompressionZstd,
+}
+
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+func decompress(data []byte, c Compression, rawSize int) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case CompressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case CompressionLZMA:
+		lr, err := lzma.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = lr
+	case CompressionBzip2:
+		r = bzip2.NewReader(bytes.NewReader(data))
+	case CompressionLZ4:
+		// lz4_data holds a single raw LZ4 block.
+		out := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(data, out)
+		if err != nil {
+			return nil, err
+		}
+		return out[:n], nil
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(data, make([]byte, 0, rawSize))
+	default:
+		return nil, fmt.Errorf("unsupported compression")
+	}
+	return ioutil.ReadAll(io.LimitReader(r, maxBlobSize+1))
+}
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// encodeBlob builds a Blob message holding data with compression c.
+func encodeBlob(data []byte, c Compression) ([]byte, error) {
+	var blob protoWriter
+	if c == CompressionNone {
+		blob.bytes(blobRaw, data)
+		return blob.buf, nil
+	}
+
+	var (
+		field      int
+		compressed []byte
+	)
+	switch c {
+	case CompressionZlib:
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		field, compressed = blobZlib, buf.Bytes()
+	case CompressionLZMA:
+		var buf bytes.Buffer
+		lw, err := lzma.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := lw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := lw.Close(); err != nil {
+			return nil, err
+		}
+		field, compressed = blobLZMA, buf.Bytes()
+	case CompressionLZ4:
+		out := make([]byte, lz4.CompressBlockBound(len(data)))
+		n, err := lz4.CompressBlock(data, out, nil)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			// Incompressible data, store it raw.
+			blob.bytes(blobRaw, data)
+			return blob.buf, nil
+		}
+		field, compressed = blobLZ4, out[:n]
+	case CompressionZstd:
+		field, compressed = blobZstd, zstdEncoder.EncodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("pbf: cannot write %v blobs", c)
+	}
+	blob.varint(blobRawSize, uint64(len(data)))
+	blob.bytes(field, compressed)
+	return blob.buf, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
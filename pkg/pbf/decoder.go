@@ -0,0 +1,156 @@
+package pbf
+
+import (
+	"github.com/thomersch/gosmparse"
+	"io"
+	"runtime"
+)
+
+// Decoder reads OSM PBF data and streams elements into a gosmparse.OSMReader.
+// Blobs are decompressed in parallel but elements are delivered in file order.
+type Decoder struct {
+	// QueueSize is the number of blobs read ahead of the reader.
+	QueueSize int
+	// Workers is the number of blobs decoded in parallel, default GOMAXPROCS.
+	Workers int
+
+	r        io.Reader
+	withInfo bool
+	header   *Header
+}
+
+// NewDecoder returns a decoder that ignores element metadata.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:         r,
+		QueueSize: 200,
+	}
+}
+
+// NewDecoderWithInfo returns a decoder that populates Element.Info.
+func NewDecoderWithInfo(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.withInfo = true
+	return d
+}
+
+// WayLocationReader is implemented by readers that take the node locations
+// carried by ways of LocationsOnWays files. Readers without it get ReadWay.
+type WayLocationReader interface {
+	ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node)
+}
+
+// blockJob is one data blob waiting to be decoded.
+type blockJob struct {
+	blob   []byte
+	groups []primitiveGroup
+	err    error
+	done   chan struct{}
+}
+
+// Header returns the file header, reading it from the stream on first use.
+func (d *Decoder) Header() (*Header, error) {
+	if d.header == nil {
+		header, err := ReadHeader(d.r)
+		if err != nil {
+			return nil, err
+		}
+		d.header = header
+	}
+	return d.header, nil
+}
+
+// Parse reads the whole stream into o.
+func (d *Decoder) Parse(o gosmparse.OSMReader) error {
+	if _, err := d.Header(); err != nil {
+		return err
+	}
+
+	workers := d.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	queueSize := d.QueueSize
+	if queueSize < workers {
+		queueSize = workers
+	}
+
+	quit := make(chan struct{})
+	defer close(quit)
+
+	jobs := make(chan *blockJob, queueSize)
+	ordered := make(chan *blockJob, queueSize)
+	readErr := make(chan error, 1)
+
+	// Feeder, keeps file order in ordered.
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+		for {
+			block, err := readRawBlock(d.r)
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				return
+			}
+			if block.Type != DataType {
+				// Unknown block types must be skipped.
+				continue
+			}
+			job := &blockJob{blob: block.Blob, done: make(chan struct{})}
+			select {
+			case ordered <- job:
+			case <-quit:
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	// Workers exit once the feeder closes jobs.
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				data, _, err := decodeBlob(job.blob)
+				if err == nil {
+					job.groups, err = decodePrimitiveBlock(data, d.withInfo)
+				}
+				job.blob = nil
+				job.err = err
+				close(job.done)
+			}
+		}()
+	}
+	for job := range ordered {
+		<-job.done
+		if job.err != nil {
+			return job.err
+		}
+		for _, g := range job.groups {
+			for _, n := range g.nodes {
+				o.ReadNode(n)
+			}
+			for i, w := range g.ways {
+				if located, ok := o.(WayLocationReader); ok && g.wayNodes[i] != nil {
+					located.ReadWayWithLocations(w, g.wayNodes[i])
+					continue
+				}
+				o.ReadWay(w)
+			}
+			for _, r := range g.relations {
+				o.ReadRelation(r)
+			}
+		}
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
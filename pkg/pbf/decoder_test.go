@@ -0,0 +1,125 @@
+package pbf
+
+import (
+	"bytes"
+	"github.com/thomersch/gosmparse"
+	"github.com/thomersch/gosmparse/OSMPBF"
+	"reflect"
+	"testing"
+)
+
+type collector struct {
+	nodes     []gosmparse.Node
+	ways      []gosmparse.Way
+	relations []gosmparse.Relation
+}
+
+func (c *collector) ReadNode(n gosmparse.Node)         { c.nodes = append(c.nodes, n) }
+func (c *collector) ReadWay(w gosmparse.Way)           { c.ways = append(c.ways, w) }
+func (c *collector) ReadRelation(r gosmparse.Relation) { c.relations = append(c.relations, r) }
+
+// samplePBF builds a small file whose data block uses compression c.
+func samplePBF(t *testing.T, c Compression) []byte {
+	header := &OSMPBF.HeaderBlock{
+		RequiredFeatures: []string{"OsmSchema-V0.6", "DenseNodes"},
+	}
+	headerData, err := header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &OSMPBF.PrimitiveBlock{
+		Stringtable: &OSMPBF.StringTable{
+			S: []string{"", "amenity", "cafe", "highway", "path", "type", "route", "outer"},
+		},
+		Primitivegroup: []*OSMPBF.PrimitiveGroup{
+			{
+				Dense: &OSMPBF.DenseNodes{
+					Id:       []int64{1, 1, 1},
+					Lat:      []int64{250000000, 10, 10},
+					Lon:      []int64{1215000000, 10, 10},
+					KeysVals: []int32{0, 1, 2, 0, 0},
+				},
+			},
+			{
+				Ways: []*OSMPBF.Way{
+					{Id: 10, Keys: []uint32{3}, Vals: []uint32{4}, Refs: []int64{1, 1, 1}},
+				},
+			},
+			{
+				Relations: []*OSMPBF.Relation{
+					{
+						Id:       100,
+						Keys:     []uint32{5},
+						Vals:     []uint32{6},
+						RolesSid: []int32{7, 0},
+						Memids:   []int64{10, -8},
+						Types:    []OSMPBF.Relation_MemberType{OSMPBF.Relation_WAY, OSMPBF.Relation_NODE},
+					},
+				},
+			},
+		},
+	}
+	blockData, err := block.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBlock(&buf, HeaderType, headerData, CompressionZlib); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBlock(&buf, DataType, blockData, c); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecoderCompressions(t *testing.T) {
+	for _, c := range []Compression{
+		CompressionNone,
+		CompressionZlib,
+		CompressionLZMA,
+		CompressionLZ4,
+		CompressionZstd,
+	} {
+		var got collector
+		if err := NewDecoder(bytes.NewReader(samplePBF(t, c))).Parse(&got); err != nil {
+			t.Errorf("%v: %v", c, err)
+			continue
+		}
+
+		if len(got.nodes) != 3 {
+			t.Fatalf("%v: got %d nodes, want 3", c, len(got.nodes))
+		}
+		if n := got.nodes[1]; n.ID != 2 || n.Tags["amenity"] != "cafe" || n.Lat != 25.000001 {
+			t.Errorf("%v: unexpected node %+v", c, n)
+		}
+		if len(got.ways) != 1 || !reflect.DeepEqual(got.ways[0].NodeIDs, []int64{1, 2, 3}) {
+			t.Errorf("%v: unexpected ways %+v", c, got.ways)
+		}
+		want := []gosmparse.RelationMember{
+			{ID: 10, Type: gosmparse.WayType, Role: "outer"},
+			{ID: 2, Type: gosmparse.NodeType, Role: ""},
+		}
+		if len(got.relations) != 1 || !reflect.DeepEqual(got.relations[0].Members, want) {
+			t.Errorf("%v: unexpected relations %+v", c, got.relations)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]Compression{
+		"":     CompressionNone,
+		"zlib": CompressionZlib,
+		"ZSTD": CompressionZstd,
+		"lz4":  CompressionLZ4,
+	} {
+		c, err := ParseCompression(name)
+		if err != nil || c != want {
+			t.Errorf("ParseCompression(%q) = %v, %v", name, c, err)
+		}
+	}
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Error("expected error for unknown compression")
+	}
+}
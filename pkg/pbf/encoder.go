@@ -0,0 +1,408 @@
+package pbf
+
+import (
+	"errors"
+	"github.com/thomersch/gosmparse"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultBlockSize is the number of elements written per data block.
+	DefaultBlockSize = 8000
+	// DefaultWritingProgram .
+	DefaultWritingProgram = "osm-parser"
+
+	// Coordinates are written in units of 100 nanodegrees.
+	granularity = 100
+)
+
+var errEncoderClosed = errors.New("pbf: write to closed encoder")
+
+// Encoder writes OSM PBF files. Each data block holds one primitive group of
+// a single element type, nodes are written as dense nodes.
+type Encoder struct {
+	// Compression of the data blocks, default zlib.
+	Compression Compression
+	// BlockSize is the max number of elements per data block.
+	BlockSize int
+
+	w             io.Writer
+	header        Header
+	headerWritten bool
+	closed        bool
+
+	kind      gosmparse.MemberType
+	nodes     []gosmparse.Node
+	ways      []gosmparse.Way
+	wayNodes  [][]gosmparse.Node
+	relations []gosmparse.Relation
+}
+
+// NewEncoder returns an encoder writing header and data to w.
+func NewEncoder(w io.Writer, header Header) *Encoder {
+	if header.WritingProgram == "" {
+		header.WritingProgram = DefaultWritingProgram
+	}
+	for _, feature := range []string{FeatureDenseNodes, FeatureOsmSchema} {
+		if !header.HasRequiredFeature(feature) {
+			header.RequiredFeatures = append([]string{feature}, header.RequiredFeatures...)
+		}
+	}
+	return &Encoder{
+		Compression: CompressionZlib,
+		BlockSize:   DefaultBlockSize,
+		w:           w,
+		header:      header,
+	}
+}
+
+// WriteNode .
+func (e *Encoder) WriteNode(n gosmparse.Node) error {
+	if err := e.prepare(gosmparse.NodeType); err != nil {
+		return err
+	}
+	e.nodes = append(e.nodes, n)
+	return e.flushFull(len(e.nodes))
+}
+
+// WriteWay .
+func (e *Encoder) WriteWay(w gosmparse.Way) error {
+	return e.WriteWayWithLocations(w, nil)
+}
+
+// WriteWayWithLocations writes a way carrying the locations of its nodes.
+func (e *Encoder) WriteWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) error {
+	if err := e.prepare(gosmparse.WayType); err != nil {
+		return err
+	}
+	e.ways = append(e.ways, w)
+	e.wayNodes = append(e.wayNodes, nodes)
+	return e.flushFull(len(e.ways))
+}
+
+// WriteRelation .
+func (e *Encoder) WriteRelation(r gosmparse.Relation) error {
+	if err := e.prepare(gosmparse.RelationType); err != nil {
+		return err
+	}
+	e.relations = append(e.relations, r)
+	return e.flushFull(len(e.relations))
+}
+
+// Close flushes buffered elements. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	err := e.flush()
+	e.closed = true
+	return err
+}
+
+// prepare writes the header and flushes a group of another element type.
+func (e *Encoder) prepare(kind gosmparse.MemberType) error {
+	if e.closed {
+		return errEncoderClosed
+	}
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	if kind != e.kind {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		e.kind = kind
+	}
+	return nil
+}
+
+func (e *Encoder) flushFull(n int) error {
+	blockSize := e.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	if n < blockSize {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *Encoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return WriteBlock(e.w, HeaderType, encodeHeader(&e.header), e.Compression)
+}
+
+// flush writes the buffered elements as one data block.
+func (e *Encoder) flush() error {
+	var (
+		st    stringTable
+		group protoWriter
+	)
+	switch {
+	case len(e.nodes) > 0:
+		group.message(groupDense, func(w *protoWriter) { encodeDenseNodes(w, &st, e.nodes) })
+	case len(e.ways) > 0:
+		for i, way := range e.ways {
+			way, nodes := way, e.wayNodes[i]
+			group.message(groupWays, func(w *protoWriter) { encodeWay(w, &st, way, nodes) })
+		}
+	case len(e.relations) > 0:
+		for _, rel := range e.relations {
+			rel := rel
+			group.message(groupRelations, func(w *protoWriter) { encodeRelation(w, &st, rel) })
+		}
+	default:
+		return nil
+	}
+	e.nodes = e.nodes[:0]
+	e.ways = e.ways[:0]
+	e.wayNodes = e.wayNodes[:0]
+	e.relations = e.relations[:0]
+
+	var block protoWriter
+	block.message(blockStringTable, func(w *protoWriter) {
+		for _, s := range st.strings() {
+			w.string(1, s)
+		}
+	})
+	block.bytes(blockGroup, group.buf)
+	block.varint(blockGranularity, granularity)
+	return WriteBlock(e.w, DataType, block.buf, e.Compression)
+}
+
+// stringTable collects the strings of one block, index 0 is reserved.
+type stringTable struct {
+	index map[string]uint64
+	table []string
+}
+
+func (st *stringTable) id(s string) uint64 {
+	if st.index == nil {
+		st.index = map[string]uint64{}
+		st.table = []string{""}
+	}
+	if i, ok := st.index[s]; ok {
+		return i
+	}
+	i := uint64(len(st.table))
+	st.index[s] = i
+	st.table = append(st.table, s)
+	return i
+}
+
+func (st *stringTable) strings() []string {
+	if st.table == nil {
+		return []string{""}
+	}
+	return st.table
+}
+
+// sortedKeys keeps output deterministic.
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func coordUnits(deg float64) int64 {
+	return int64(math.Round(deg * 1e9 / granularity))
+}
+
+func encodeTags(w *protoWriter, st *stringTable, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	keys := sortedKeys(tags)
+	keyIDs := make([]uint64, len(keys))
+	valIDs := make([]uint64, len(keys))
+	for i, k := range keys {
+		keyIDs[i] = st.id(k)
+		valIDs[i] = st.id(tags[k])
+	}
+	w.packedVarints(elementKeys, keyIDs)
+	w.packedVarints(elementVals, valIDs)
+}
+
+func encodeInfo(w *protoWriter, st *stringTable, info *gosmparse.Info) {
+	if info == nil {
+		return
+	}
+	w.message(elementInfo, func(w *protoWriter) {
+		w.varint(infoVersion, uint64(int64(info.Version)))
+		if !info.Timestamp.IsZero() {
+			w.varint(infoTimestamp, uint64(info.Timestamp.Unix()))
+		}
+		w.varint(infoChangeset, uint64(info.Changeset))
+		w.varint(infoUID, uint64(int64(info.UID)))
+		w.varint(infoUserSID, st.id(info.User))
+		if !info.Visible {
+			w.varint(infoVisible, 0)
+		}
+	})
+}
+
+func encodeDenseNodes(w *protoWriter, st *stringTable, nodes []gosmparse.Node) {
+	var (
+		ids, lats, lons = make([]int64, len(nodes)), make([]int64, len(nodes)), make([]int64, len(nodes))
+		keysVals        []uint64
+		tagged, info    bool
+		lastID, lastLat int64
+		lastLon         int64
+	)
+	for i, n := range nodes {
+		lat, lon := coordUnits(n.Lat), coordUnits(n.Lon)
+		ids[i], lats[i], lons[i] = n.ID-lastID, lat-lastLat, lon-lastLon
+		lastID, lastLat, lastLon = n.ID, lat, lon
+		if len(n.Tags) > 0 {
+			tagged = true
+		}
+		if n.Info != nil {
+			info = true
+		}
+	}
+	if tagged {
+		for _, n := range nodes {
+			for _, k := range sortedKeys(n.Tags) {
+				keysVals = append(keysVals, st.id(k), st.id(n.Tags[k]))
+			}
+			keysVals = append(keysVals, 0)
+		}
+	}
+
+	w.packedSint64s(denseID, ids)
+	if info {
+		w.message(denseInfo, func(w *protoWriter) { encodeDenseInfo(w, st, nodes) })
+	}
+	w.packedSint64s(denseLat, lats)
+	w.packedSint64s(denseLon, lons)
+	w.packedVarints(denseKeysVals, keysVals)
+}
+
+func encodeDenseInfo(w *protoWriter, st *stringTable, nodes []gosmparse.Node) {
+	var (
+		versions, visible                     = make([]uint64, len(nodes)), make([]uint64, len(nodes))
+		timestamps, changesets, uids, userSID = make([]int64, len(nodes)), make([]int64, len(nodes)), make([]int64, len(nodes)), make([]int64, len(nodes))
+		lastTime, lastChangeset               int64
+		lastUID, lastUser                     int64
+		hidden                                bool
+	)
+	for i, n := range nodes {
+		info := n.Info
+		if info == nil {
+			info = &gosmparse.Info{Version: -1, Visible: true}
+		}
+		t, user := info.Timestamp.Unix(), int64(st.id(info.User))
+		if info.Timestamp.IsZero() {
+			t = 0
+		}
+		versions[i] = uint64(int64(info.Version))
+		timestamps[i], lastTime = t-lastTime, t
+		changesets[i], lastChangeset = info.Changeset-lastChangeset, info.Changeset
+		uids[i], lastUID = int64(info.UID)-lastUID, int64(info.UID)
+		userSID[i], lastUser = user-lastUser, user
+		if info.Visible {
+			visible[i] = 1
+		} else {
+			hidden = true
+		}
+	}
+	w.packedVarints(infoVersion, versions)
+	w.packedSint64s(infoTimestamp, timestamps)
+	w.packedSint64s(infoChangeset, changesets)
+	w.packedSint64s(infoUID, uids)
+	w.packedSint64s(infoUserSID, userSID)
+	if hidden {
+		w.packedVarints(infoVisible, visible)
+	}
+}
+
+func encodeWay(w *protoWriter, st *stringTable, way gosmparse.Way, nodes []gosmparse.Node) {
+	w.varint(elementID, uint64(way.ID))
+	encodeTags(w, st, way.Tags)
+	encodeInfo(w, st, way.Info)
+
+	refs := make([]int64, len(way.NodeIDs))
+	var last int64
+	for i, id := range way.NodeIDs {
+		refs[i], last = id-last, id
+	}
+	w.packedSint64s(wayRefs, refs)
+
+	if len(nodes) == 0 || len(nodes) != len(way.NodeIDs) {
+		return
+	}
+	lats, lons := make([]int64, len(nodes)), make([]int64, len(nodes))
+	var lastLat, lastLon int64
+	for i, n := range nodes {
+		lat, lon := coordUnits(n.Lat), coordUnits(n.Lon)
+		lats[i], lons[i] = lat-lastLat, lon-lastLon
+		lastLat, lastLon = lat, lon
+	}
+	w.packedSint64s(wayLat, lats)
+	w.packedSint64s(wayLon, lons)
+}
+
+func encodeRelation(w *protoWriter, st *stringTable, rel gosmparse.Relation) {
+	w.varint(elementID, uint64(rel.ID))
+	encodeTags(w, st, rel.Tags)
+	encodeInfo(w, st, rel.Info)
+
+	roles := make([]uint64, len(rel.Members))
+	memIDs := make([]int64, len(rel.Members))
+	types := make([]uint64, len(rel.Members))
+	var last int64
+	for i, m := range rel.Members {
+		roles[i] = st.id(m.Role)
+		memIDs[i], last = m.ID-last, m.ID
+		types[i] = uint64(m.Type)
+	}
+	w.packedVarints(relationRoles, roles)
+	w.packedSint64s(relationMemberID, memIDs)
+	w.packedVarints(relationTypes, types)
+}
+
+// encodeHeader builds a HeaderBlock message.
+func encodeHeader(h *Header) []byte {
+	var w protoWriter
+	if h.BBox != nil {
+		w.message(headerBBox, func(w *protoWriter) {
+			w.sint64(1, int64(math.Round(h.BBox.Left*1e9)))
+			w.sint64(2, int64(math.Round(h.BBox.Right*1e9)))
+			w.sint64(3, int64(math.Round(h.BBox.Top*1e9)))
+			w.sint64(4, int64(math.Round(h.BBox.Bottom*1e9)))
+		})
+	}
+	for _, feature := range h.RequiredFeatures {
+		w.string(headerRequiredFeatures, feature)
+	}
+	for _, feature := range h.OptionalFeatures {
+		w.string(headerOptionalFeatures, feature)
+	}
+	if h.WritingProgram != "" {
+		w.string(headerWritingProgram, h.WritingProgram)
+	}
+	if h.Source != "" {
+		w.string(headerSource, h.Source)
+	}
+	if !h.ReplicationTimestamp.IsZero() {
+		w.varint(headerReplicationTime, uint64(h.ReplicationTimestamp.Unix()))
+	}
+	if h.ReplicationSequenceNumber != 0 {
+		w.varint(headerReplicationSequence, uint64(h.ReplicationSequenceNumber))
+	}
+	if h.ReplicationBaseURL != "" {
+		w.string(headerReplicationBaseURL, h.ReplicationBaseURL)
+	}
+	return w.buf
+}
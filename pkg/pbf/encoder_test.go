@@ -0,0 +1,108 @@
+package pbf
+
+import (
+	"bytes"
+	"github.com/thomersch/gosmparse"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type locatedCollector struct {
+	collector
+	located [][]gosmparse.Node
+}
+
+func (c *locatedCollector) ReadWayWithLocations(w gosmparse.Way, nodes []gosmparse.Node) {
+	c.ways = append(c.ways, w)
+	c.located = append(c.located, nodes)
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	nodes := []gosmparse.Node{
+		{Element: gosmparse.Element{ID: 1, Tags: map[string]string{"amenity": "cafe"}}, Lat: 25.0, Lon: 121.5},
+		{Element: gosmparse.Element{ID: 2, Tags: map[string]string{}}, Lat: 25.0000001, Lon: 121.5000001},
+	}
+	way := gosmparse.Way{
+		Element: gosmparse.Element{ID: 10, Tags: map[string]string{"highway": "path"}},
+		NodeIDs: []int64{1, 2},
+	}
+	relation := gosmparse.Relation{
+		Element: gosmparse.Element{ID: 100, Tags: map[string]string{"type": "route"}},
+		Members: []gosmparse.RelationMember{
+			{ID: 10, Type: gosmparse.WayType, Role: "outer"},
+			{ID: 2, Type: gosmparse.NodeType},
+		},
+	}
+
+	for _, c := range []Compression{CompressionNone, CompressionZlib, CompressionZstd} {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf, Header{OptionalFeatures: []string{FeatureLocationsOnWays}})
+		encoder.Compression = c
+		encoder.BlockSize = 1
+		for _, n := range nodes {
+			if err := encoder.WriteNode(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := encoder.WriteWayWithLocations(way, nodes); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.WriteRelation(relation); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		decoder := NewDecoder(bytes.NewReader(buf.Bytes()))
+		header, err := decoder.Header()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !header.HasRequiredFeature(FeatureDenseNodes) || !header.HasOptionalFeature(FeatureLocationsOnWays) {
+			t.Errorf("%s: unexpected header %+v", c, header)
+		}
+		got := &locatedCollector{}
+		if err := decoder.Parse(got); err != nil {
+			t.Fatalf("%s: %v", c, err)
+		}
+		if !sameNodes(got.nodes, nodes) {
+			t.Errorf("%s: nodes %+v, want %+v", c, got.nodes, nodes)
+		}
+		if len(got.ways) != 1 || !reflect.DeepEqual(got.ways[0], way) {
+			t.Errorf("%s: ways %+v, want %+v", c, got.ways, way)
+		}
+		if len(got.located) != 1 || !sameLocations(got.located[0], nodes) {
+			t.Errorf("%s: way locations %+v", c, got.located)
+		}
+		if len(got.relations) != 1 || !reflect.DeepEqual(got.relations[0], relation) {
+			t.Errorf("%s: relations %+v, want %+v", c, got.relations, relation)
+		}
+	}
+}
+
+// sameLocations compares node ids and coordinates at nanodegree precision.
+func sameLocations(a, b []gosmparse.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || math.Abs(a[i].Lat-b[i].Lat) > 1e-9 || math.Abs(a[i].Lon-b[i].Lon) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func sameNodes(a, b []gosmparse.Node) bool {
+	if !sameLocations(a, b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i].Element, b[i].Element) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package pbf
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Well known header features.
+const (
+	FeatureOsmSchema             = "OsmSchema-V0.6"
+	FeatureDenseNodes            = "DenseNodes"
+	FeatureHistoricalInformation = "HistoricalInformation"
+	FeatureLocationsOnWays       = "LocationsOnWays"
+	FeatureSortTypeThenID        = "Sort.Type_then_ID"
+)
+
+// HeaderBlock fields.
+const (
+	headerBBox                = 1
+	headerRequiredFeatures    = 4
+	headerOptionalFeatures    = 5
+	headerWritingProgram      = 16
+	headerSource              = 17
+	headerReplicationTime     = 32
+	headerReplicationSequence = 33
+	headerReplicationBaseURL  = 34
+)
+
+// BBox is a bounding box in degrees.
+type BBox struct {
+	Left   float64
+	Right  float64
+	Top    float64
+	Bottom float64
+}
+
+// String .
+func (b BBox) String() string {
+	return fmt.Sprintf("(%.7f,%.7f,%.7f,%.7f)", b.Left, b.Bottom, b.Right, b.Top)
+}
+
+// Header is the OSMHeader block of a PBF file.
+type Header struct {
+	BBox                      *BBox
+	RequiredFeatures          []string
+	OptionalFeatures          []string
+	WritingProgram            string
+	Source                    string
+	ReplicationTimestamp      time.Time
+	ReplicationSequenceNumber int64
+	ReplicationBaseURL        string
+}
+
+// HasRequiredFeature .
+func (h *Header) HasRequiredFeature(feature string) bool {
+	return contains(h.RequiredFeatures, feature)
+}
+
+// HasOptionalFeature .
+func (h *Header) HasOptionalFeature(feature string) bool {
+	return contains(h.OptionalFeatures, feature)
+}
+
+// UnsupportedFeatures returns the required features missing from supported.
+func (h *Header) UnsupportedFeatures(supported ...string) []string {
+	var unsupported []string
+	for _, feature := range h.RequiredFeatures {
+		if !contains(supported, feature) {
+			unsupported = append(unsupported, feature)
+		}
+	}
+	return unsupported
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadHeader reads the header block at the start of a PBF stream.
+func ReadHeader(r io.Reader) (*Header, error) {
+	block, err := readRawBlock(r)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != HeaderType {
+		return nil, fmt.Errorf("Invalid header of first data block. Wanted: %s, have: %s", HeaderType, block.Type)
+	}
+	data, _, err := decodeBlob(block.Blob)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHeader(data)
+}
+
+func decodeHeader(data []byte) (*Header, error) {
+	h := &Header{}
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return h, nil
+		}
+		switch field {
+		case headerBBox:
+			b, err := pr.bytes()
+			if err != nil {
+				return nil, err
+			}
+			if h.BBox, err = decodeBBox(b); err != nil {
+				return nil, err
+			}
+		case headerRequiredFeatures, headerOptionalFeatures, headerWritingProgram, headerSource, headerReplicationBaseURL:
+			b, err := pr.bytes()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case headerRequiredFeatures:
+				h.RequiredFeatures = append(h.RequiredFeatures, string(b))
+			case headerOptionalFeatures:
+				h.OptionalFeatures = append(h.OptionalFeatures, string(b))
+			case headerWritingProgram:
+				h.WritingProgram = string(b)
+			case headerSource:
+				h.Source = string(b)
+			case headerReplicationBaseURL:
+				h.ReplicationBaseURL = string(b)
+			}
+		case headerReplicationTime:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			h.ReplicationTimestamp = time.Unix(int64(v), 0).UTC()
+		case headerReplicationSequence:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			h.ReplicationSequenceNumber = int64(v)
+		default:
+			if err := pr.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// HeaderBBox is stored in nanodegrees, independent of granularity.
+func decodeBBox(data []byte) (*BBox, error) {
+	var nano [5]int64
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if field < 1 || field > 4 {
+			if err := pr.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if nano[field], err = pr.sint64(); err != nil {
+			return nil, err
+		}
+	}
+	return &BBox{
+		Left:   float64(nano[1]) / 1e9,
+		Right:  float64(nano[2]) / 1e9,
+		Top:    float64(nano[3]) / 1e9,
+		Bottom: float64(nano[4]) / 1e9,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package pbf
+
+import (
+	"bytes"
+	"github.com/thomersch/gosmparse/OSMPBF"
+	"testing"
+	"time"
+)
+
+func TestReadHeader(t *testing.T) {
+	block := &OSMPBF.HeaderBlock{
+		Bbox: &OSMPBF.HeaderBBox{
+			Left:   120000000000,
+			Right:  122000000000,
+			Top:    25500000000,
+			Bottom: -1000000000,
+		},
+		RequiredFeatures:                 []string{FeatureOsmSchema, FeatureDenseNodes, FeatureHistoricalInformation},
+		OptionalFeatures:                 []string{FeatureSortTypeThenID},
+		Writingprogram:                   "osmium/1.10.0",
+		OsmosisReplicationTimestamp:      1577836800,
+		OsmosisReplicationSequenceNumber: 2456,
+		OsmosisReplicationBaseUrl:        "https://planet.openstreetmap.org/replication/day",
+	}
+	data, err := block.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteBlock(&buf, HeaderType, data, CompressionZstd); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *h.BBox != (BBox{Left: 120, Right: 122, Top: 25.5, Bottom: -1}) {
+		t.Errorf("unexpected bbox %v", h.BBox)
+	}
+	if !h.ReplicationTimestamp.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected replication timestamp %v", h.ReplicationTimestamp)
+	}
+	if h.ReplicationSequenceNumber != 2456 || h.WritingProgram != "osmium/1.10.0" {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if !h.HasOptionalFeature(FeatureSortTypeThenID) {
+		t.Error("missing optional feature")
+	}
+	unsupported := h.UnsupportedFeatures(FeatureOsmSchema, FeatureDenseNodes)
+	if len(unsupported) != 1 || unsupported[0] != FeatureHistoricalInformation {
+		t.Errorf("unexpected unsupported features %v", unsupported)
+	}
+}
@@ -0,0 +1,640 @@
+package pbf
+
+import (
+	"fmt"
+	"github.com/thomersch/gosmparse"
+	"time"
+)
+
+// PrimitiveBlock fields.
+const (
+	blockStringTable     = 1
+	blockGroup           = 2
+	blockGranularity     = 17
+	blockDateGranularity = 18
+	blockLatOffset       = 19
+	blockLonOffset       = 20
+)
+
+// PrimitiveGroup fields.
+const (
+	groupNodes      = 1
+	groupDense      = 2
+	groupWays       = 3
+	groupRelations  = 4
+	groupChangesets = 5
+)
+
+// Element fields shared by Node, Way and Relation.
+const (
+	elementID   = 1
+	elementKeys = 2
+	elementVals = 3
+	elementInfo = 4
+)
+
+// Node, Way, Relation and DenseNodes fields.
+const (
+	nodeLat          = 8
+	nodeLon          = 9
+	wayRefs          = 8
+	wayLat           = 9
+	wayLon           = 10
+	relationRoles    = 8
+	relationMemberID = 9
+	relationTypes    = 10
+	denseID          = 1
+	denseInfo        = 5
+	denseLat         = 8
+	denseLon         = 9
+	denseKeysVals    = 10
+)
+
+// Info and DenseInfo fields.
+const (
+	infoVersion   = 1
+	infoTimestamp = 2
+	infoChangeset = 3
+	infoUID       = 4
+	infoUserSID   = 5
+	infoVisible   = 6
+)
+
+// primitiveGroup holds the decoded elements of one group, in file order.
+type primitiveGroup struct {
+	nodes []gosmparse.Node
+	ways  []gosmparse.Way
+	// wayNodes holds the located nodes of each way, nil unless LocationsOnWays.
+	wayNodes  [][]gosmparse.Node
+	relations []gosmparse.Relation
+}
+
+// primitiveBlock is the decoding state of one OSMData block.
+type primitiveBlock struct {
+	strings         []string
+	granularity     int64
+	dateGranularity int64
+	latOffset       int64
+	lonOffset       int64
+	withInfo        bool
+}
+
+// decodePrimitiveBlock decodes an uncompressed OSMData block.
+func decodePrimitiveBlock(data []byte, withInfo bool) ([]primitiveGroup, error) {
+	pb := primitiveBlock{
+		granularity:     100,
+		dateGranularity: 1000,
+		withInfo:        withInfo,
+	}
+
+	// Groups depend on the string table and offsets, which may come after them.
+	var rawGroups [][]byte
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case blockStringTable:
+			b, err := pr.bytes()
+			if err != nil {
+				return nil, err
+			}
+			if pb.strings, err = decodeStringTable(b); err != nil {
+				return nil, err
+			}
+		case blockGroup:
+			b, err := pr.bytes()
+			if err != nil {
+				return nil, err
+			}
+			rawGroups = append(rawGroups, b)
+		case blockGranularity:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			pb.granularity = int64(v)
+		case blockDateGranularity:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			pb.dateGranularity = int64(v)
+		case blockLatOffset:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			pb.latOffset = int64(v)
+		case blockLonOffset:
+			v, err := pr.varint()
+			if err != nil {
+				return nil, err
+			}
+			pb.lonOffset = int64(v)
+		default:
+			if err := pr.skip(wire); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	groups := make([]primitiveGroup, 0, len(rawGroups))
+	for _, raw := range rawGroups {
+		g, err := pb.decodeGroup(raw)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func decodeStringTable(data []byte) ([]string, error) {
+	var st []string
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return st, nil
+		}
+		if field != 1 {
+			if err := pr.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b, err := pr.bytes()
+		if err != nil {
+			return nil, err
+		}
+		st = append(st, string(b))
+	}
+}
+
+func (pb *primitiveBlock) decodeGroup(data []byte) (primitiveGroup, error) {
+	var g primitiveGroup
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return g, err
+		}
+		if !ok {
+			return g, nil
+		}
+		switch field {
+		case groupNodes:
+			b, err := pr.bytes()
+			if err != nil {
+				return g, err
+			}
+			n, err := pb.decodeNode(b)
+			if err != nil {
+				return g, err
+			}
+			g.nodes = append(g.nodes, n)
+		case groupDense:
+			b, err := pr.bytes()
+			if err != nil {
+				return g, err
+			}
+			if g.nodes, err = pb.decodeDenseNodes(b, g.nodes); err != nil {
+				return g, err
+			}
+		case groupWays:
+			b, err := pr.bytes()
+			if err != nil {
+				return g, err
+			}
+			w, nodes, err := pb.decodeWay(b)
+			if err != nil {
+				return g, err
+			}
+			g.ways = append(g.ways, w)
+			g.wayNodes = append(g.wayNodes, nodes)
+		case groupRelations:
+			b, err := pr.bytes()
+			if err != nil {
+				return g, err
+			}
+			r, err := pb.decodeRelation(b)
+			if err != nil {
+				return g, err
+			}
+			g.relations = append(g.relations, r)
+		default:
+			// Changesets carry no data we use.
+			if err := pr.skip(wire); err != nil {
+				return g, err
+			}
+		}
+	}
+}
+
+func (pb *primitiveBlock) str(i uint64) (string, error) {
+	if i >= uint64(len(pb.strings)) {
+		return "", fmt.Errorf("pbf: string index %d out of range", i)
+	}
+	return pb.strings[i], nil
+}
+
+func (pb *primitiveBlock) tags(keys, vals []uint64) (map[string]string, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("pbf: %d keys but %d values", len(keys), len(vals))
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		k, err := pb.str(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := pb.str(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (pb *primitiveBlock) coord(offset, v int64) float64 {
+	return 1e-9 * float64(offset+pb.granularity*v)
+}
+
+func (pb *primitiveBlock) timestamp(v int64) time.Time {
+	return time.Unix(v*pb.dateGranularity/1000, 0)
+}
+
+// element decodes the fields shared by all element types, handing
+// anything else to fn.
+func (pb *primitiveBlock) element(data []byte, e *gosmparse.Element, signedID bool, fn func(pr *protoReader, field, wire int) error) error {
+	var keys, vals []uint64
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case elementID:
+			v, err := pr.varint()
+			if err != nil {
+				return err
+			}
+			if signedID {
+				e.ID = zigzag(v)
+			} else {
+				e.ID = int64(v)
+			}
+		case elementKeys:
+			if keys, err = pr.varints(wire, keys); err != nil {
+				return err
+			}
+		case elementVals:
+			if vals, err = pr.varints(wire, vals); err != nil {
+				return err
+			}
+		case elementInfo:
+			b, err := pr.bytes()
+			if err != nil {
+				return err
+			}
+			if pb.withInfo {
+				if e.Info, err = pb.decodeInfo(b); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := fn(pr, field, wire); err != nil {
+				return err
+			}
+		}
+	}
+	tags, err := pb.tags(keys, vals)
+	if err != nil {
+		return err
+	}
+	e.Tags = tags
+	return nil
+}
+
+func (pb *primitiveBlock) decodeInfo(data []byte) (*gosmparse.Info, error) {
+	info := &gosmparse.Info{Version: -1, Visible: true}
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return info, nil
+		}
+		if wire != wireVarint {
+			if err := pr.skip(wire); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v, err := pr.varint()
+		if err != nil {
+			return nil, err
+		}
+		switch field {
+		case infoVersion:
+			info.Version = int(int32(v))
+		case infoTimestamp:
+			info.Timestamp = pb.timestamp(int64(v))
+		case infoChangeset:
+			info.Changeset = int64(v)
+		case infoUID:
+			info.UID = int(int32(v))
+		case infoUserSID:
+			if info.User, err = pb.str(v); err != nil {
+				return nil, err
+			}
+		case infoVisible:
+			info.Visible = v != 0
+		}
+	}
+}
+
+func (pb *primitiveBlock) decodeNode(data []byte) (gosmparse.Node, error) {
+	var (
+		n        gosmparse.Node
+		lat, lon int64
+	)
+	err := pb.element(data, &n.Element, true, func(pr *protoReader, field, wire int) error {
+		var err error
+		switch field {
+		case nodeLat:
+			lat, err = pr.sint64()
+		case nodeLon:
+			lon, err = pr.sint64()
+		default:
+			err = pr.skip(wire)
+		}
+		return err
+	})
+	n.Lat = pb.coord(pb.latOffset, lat)
+	n.Lon = pb.coord(pb.lonOffset, lon)
+	return n, err
+}
+
+func (pb *primitiveBlock) decodeDenseNodes(data []byte, nodes []gosmparse.Node) ([]gosmparse.Node, error) {
+	var (
+		ids, lats, lons []int64
+		keysVals        []uint64
+		info            []byte
+	)
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nodes, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case denseID:
+			ids, err = pr.sint64s(wire, ids)
+		case denseLat:
+			lats, err = pr.sint64s(wire, lats)
+		case denseLon:
+			lons, err = pr.sint64s(wire, lons)
+		case denseKeysVals:
+			keysVals, err = pr.varints(wire, keysVals)
+		case denseInfo:
+			info, err = pr.bytes()
+		default:
+			err = pr.skip(wire)
+		}
+		if err != nil {
+			return nodes, err
+		}
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return nodes, fmt.Errorf("pbf: dense nodes have %d ids, %d lats, %d lons", len(ids), len(lats), len(lons))
+	}
+
+	var infos []*gosmparse.Info
+	if pb.withInfo && info != nil {
+		var err error
+		if infos, err = pb.decodeDenseInfo(info, len(ids)); err != nil {
+			return nodes, err
+		}
+	}
+
+	var id, lat, lon int64
+	kv := 0
+	for i := range ids {
+		id += ids[i]
+		lat += lats[i]
+		lon += lons[i]
+		n := gosmparse.Node{
+			Lat: pb.coord(pb.latOffset, lat),
+			Lon: pb.coord(pb.lonOffset, lon),
+		}
+		n.ID = id
+		n.Tags = map[string]string{}
+		for kv < len(keysVals) {
+			if keysVals[kv] == 0 {
+				kv++
+				break
+			}
+			if kv+1 >= len(keysVals) {
+				return nodes, fmt.Errorf("pbf: dense node %d has a key without value", id)
+			}
+			k, err := pb.str(keysVals[kv])
+			if err != nil {
+				return nodes, err
+			}
+			v, err := pb.str(keysVals[kv+1])
+			if err != nil {
+				return nodes, err
+			}
+			n.Tags[k] = v
+			kv += 2
+		}
+		if infos != nil {
+			n.Info = infos[i]
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func (pb *primitiveBlock) decodeDenseInfo(data []byte, count int) ([]*gosmparse.Info, error) {
+	var (
+		versions                              []uint64
+		timestamps, changesets, uids, userSID []int64
+		visible                               []uint64
+	)
+	pr := newProtoReader(data)
+	for {
+		field, wire, ok, err := pr.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		switch field {
+		case infoVersion:
+			versions, err = pr.varints(wire, versions)
+		case infoTimestamp:
+			timestamps, err = pr.sint64s(wire, timestamps)
+		case infoChangeset:
+			changesets, err = pr.sint64s(wire, changesets)
+		case infoUID:
+			uids, err = pr.sint64s(wire, uids)
+		case infoUserSID:
+			userSID, err = pr.sint64s(wire, userSID)
+		case infoVisible:
+			visible, err = pr.varints(wire, visible)
+		default:
+			err = pr.skip(wire)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	infos := make([]*gosmparse.Info, count)
+	var timestamp, changeset, uid, user int64
+	for i := range infos {
+		info := &gosmparse.Info{Version: -1, Visible: true}
+		if i < len(versions) {
+			info.Version = int(int32(versions[i]))
+		}
+		if i < len(timestamps) {
+			timestamp += timestamps[i]
+			info.Timestamp = pb.timestamp(timestamp)
+		}
+		if i < len(changesets) {
+			changeset += changesets[i]
+			info.Changeset = changeset
+		}
+		if i < len(uids) {
+			uid += uids[i]
+			info.UID = int(uid)
+		}
+		if i < len(userSID) {
+			user += userSID[i]
+			s, err := pb.str(uint64(user))
+			if err != nil {
+				return nil, err
+			}
+			info.User = s
+		}
+		if i < len(visible) {
+			info.Visible = visible[i] != 0
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+// decodeWay also returns the nodes located by the way's own lat/lon
+// arrays, which only LocationsOnWays files carry.
+func (pb *primitiveBlock) decodeWay(data []byte) (gosmparse.Way, []gosmparse.Node, error) {
+	var (
+		w                gosmparse.Way
+		refs, lats, lons []int64
+	)
+	err := pb.element(data, &w.Element, false, func(pr *protoReader, field, wire int) error {
+		var err error
+		switch field {
+		case wayRefs:
+			refs, err = pr.sint64s(wire, refs)
+		case wayLat:
+			lats, err = pr.sint64s(wire, lats)
+		case wayLon:
+			lons, err = pr.sint64s(wire, lons)
+		default:
+			err = pr.skip(wire)
+		}
+		return err
+	})
+	if err != nil {
+		return w, nil, err
+	}
+	w.NodeIDs = make([]int64, len(refs))
+	var id int64
+	for i, ref := range refs {
+		id += ref
+		w.NodeIDs[i] = id
+	}
+	if len(lats) == 0 || len(lats) != len(refs) || len(lons) != len(refs) {
+		return w, nil, nil
+	}
+
+	nodes := make([]gosmparse.Node, len(refs))
+	var lat, lon int64
+	for i := range refs {
+		lat += lats[i]
+		lon += lons[i]
+		nodes[i].ID = w.NodeIDs[i]
+		nodes[i].Lat = pb.coord(pb.latOffset, lat)
+		nodes[i].Lon = pb.coord(pb.lonOffset, lon)
+	}
+	return w, nodes, nil
+}
+
+func (pb *primitiveBlock) decodeRelation(data []byte) (gosmparse.Relation, error) {
+	var (
+		r            gosmparse.Relation
+		roles, types []uint64
+		memberIDs    []int64
+	)
+	err := pb.element(data, &r.Element, false, func(pr *protoReader, field, wire int) error {
+		var err error
+		switch field {
+		case relationRoles:
+			roles, err = pr.varints(wire, roles)
+		case relationMemberID:
+			memberIDs, err = pr.sint64s(wire, memberIDs)
+		case relationTypes:
+			types, err = pr.varints(wire, types)
+		default:
+			err = pr.skip(wire)
+		}
+		return err
+	})
+	if err != nil {
+		return r, err
+	}
+	if len(roles) != len(memberIDs) || len(types) != len(memberIDs) {
+		return r, fmt.Errorf("pbf: relation %d has mismatched member arrays", r.ID)
+	}
+	r.Members = make([]gosmparse.RelationMember, len(memberIDs))
+	var id int64
+	for i := range memberIDs {
+		id += memberIDs[i]
+		role, err := pb.str(roles[i])
+		if err != nil {
+			return r, err
+		}
+		if types[i] > uint64(gosmparse.RelationType) {
+			return r, fmt.Errorf("pbf: relation %d has unknown member type %d", r.ID, types[i])
+		}
+		r.Members[i] = gosmparse.RelationMember{
+			ID:   id,
+			Type: gosmparse.MemberType(types[i]),
+			Role: role,
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,198 @@
+package pbf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protobuf wire types used by the OSM PBF schema.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("pbf: truncated protobuf message")
+
+// protoReader iterates over the fields of one protobuf message.
+type protoReader struct {
+	buf []byte
+	pos int
+}
+
+func newProtoReader(buf []byte) *protoReader {
+	return &protoReader{buf: buf}
+}
+
+// next reads the next field key, returns false at end of message.
+func (r *protoReader) next() (int, int, bool, error) {
+	if r.pos >= len(r.buf) {
+		return 0, 0, false, nil
+	}
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return int(key >> 3), int(key & 7), true, nil
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *protoReader) sint64() (int64, error) {
+	v, err := r.varint()
+	return zigzag(v), err
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	l, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	end := r.pos + int(l)
+	if l > uint64(len(r.buf)) || end > len(r.buf) {
+		return nil, errTruncated
+	}
+	b := r.buf[r.pos:end]
+	r.pos = end
+	return b, nil
+}
+
+func (r *protoReader) skip(wire int) error {
+	switch wire {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireFixed64:
+		r.pos += 8
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wireFixed32:
+		r.pos += 4
+	default:
+		return fmt.Errorf("pbf: unsupported wire type %d", wire)
+	}
+	if r.pos > len(r.buf) {
+		return errTruncated
+	}
+	return nil
+}
+
+// varints reads a repeated varint field, packed or not.
+func (r *protoReader) varints(wire int, dst []uint64) ([]uint64, error) {
+	if wire == wireVarint {
+		v, err := r.varint()
+		return append(dst, v), err
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return dst, err
+	}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return dst, errTruncated
+		}
+		dst = append(dst, v)
+		b = b[n:]
+	}
+	return dst, nil
+}
+
+func (r *protoReader) sint64s(wire int, dst []int64) ([]int64, error) {
+	vals, err := r.varints(wire, nil)
+	for _, v := range vals {
+		dst = append(dst, zigzag(v))
+	}
+	return dst, err
+}
+
+func (r *protoReader) int64s(wire int, dst []int64) ([]int64, error) {
+	vals, err := r.varints(wire, nil)
+	for _, v := range vals {
+		dst = append(dst, int64(v))
+	}
+	return dst, err
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func unzigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// protoWriter builds one protobuf message.
+type protoWriter struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *protoWriter) key(field, wire int) {
+	w.rawVarint(uint64(field)<<3 | uint64(wire))
+}
+
+func (w *protoWriter) rawVarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.buf = append(w.buf, w.scratch[:n]...)
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	w.key(field, wireVarint)
+	w.rawVarint(v)
+}
+
+func (w *protoWriter) sint64(field int, v int64) {
+	w.varint(field, unzigzag(v))
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.key(field, wireBytes)
+	w.rawVarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.key(field, wireBytes)
+	w.rawVarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// message writes a nested message built by fn.
+func (w *protoWriter) message(field int, fn func(w *protoWriter)) {
+	var nested protoWriter
+	fn(&nested)
+	w.bytes(field, nested.buf)
+}
+
+func (w *protoWriter) packedVarints(field int, vals []uint64) {
+	if len(vals) == 0 {
+		return
+	}
+	var packed protoWriter
+	for _, v := range vals {
+		packed.rawVarint(v)
+	}
+	w.bytes(field, packed.buf)
+}
+
+func (w *protoWriter) packedSint64s(field int, vals []int64) {
+	if len(vals) == 0 {
+		return
+	}
+	var packed protoWriter
+	for _, v := range vals {
+		packed.rawVarint(unzigzag(v))
+	}
+	w.bytes(field, packed.buf)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var renumberCmd = &cobra.Command{
+	Use:   "renumber [input file|-]",
+	Short: "Renumber the ids of each type from 1, references included, writing the old to new id mapping.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRenumber,
+}
+
+func init() {
+	addPBFWriterFlags(renumberCmd)
+	addCacheFlags(renumberCmd)
+	renumberCmd.Flags().String("mapping", "", "Output csv of type,old_id,new_id.")
+}
+
+func runRenumber(cmd *cobra.Command, args []string) error {
+	if viper.GetString("output") == "" {
+		return errors.New("missing --output")
+	}
+	if viper.GetString("mapping") == "" {
+		return errors.New("missing --mapping")
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	for _, err := range []error{
+		c.Provide(
+			func() string { return viper.GetString("mapping") },
+			dig.Name("mappingFile"),
+		),
+		c.Provide(osm.NewPBFRenumberer),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return c.Invoke(func(renumberer osm.PBFDataParser) error {
+		return renumberer.Run()
+	})
+}
+
+// renumberSource renumbers source to a temp pbf under --level_db_path, for
+// commands with --renumber. Call remove once done.
+func renumberSource(source osm.Source, mappingFile string) (renumbered osm.Source, remove func(), err error) {
+	levelDBPath := viper.GetString("level_db_path")
+	if err := os.MkdirAll(levelDBPath, 0755); err != nil {
+		return nil, nil, err
+	}
+	dir, err := ioutil.TempDir(levelDBPath, "renumbered")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove = func() { os.RemoveAll(dir) }
+	renumberer := &osm.PBFRenumberer{
+		Source:      source,
+		OutputFile:  filepath.Join(dir, "renumbered.osm.pbf"),
+		Compression: "none",
+		MappingFile: mappingFile,
+		LevelDBPath: dir,
+		BatchSize:   viper.GetInt("batch_size"),
+	}
+	if err := renumberer.Run(); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return osm.FileSource(renumberer.OutputFile), remove, nil
+}
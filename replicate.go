@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "Keep the cache of geojson --updatable_cache current with replication diffs, write the changed features as GeoJSON.",
+	Args:  cobra.NoArgs,
+	RunE:  runReplicate,
+}
+
+func init() {
+	replicateCmd.Flags().String("replication_url", "", "Replication directory, local path or url, ex https://planet.openstreetmap.org/replication/minute.")
+	replicateCmd.Flags().String("state_file", "state.txt", "Checkpoint of the last applied sequence, created from the replication state if missing.")
+	replicateCmd.Flags().Duration("interval", time.Minute, "Poll interval, 0 exits once up to date.")
+	replicateCmd.Flags().StringP("output", "o", "", "Output directory, one <sequence>.geojson per diff (default stdout, one FeatureCollection per line).")
+	replicateCmd.Flags().String("level_db_path", "/tmp/osmparser", "LevelDB cache directory.")
+	addGeoJSONFlags(replicateCmd)
+}
+
+func runReplicate(cmd *cobra.Command, args []string) error {
+	if viper.GetString("replication_url") == "" {
+		return errors.New("missing --replication_url")
+	}
+
+	c := dig.New()
+	providers := []struct {
+		constructor interface{}
+		name        string
+	}{
+		{func() string { return viper.GetString("replication_url") }, "replicationURL"},
+		{func() string { return viper.GetString("state_file") }, "stateFile"},
+		{func() string { return viper.GetString("level_db_path") }, "levelDBPath"},
+		{func() time.Duration { return viper.GetDuration("interval") }, "interval"},
+		{func() osm.ReplicationSink { return writeReplicationSink(viper.GetString("output")) }, "replicationSink"},
+	}
+	for _, p := range providers {
+		if err := c.Provide(p.constructor, dig.Name(p.name)); err != nil {
+			return err
+		}
+	}
+	if err := c.Provide(osm.NewReplicator); err != nil {
+		return err
+	}
+	return c.Invoke(func(replicator *osm.Replicator) error {
+		return replicator.Run()
+	})
+}
+
+// writeReplicationSink writes the changes of each sequence as a
+// FeatureCollection, to stdout if dir is empty.
+func writeReplicationSink(dir string) osm.ReplicationSink {
+	return func(sequence int64, emts <-chan element.Element) error {
+		if dir == "" {
+			return writeFeatureCollection(os.Stdout, emts)
+		}
+		f, err := os.Create(filepath.Join(dir, strconv.FormatInt(sequence, 10)+".geojson"))
+		if err != nil {
+			for range emts {
+			}
+			return err
+		}
+		defer f.Close()
+		if err := writeFeatureCollection(f, emts); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"github.com/groundhog-technologies/osmparser/pkg/osm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/dig"
+)
+
+var sortCmd = &cobra.Command{
+	Use:   "sort [input file|-]",
+	Short: "Sort the input by type then id with bounded memory, the output format follows its file name.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSort,
+}
+
+func init() {
+	addPBFWriterFlags(sortCmd)
+	sortCmd.Flags().String("level_db_path", "/tmp/osmparser", "Directory of the temp sorted runs.")
+	sortCmd.Flags().Int("sort_chunk_size", osm.DefaultSortChunkSize, "Max elements sorted in memory at once.")
+}
+
+func runSort(cmd *cobra.Command, args []string) error {
+	if viper.GetString("output") == "" {
+		return errors.New("missing --output")
+	}
+	source, closeSource, err := openSource(args[0])
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	for _, err := range []error{
+		c.Provide(
+			func() int { return viper.GetInt("sort_chunk_size") },
+			dig.Name("sortChunkSize"),
+		),
+		c.Provide(osm.NewPBFSorter),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return c.Invoke(func(sorter osm.PBFDataParser) error {
+		return sorter.Run()
+	})
+}
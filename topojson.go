@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/groundhog-technologies/osmparser/pkg/element"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+)
+
+var topojsonCmd = &cobra.Command{
+	Use:   "topojson [pbf file|-]...",
+	Short: "Convert pbf files to a TopoJSON topology, ways shared by relations written once as arcs.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTopoJSON,
+}
+
+func init() {
+	topojsonCmd.Flags().StringP("output", "o", "", "Output file (default stdout).")
+	topojsonCmd.Flags().Int("quantization", 0, "Quantize coordinates on a grid of this size, ex 100000, 0 keeps them as they are.")
+	topojsonCmd.Flags().String("object_name", "osm", "Name of the feature collection in the topology objects.")
+	addCacheFlags(topojsonCmd)
+	addBoundaryFlags(topojsonCmd)
+	addSimplifyFlags(topojsonCmd)
+	addSchemaFlags(topojsonCmd)
+}
+
+func runTopoJSON(cmd *cobra.Command, args []string) error {
+	source, closeSource, err := openSources(args)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	c, err := newContainer(source)
+	if err != nil {
+		return err
+	}
+	if err := provideIndexers(c); err != nil {
+		return err
+	}
+	return writeElements(c, writeTopology)
+}
+
+// writeTopology collects elements into one topology, written once all
+// are read.
+func writeTopology(w io.Writer, emts <-chan element.Element) error {
+	topology := element.NewTopology(viper.GetString("object_name"))
+	topology.Quantization = viper.GetInt("quantization")
+	simplifier, err := newSimplifier()
+	var schema *element.Schema
+	if err == nil {
+		schema, err = newSchema()
+	}
+	if err != nil {
+		for range emts {
+		}
+		return err
+	}
+	topology.Simplifier = simplifier
+	topology.Schema = schema
+	for emt := range emts {
+		topology.Add(&emt)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := json.NewEncoder(bw).Encode(topology); err != nil {
+		return err
+	}
+	return bw.Flush()
+}